@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
 
 	"gokb-embedder/internal/app"
 	"gokb-embedder/internal/cli"
@@ -22,6 +24,8 @@ func main() {
 			log.Fatalf("Ошибка: %v", err)
 		}
 
+		applyFlags(cfg)
+
 		// Создаём и запускаем приложение
 		application := app.New(cfg)
 		if err := application.Run(); err != nil {
@@ -30,6 +34,124 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "--watch" {
+		// Режим наблюдения: индекс обновляется по мере правок файлов до Ctrl+C
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		}
+		applyFlags(cfg)
+
+		application := app.New(cfg)
+		if err := application.Watch(); err != nil {
+			log.Fatalf("Ошибка режима наблюдения: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "--qdrant-sync" {
+		// Полная синхронизация базы данных с Qdrant без интерфейса
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		}
+
+		application := app.New(cfg)
+		if err := application.SyncQdrant(); err != nil {
+			log.Fatalf("Ошибка синхронизации с Qdrant: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && (os.Args[1] == "--export-bulk" || os.Args[1] == "--push-search") {
+		// Экспорт в OpenSearch/Elasticsearch без интерфейса
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		}
+
+		application := app.New(cfg)
+		if err := application.InitializeDatabase(); err != nil {
+			log.Fatalf("Ошибка инициализации базы данных: %v", err)
+		}
+
+		if os.Args[1] == "--push-search" {
+			err = application.PushToSearch()
+		} else {
+			outputPath := "embeddings_bulk.ndjson"
+			if len(os.Args) > 2 {
+				outputPath = os.Args[2]
+			}
+			err = application.ExportBulkNDJSON(outputPath)
+		}
+		if err != nil {
+			log.Fatalf("Ошибка экспорта: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "db" && os.Args[2] == "maintain" {
+		// Обслуживание базы данных: db maintain [--repair]
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		}
+
+		application := app.New(cfg)
+		if err := application.InitializeDatabase(); err != nil {
+			log.Fatalf("Ошибка инициализации базы данных: %v", err)
+		}
+
+		repair := len(os.Args) > 3 && os.Args[3] == "--repair"
+		if err := application.MaintainDatabase(repair); err != nil {
+			log.Fatalf("Ошибка обслуживания базы данных: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && isSnapshotCommand(os.Args[1]) {
+		// Управление снимками индекса без интерфейса
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		}
+
+		application := app.New(cfg)
+		if err := application.InitializeDatabase(); err != nil {
+			log.Fatalf("Ошибка инициализации базы данных: %v", err)
+		}
+
+		argument := ""
+		if len(os.Args) > 2 {
+			argument = os.Args[2]
+		}
+
+		switch os.Args[1] {
+		case "--snapshot":
+			err = application.CreateSnapshot(argument)
+		case "--snapshots":
+			err = application.ShowSnapshots()
+		case "--drop-snapshot":
+			if argument == "" {
+				log.Fatalf("Укажите метку снимка: --drop-snapshot <label>")
+			}
+			err = application.DeleteSnapshot(argument)
+		case "--gc":
+			// Без аргумента снимки не удаляются, освобождаются только неиспользуемые блоки
+			keep := math.MaxInt
+			if argument != "" {
+				if keep, err = strconv.Atoi(argument); err != nil || keep < 0 {
+					log.Fatalf("Некорректное количество сохраняемых снимков: %s", argument)
+				}
+			}
+			err = application.PruneSnapshots(keep)
+		}
+		if err != nil {
+			log.Fatalf("Ошибка работы со снимками: %v", err)
+		}
+		return
+	}
+
 	// Интерактивный режим по умолчанию
 	cliInterface := cli.NewCLI()
 
@@ -44,6 +166,7 @@ func main() {
 		}
 
 		// Обновляем конфигурацию приложения
+		applyFlags(cfg)
 		application.UpdateConfig(cfg)
 
 		// Выполняем операцию в зависимости от режима
@@ -70,10 +193,26 @@ func main() {
 			if err := application.GenerateEmbeddingsOnly(); err != nil {
 				log.Printf("Ошибка генерации эмбедингов: %v", err)
 			}
+		case "maintain", "maintain_repair":
+			if err := application.InitializeDatabase(); err != nil {
+				log.Printf("Ошибка инициализации базы данных: %v", err)
+				continue
+			}
+			if err := application.MaintainDatabase(cfg.OperationMode == "maintain_repair"); err != nil {
+				log.Printf("Ошибка обслуживания базы данных: %v", err)
+			}
+		case "qdrant_sync":
+			if err := application.SyncQdrant(); err != nil {
+				log.Printf("Ошибка синхронизации с Qdrant: %v", err)
+			}
 		case "full":
 			if err := application.Run(); err != nil {
 				log.Printf("Ошибка выполнения приложения: %v", err)
 			}
+		case "watch":
+			if err := application.Watch(); err != nil {
+				log.Printf("Ошибка режима наблюдения: %v", err)
+			}
 		case "exit":
 			// Выход из программы
 			return
@@ -92,3 +231,30 @@ func main() {
 		}
 	}
 }
+
+// applyFlags применяет флаги командной строки, общие для всех режимов индексации
+func applyFlags(cfg *config.Config) {
+	// --rehash отключает быструю проверку по stat и перечитывает все файлы
+	if hasFlag("--rehash") {
+		cfg.Rehash = true
+	}
+}
+
+// hasFlag проверяет, передан ли флаг в командной строке
+func hasFlag(flag string) bool {
+	for _, arg := range os.Args[1:] {
+		if arg == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// isSnapshotCommand проверяет, является ли флаг командой управления снимками
+func isSnapshotCommand(arg string) bool {
+	switch arg {
+	case "--snapshot", "--snapshots", "--drop-snapshot", "--gc":
+		return true
+	}
+	return false
+}
@@ -1,11 +1,14 @@
 package app
 
 import (
+	"bufio"
 	"context"
-	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -13,22 +16,39 @@ import (
 
 	"gokb-embedder/internal/config"
 	"gokb-embedder/internal/database"
+	"gokb-embedder/internal/elastic"
 	"gokb-embedder/internal/git"
 	"gokb-embedder/internal/models"
 	"gokb-embedder/internal/openai"
 	"gokb-embedder/internal/parsers"
+	"gokb-embedder/internal/qdrant"
 	"gokb-embedder/internal/scanner"
 )
 
+const (
+	// topDuplicateGroups количество групп дубликатов в статистике
+	topDuplicateGroups = 5
+
+	// embeddingPageSize размер страницы блоков без эмбедингов при потоковой генерации
+	embeddingPageSize = 500
+)
+
+// embedder получает эмбединги текста (клиент OpenAI)
+type embedder interface {
+	GetEmbedding(ctx context.Context, text string) ([]float64, error)
+}
+
 // App представляет основное приложение
 type App struct {
 	config     *config.Config
 	logger     *logrus.Logger
-	database   *database.Database
-	openai     *openai.Client
-	scanner    *scanner.Scanner
+	database   database.Storage
+	openai     embedder
+	roots      []*workspaceRoot
 	parsers    *parsers.ParserRegistry
-	gitService *git.GitService
+	fileTypes  *parsers.FileTypes
+	qdrantSink *qdrant.Sink
+	project    models.Project
 }
 
 // New создаёт новое приложение
@@ -63,6 +83,12 @@ func (r *App) UpdateConfig(cfg *config.Config) {
 func (r *App) Run() error {
 	r.logger.Info("🚀 Запуск генератора эмбедингов")
 
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Инициализируем компоненты
 	if err := r.initialize(); err != nil {
 		return fmt.Errorf("ошибка инициализации: %w", err)
@@ -99,6 +125,12 @@ func (r *App) Run() error {
 func (r *App) RunPreprocess() error {
 	r.logger.Info("📝 Запуск предварительной обработки файлов")
 
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Инициализируем компоненты
 	if err := r.initialize(); err != nil {
 		return fmt.Errorf("ошибка инициализации: %w", err)
@@ -139,7 +171,7 @@ func (r *App) initialize() error {
 
 	// Инициализируем базу данных
 	r.logger.Debug("Инициализация базы данных...")
-	db, err := database.NewDatabase(r.config.DBPath)
+	db, err := r.openStorage()
 	if err != nil {
 		return fmt.Errorf("ошибка инициализации базы данных: %w", err)
 	}
@@ -151,39 +183,36 @@ func (r *App) initialize() error {
 	r.openai = openai.NewClient(r.config.OpenAIAPIKey)
 	r.logger.Debug("✅ OpenAI клиент инициализирован")
 
-	// Инициализируем сканер
-	r.logger.Debug("Инициализация сканера...")
-	r.scanner = scanner.NewScanner(r.config.RootDir, r.config.FileExtensions)
-	if r.scanner == nil {
-		return fmt.Errorf("не удалось создать сканер")
+	if err := r.initQdrant(); err != nil {
+		return err
 	}
-	r.logger.Debug("✅ Сканер создан")
 
-	if err := r.scanner.LoadGitignore(); err != nil {
-		r.logger.Warnf("⚠️ Не удалось загрузить .gitignore: %v", err)
-	} else {
-		r.logger.Debug("✅ .gitignore загружен")
+	// Инициализируем сканеры и Git сервисы корней
+	r.logger.Debug("Инициализация корней индексации...")
+	if err := r.initRoots(); err != nil {
+		return err
+	}
+
+	// Правила распознавания файлов без расширения зависят от расширений корней
+	// и нужны и сканерам, и реестру парсеров
+	fileTypes, err := r.loadFileTypes()
+	if err != nil {
+		return err
+	}
+	r.fileTypes = fileTypes
+	r.parsers.SetFileTypes(fileTypes)
+	for _, root := range r.roots {
+		root.scanner.SetFileTypes(fileTypes)
+	}
+
+	if err := validateRenamePolicy(r.config.RenameEmbeddings); err != nil {
+		return fmt.Errorf("ошибка в RENAME_EMBEDDINGS: %w", err)
 	}
 
 	// Регистрируем парсеры
 	r.logger.Debug("Регистрация парсеров...")
 	r.registerParsers()
 
-	// Инициализируем Git сервис (если это Git репозиторий)
-	r.logger.Debug("Проверка Git репозитория...")
-	if git.IsGitRepository(r.config.RootDir) {
-		r.logger.Debug("Git репозиторий найден, инициализация Git сервиса...")
-		gitService, err := git.NewGitService(r.config.RootDir)
-		if err != nil {
-			r.logger.Warnf("⚠️ Не удалось инициализировать Git сервис: %v", err)
-		} else {
-			r.gitService = gitService
-			r.logger.Debug("✅ Git сервис инициализирован")
-		}
-	} else {
-		r.logger.Debug("Git репозиторий не найден, Git сервис не инициализирован")
-	}
-
 	r.logger.Info("✅ Все компоненты инициализированы")
 	return nil
 }
@@ -194,7 +223,7 @@ func (r *App) InitializeDatabase() error {
 
 	// Инициализируем базу данных
 	r.logger.Debug("Инициализация базы данных...")
-	db, err := database.NewDatabase(r.config.DBPath)
+	db, err := r.openStorage()
 	if err != nil {
 		return fmt.Errorf("ошибка инициализации базы данных: %w", err)
 	}
@@ -210,7 +239,7 @@ func (r *App) InitializeForEmbeddings() error {
 
 	// Инициализируем базу данных
 	r.logger.Debug("Инициализация базы данных...")
-	db, err := database.NewDatabase(r.config.DBPath)
+	db, err := r.openStorage()
 	if err != nil {
 		return fmt.Errorf("ошибка инициализации базы данных: %w", err)
 	}
@@ -222,9 +251,163 @@ func (r *App) InitializeForEmbeddings() error {
 	r.openai = openai.NewClient(r.config.OpenAIAPIKey)
 	r.logger.Debug("✅ OpenAI клиент инициализирован")
 
+	return r.initQdrant()
+}
+
+// initQdrant подготавливает коллекцию Qdrant, если она настроена
+func (r *App) initQdrant() error {
+	r.qdrantSink = nil
+	if r.config.QdrantURL == "" {
+		return nil
+	}
+
+	r.logger.Debugf("Инициализация Qdrant: %s, коллекция %s", r.config.QdrantURL, r.config.QdrantCollection)
+	client := qdrant.NewClient(r.config.QdrantURL, r.config.QdrantAPIKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := client.EnsureCollection(ctx, r.config.QdrantCollection, r.config.EmbeddingDimensions, r.config.QdrantDistance); err != nil {
+		return fmt.Errorf("ошибка инициализации Qdrant: %w", err)
+	}
+
+	r.qdrantSink = qdrant.NewSink(client, r.config.QdrantCollection, qdrant.DefaultBatchSize)
+	r.logger.Debug("✅ Коллекция Qdrant готова")
+	return nil
+}
+
+// flushQdrant отправляет в Qdrant накопленные точки
+func (r *App) flushQdrant(ctx context.Context) {
+	if r.qdrantSink == nil {
+		return
+	}
+	if err := r.qdrantSink.Flush(ctx); err != nil {
+		r.logger.Warnf("⚠️ Ошибка отправки точек в Qdrant: %v", err)
+		return
+	}
+	r.logger.Infof("📡 Отправлено точек в Qdrant: %d", r.qdrantSink.Upserted())
+}
+
+// addToQdrant добавляет блок с эмбедингом в очередь отправки в Qdrant
+func (r *App) addToQdrant(ctx context.Context, block *models.CodeBlock, embedding []float64) {
+	if r.qdrantSink == nil {
+		return
+	}
+	if err := r.qdrantSink.Add(ctx, block, embedding); err != nil {
+		r.logger.Warnf("⚠️ Ошибка отправки точек в Qdrant: %v", err)
+	}
+}
+
+// SyncQdrant выполняет полную синхронизацию всех эмбедингов из базы данных в Qdrant
+func (r *App) SyncQdrant() error {
+	r.logger.Info("📡 Полная синхронизация с Qdrant...")
+
+	if r.config.QdrantURL == "" {
+		return fmt.Errorf("Qdrant не настроен (QDRANT_URL)")
+	}
+
+	if err := r.InitializeDatabase(); err != nil {
+		return err
+	}
+	defer r.cleanup()
+
+	if err := r.initQdrant(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	err := r.database.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		return r.qdrantSink.Add(ctx, block, embedding)
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка синхронизации с Qdrant: %w", err)
+	}
+
+	if err := r.qdrantSink.Flush(ctx); err != nil {
+		return fmt.Errorf("ошибка синхронизации с Qdrant: %w", err)
+	}
+
+	r.logger.Infof("✅ Синхронизация завершена! Отправлено точек: %d", r.qdrantSink.Upserted())
 	return nil
 }
 
+// openStorage открывает хранилище, выбранное в конфигурации, и переключает его на текущий проект
+func (r *App) openStorage() (database.Storage, error) {
+	if r.config.PostgresDSN != "" {
+		r.logger.Debug("Используется PostgreSQL (POSTGRES_DSN)")
+	}
+
+	db, err := database.Open(r.config.DBPath, r.config.PostgresDSN, r.config.EmbeddingDimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	r.project = r.currentProject()
+	if err := db.UseProject(r.project); err != nil {
+		db.Close()
+		return nil, err
+	}
+	r.logger.Infof("📚 Проект: %s", r.project.Name)
+
+	if r.config.Snapshot != "" {
+		if err := db.UseSnapshot(r.config.Snapshot); err != nil {
+			db.Close()
+			return nil, err
+		}
+		r.logger.Infof("🗂️ Чтение из снимка: %s", r.config.Snapshot)
+	}
+
+	return db, nil
+}
+
+// currentProject описывает проект по конфигурации: имя, абсолютный корень и URL origin
+func (r *App) currentProject() models.Project {
+	root, err := filepath.Abs(r.config.RootDir)
+	if err != nil {
+		root = r.config.RootDir
+	}
+
+	name := r.config.ProjectName
+	if name == "" {
+		name = filepath.Base(root)
+	}
+
+	project := models.Project{Name: name, Root: root}
+	if git.IsGitRepository(root) {
+		if gitService, err := git.NewGitService(root); err == nil {
+			project.RemoteURL = gitService.GetRemoteURL()
+		}
+	}
+
+	return project
+}
+
+// lockRun захватывает блокировку записи для DB_PATH и возвращает функцию её снятия (повторный вызов ничего не делает).
+// Читатели (статистика, экспорт) блокировку не берут: SQLite в режиме WAL позволяет им работать во время записи.
+// PostgreSQL сам разрешает конкурентную запись, поэтому для него блокировка не нужна.
+func (r *App) lockRun() (func(), error) {
+	if r.config.PostgresDSN != "" {
+		return func() {}, nil
+	}
+
+	lock, err := database.AcquireRunLock(r.config.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	r.logger.Debugf("🔒 Блокировка записи захвачена: %s", database.LockPath(r.config.DBPath))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := lock.Release(); err != nil {
+				r.logger.Warnf("⚠️ %v", err)
+			}
+		})
+	}, nil
+}
+
 // cleanup очищает ресурсы
 func (r *App) cleanup() {
 	if r.database != nil {
@@ -234,18 +417,63 @@ func (r *App) cleanup() {
 	}
 }
 
+// loadFileTypes собирает правила типов файлов: встроенные (DETECT_FILE_TYPES) для языков, парсеры которых
+// включены выбранными расширениями, и явные правила FILE_TYPES (правило=язык), включающие свой парсер
+func (r *App) loadFileTypes() (*parsers.FileTypes, error) {
+	fileTypes := parsers.NewFileTypes()
+	if r.config.DetectFileTypes {
+		fileTypes = parsers.DefaultFileTypes()
+		fileTypes.Retain(r.extensionLanguages())
+	}
+	for _, item := range r.config.FileTypes {
+		sep := strings.LastIndex(item, "=")
+		if sep < 0 {
+			return nil, fmt.Errorf("ошибка в FILE_TYPES: ожидалось правило=язык, получено %q", item)
+		}
+		if err := fileTypes.Add(item[:sep], item[sep+1:]); err != nil {
+			return nil, fmt.Errorf("ошибка в FILE_TYPES: %w", err)
+		}
+	}
+	return fileTypes, nil
+}
+
+// extensionLanguages возвращает языки встроенных парсеров, разбирающих выбранные расширения
+func (r *App) extensionLanguages() map[string]bool {
+	available := []parsers.Parser{
+		parsers.NewPythonParser(),
+		parsers.NewJavaScriptParser(),
+		parsers.NewPHPParser(),
+		parsers.NewGoParser(),
+		parsers.NewTextParser(r.config.TokenLimit),
+	}
+
+	languages := make(map[string]bool)
+	for _, ext := range r.allExtensions() {
+		for _, parser := range available {
+			if parser.CanParse(ext) {
+				languages[parser.GetName()] = true
+			}
+		}
+	}
+	return languages
+}
+
 // registerParsers регистрирует все доступные парсеры
 func (r *App) registerParsers() {
 	r.logger.Debug("Начинаем регистрацию парсеров...")
 
 	// Создаем карту выбранных расширений для быстрого поиска
 	selectedExtensions := make(map[string]bool)
-	for _, ext := range r.config.FileExtensions {
+	for _, ext := range r.allExtensions() {
 		selectedExtensions[ext] = true
 	}
 
+	// Языки, на которые ссылаются правила имён файлов и shebang: явные FILE_TYPES
+	// и встроенные правила уже выбранных расширениями языков
+	languages := r.fileTypes.Languages()
+
 	// Регистрируем Python парсер (если выбраны .py файлы)
-	if selectedExtensions[".py"] {
+	if selectedExtensions[".py"] || languages["python"] {
 		r.logger.Debug("Регистрация Python парсера...")
 		pythonParser := parsers.NewPythonParser()
 		if pythonParser == nil {
@@ -259,7 +487,7 @@ func (r *App) registerParsers() {
 	}
 
 	// Регистрируем JavaScript парсер (если выбраны JS/TS файлы)
-	if selectedExtensions[".js"] {
+	if selectedExtensions[".js"] || languages["javascript"] {
 		r.logger.Debug("Регистрация JavaScript парсера...")
 		javascriptParser := parsers.NewJavaScriptParser()
 		if javascriptParser == nil {
@@ -273,7 +501,7 @@ func (r *App) registerParsers() {
 	}
 
 	// Регистрируем PHP парсер (если выбраны .php файлы)
-	if selectedExtensions[".php"] {
+	if selectedExtensions[".php"] || languages["php"] {
 		r.logger.Debug("Регистрация PHP парсера...")
 		phpParser := parsers.NewPHPParser()
 		if phpParser == nil {
@@ -286,9 +514,23 @@ func (r *App) registerParsers() {
 		r.logger.Debug("⏭️ PHP парсер пропущен (файлы .php не выбраны)")
 	}
 
+	// Регистрируем Go парсер (если выбраны .go файлы)
+	if selectedExtensions[".go"] || languages["go"] {
+		r.logger.Debug("Регистрация Go парсера...")
+		goParser := parsers.NewGoParser()
+		if goParser == nil {
+			r.logger.Error("❌ Не удалось создать Go парсер")
+		} else {
+			r.parsers.Register(goParser)
+			r.logger.Debugf("✅ Go парсер зарегистрирован: %s", goParser.GetName())
+		}
+	} else {
+		r.logger.Debug("⏭️ Go парсер пропущен (файлы .go не выбраны)")
+	}
+
 	// Регистрируем текстовый парсер (если выбраны текстовые файлы)
 	textExtensions := []string{".md", ".yml", ".yaml", ".conf", ".txt"}
-	hasTextFiles := false
+	hasTextFiles := languages["text"]
 	for _, ext := range textExtensions {
 		if selectedExtensions[ext] {
 			hasTextFiles = true
@@ -317,25 +559,39 @@ func (r *App) registerParsers() {
 	}
 }
 
-// scanFiles сканирует файлы в проекте
-func (r *App) scanFiles() ([]string, error) {
+// scanFiles сканирует файлы всех корней индексации
+func (r *App) scanFiles() ([]sourceFile, error) {
 	r.logger.Info("🔍 Сканирование файлов...")
 
-	if r.scanner == nil {
+	if len(r.roots) == 0 {
 		return nil, fmt.Errorf("сканер не инициализирован")
 	}
 
-	r.logger.Debugf("Сканирование в директории: %s", r.config.RootDir)
-	r.logger.Debugf("Ищем файлы с расширениями: %v", r.config.FileExtensions)
+	var files []sourceFile
+	for _, root := range r.roots {
+		r.logger.Infof("🔍 Сканирование в: %s", root.Path)
+		r.logger.Infof("📝 Ищем расширения: %v", root.Extensions)
+		if len(root.IncludeGlobs) > 0 {
+			r.logger.Infof("✅ INCLUDE_GLOBS: %v", root.IncludeGlobs)
+		}
+		if len(root.ExcludeGlobs) > 0 {
+			r.logger.Infof("🚫 EXCLUDE_GLOBS: %v", root.ExcludeGlobs)
+		}
 
-	files, err := r.scanner.ScanFiles()
-	if err != nil {
-		r.logger.Errorf("Ошибка сканирования файлов: %v", err)
-		return nil, err
+		report, err := r.scanRoot(root)
+		if err != nil {
+			r.logger.Errorf("Ошибка сканирования файлов: %v", err)
+			return nil, err
+		}
+		r.logScanReport(report)
+		root.complete = !report.Partial
+		for _, path := range report.Files {
+			files = append(files, sourceFile{root: root, path: path})
+		}
 	}
 
 	r.logger.Infof("📁 Найдено файлов: %d", len(files))
-	if len(files) == 0 {
+	if len(files) == 0 && !r.incremental() {
 		r.logger.Warn("⚠️ Файлы не найдены! Проверьте:")
 		r.logger.Warn("  - Правильность пути ROOT_DIR")
 		r.logger.Warn("  - Наличие файлов с указанными расширениями")
@@ -344,7 +600,7 @@ func (r *App) scanFiles() ([]string, error) {
 		r.logger.Debug("Найденные файлы:")
 		for i, file := range files {
 			if i < 10 { // Показываем только первые 10 файлов
-				r.logger.Debugf("  - %s", file)
+				r.logger.Debugf("  - %s", file.indexPath())
 			} else if i == 10 {
 				r.logger.Debugf("  ... и ещё %d файлов", len(files)-10)
 				break
@@ -355,158 +611,112 @@ func (r *App) scanFiles() ([]string, error) {
 	return files, nil
 }
 
-// checkFileChanges проверяет изменения файлов
-func (r *App) checkFileChanges(files []string) ([]string, error) {
+// checkFileChanges проверяет файлы пулом воркеров и возвращает новые и изменённые файлы вместе с их блоками.
+// Сохранённые хеши и данные stat загружаются одним запросом.
+func (r *App) checkFileChanges(files []sourceFile) ([]scannedFile, error) {
 	r.logger.Info("🔍 Проверка изменений файлов...")
 
-	var filesToProcess []string
+	storedStates, err := r.database.GetFileStates()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сохранённых хешей: %w", err)
+	}
+	if r.config.Rehash {
+		r.logger.Info("🔁 Режим --rehash: содержимое всех файлов читается и хешируется заново")
+	}
 
-	for _, file := range files {
-		fullPath := filepath.Join(r.config.RootDir, file)
+	var filesToProcess []scannedFile
+	var blocks blockStats
+	statOnly := 0
+	skipped := make(map[string]int)
 
-		// Получаем хеш файла
-		fileHash, err := r.getFileHash(fullPath)
-		if err != nil {
-			r.logger.Warnf("⚠️ Не удалось получить хеш файла %s: %v", file, err)
+	results := r.readFiles(files, storedStates)
+	r.markVanishedFiles(files, storedStates)
+	r.detectRenames(results, storedStates)
+
+	for _, result := range results {
+		file := result.file
+
+		if result.err != nil {
+			r.logger.Warnf("⚠️ Не удалось получить хеш файла %s: %v", file, result.err)
+			result.source.root.failed = append(result.source.root.failed, result.source.path)
 			continue
 		}
-
-		// Проверяем хеш в базе данных
-		storedHash, err := r.database.GetFileHash(file)
-		if err != nil {
-			r.logger.Warnf("⚠️ Не удалось получить сохранённый хеш для %s: %v", file, err)
+		if result.statOnly {
+			statOnly++
 		}
 
 		// Если хеш изменился или файл новый
-		if storedHash == "" || storedHash != fileHash {
-			filesToProcess = append(filesToProcess, file)
-
-			// Удаляем старые блоки для изменённого файла
-			if storedHash != "" {
-				if err := r.database.DeleteFileBlocks(file); err != nil {
-					r.logger.Warnf("⚠️ Не удалось удалить старые блоки для %s: %v", file, err)
+		if result.changed() {
+			// Сопоставляем блоки изменённого файла с сохранёнными: эмбединг нужен только новым и изменённым
+			if result.stored.Hash != "" {
+				r.updateFileBlocks(&result, &blocks)
+			}
+			if result.skipReason != "" {
+				// Пропуск по содержимому попадает в отчёт сканирования корня вместе с пропусками по размеру
+				if report := result.source.root.scanner.Report(); report != nil {
+					report.AddSkipped(result.skipReason)
 				}
+				skipped[result.skipReason]++
+				r.logger.Debugf("⏭️ %s пропущен: %s", file, result.skipReason)
+			} else {
+				filesToProcess = append(filesToProcess, result)
 			}
+		}
 
-			// Обновляем хеш
-			if err := r.database.UpdateFileHash(file, fileHash); err != nil {
+		// Обновляем хеш и данные stat: у неизменённого файла могли смениться mtime или формат хеша
+		if result.stale() {
+			if err := r.database.UpdateFileState(result.state); err != nil {
 				r.logger.Warnf("⚠️ Не удалось обновить хеш для %s: %v", file, err)
 			}
 		}
 	}
 
+	r.removeDeletedFiles(storedStates)
+	r.saveIndexStates()
+
+	r.logger.Infof("⚡ Проверено по size/mtime/inode без чтения: %d из %d", statOnly, len(files))
+	if len(skipped) > 0 {
+		r.logger.Info("⏭️ Пропущено по содержимому:")
+		for _, reason := range scanner.SortedCounts(skipped) {
+			r.logger.Infof("      • %s — %d", reason, skipped[reason])
+		}
+	}
+	if blocks.total() > 0 {
+		r.logger.Infof("🧩 Блоки изменённых файлов: без изменений %d, сдвинуто %d, изменено %d, новых %d, удалено %d",
+			blocks.reused, blocks.moved, blocks.changed, blocks.added, blocks.removed)
+		r.flushQdrant(context.Background())
+	}
 	r.logger.Infof("📝 Файлов для обработки: %d", len(filesToProcess))
-	for _, file := range filesToProcess {
-		r.logger.Debugf("  - %s", file)
+	for _, result := range filesToProcess {
+		r.logger.Debugf("  - %s", result.file)
 	}
 
 	return filesToProcess, nil
 }
 
-// processFiles обрабатывает файлы и создаёт эмбединги
-func (r *App) processFiles(files []string) error {
+// processFiles создаёт эмбединги для блоков обработанных файлов
+func (r *App) processFiles(files []scannedFile) error {
 	r.logger.Info("🔄 Обработка файлов...")
 
-	var allBlocks []*models.CodeBlock
-
-	// Создаём прогресс-бар
-	bar := progressbar.Default(int64(len(files)), "Обработка файлов")
-
-	for _, file := range files {
-		bar.Add(1)
-
-		fullPath := filepath.Join(r.config.RootDir, file)
-		ext := filepath.Ext(file)
-
-		// Получаем парсер для файла
-		parser, found := r.parsers.GetParser(ext)
-		if !found {
-			r.logger.Warnf("⚠️ Не найден парсер для файла %s", file)
-			continue
-		}
-
-		// Парсим файл
-		blocks, err := parser.ParseFile(fullPath)
-		if err != nil {
-			r.logger.Warnf("⚠️ Ошибка парсинга файла %s: %v", file, err)
-			continue
-		}
-
-		// Устанавливаем относительные пути и получаем сообщения коммитов
-		for _, block := range blocks {
-			// Устанавливаем относительный путь от корня проекта
-			block.SetRelativePath(file)
-
-			// Получаем сообщения коммитов
-			if r.gitService != nil {
-				commitMessages, err := r.gitService.GetLastCommitMessages(fullPath, r.config.NCommits)
-				if err != nil {
-					r.logger.Debugf("Не удалось получить коммиты для %s: %v", file, err)
-				} else {
-					block.SetCommitMessages(commitMessages)
-				}
-			}
-		}
-
-		allBlocks = append(allBlocks, blocks...)
-	}
-
-	bar.Finish()
+	allBlocks := r.collectBlocks(files)
 	r.logger.Infof("📦 Всего блоков для эмбединга: %d", len(allBlocks))
 
 	// Создаём эмбединги
-	return r.createEmbeddings(allBlocks)
+	if err := r.createEmbeddings(allBlocks); err != nil {
+		return err
+	}
+
+	if r.config.RenameEmbeddings == RenameReembed {
+		return r.reembedRenamedBlocks(files)
+	}
+	return nil
 }
 
-// processFilesWithoutEmbeddings обрабатывает файлы без создания эмбедингов
-func (r *App) processFilesWithoutEmbeddings(files []string) error {
+// processFilesWithoutEmbeddings сохраняет блоки обработанных файлов без создания эмбедингов
+func (r *App) processFilesWithoutEmbeddings(files []scannedFile) error {
 	r.logger.Info("📝 Предварительная обработка файлов (без эмбедингов)...")
 
-	var allBlocks []*models.CodeBlock
-
-	// Создаём прогресс-бар
-	bar := progressbar.Default(int64(len(files)), "Обработка файлов")
-
-	for _, file := range files {
-		bar.Add(1)
-
-		fullPath := filepath.Join(r.config.RootDir, file)
-		ext := filepath.Ext(file)
-
-		// Получаем парсер для файла
-		parser, found := r.parsers.GetParser(ext)
-		if !found {
-			r.logger.Warnf("⚠️ Не найден парсер для файла %s", file)
-			continue
-		}
-
-		// Парсим файл
-		blocks, err := parser.ParseFile(fullPath)
-		if err != nil {
-			r.logger.Warnf("⚠️ Ошибка парсинга файла %s: %v", file, err)
-			continue
-		}
-
-		// Устанавливаем относительные пути и получаем сообщения коммитов
-		for _, block := range blocks {
-			// Устанавливаем относительный путь от корня проекта
-			block.SetRelativePath(file)
-
-			// Получаем сообщения коммитов
-			if r.gitService != nil {
-				commitMessages, err := r.gitService.GetLastCommitMessages(fullPath, r.config.NCommits)
-				if err != nil {
-					r.logger.Debugf("Не удалось получить коммиты для %s: %v", file, err)
-				} else {
-					block.SetCommitMessages(commitMessages)
-				}
-			}
-		}
-
-		allBlocks = append(allBlocks, blocks...)
-	}
-
-	bar.Finish()
+	allBlocks := r.collectBlocks(files)
 	r.logger.Infof("📦 Всего блоков обработано: %d", len(allBlocks))
 
 	// Сохраняем блоки без эмбедингов
@@ -533,6 +743,13 @@ func (r *App) saveBlocksWithoutEmbeddings(blocks []*models.CodeBlock) error {
 			continue // Пропускаем существующий блок
 		}
 
+		// Неизменённый блок из снимка возвращается в индекс без повторной записи
+		if reused, err := r.database.ReuseBlock(block); err != nil {
+			r.logger.Warnf("⚠️ Ошибка повторного использования блока %s: %v", block, err)
+		} else if reused {
+			continue
+		}
+
 		// Формируем текст для эмбединга
 		embeddingText := block.GetEmbeddingText()
 
@@ -551,47 +768,78 @@ func (r *App) saveBlocksWithoutEmbeddings(blocks []*models.CodeBlock) error {
 func (r *App) GenerateEmbeddingsOnly() error {
 	r.logger.Info("🧠 Генерация эмбедингов для существующих блоков...")
 
-	// Получаем блоки без эмбедингов
-	blocks, err := r.database.GetBlocksWithoutEmbeddings()
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Количество нужно только для прогресс-бара: сами блоки читаются страницами
+	pending, err := r.database.CountBlocksWithoutEmbeddings()
 	if err != nil {
 		return fmt.Errorf("ошибка получения блоков без эмбедингов: %w", err)
 	}
 
-	if len(blocks) == 0 {
+	if pending == 0 {
 		r.logger.Info("✅ Все блоки уже имеют эмбединги!")
 		return nil
 	}
 
-	r.logger.Infof("📦 Найдено блоков без эмбедингов: %d", len(blocks))
+	r.logger.Infof("📦 Найдено блоков без эмбедингов: %d", pending)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
 	// Создаём прогресс-бар
-	bar := progressbar.Default(int64(len(blocks)), "Генерация эмбедингов")
+	bar := progressbar.Default(int64(pending), "Генерация эмбедингов")
 
-	for _, block := range blocks {
-		bar.Add(1)
+	err = r.database.ForEachBlockWithoutEmbeddings(embeddingPageSize, func(page []*models.CodeBlock) error {
+		for _, block := range page {
+			bar.Add(1)
+			r.embedPendingBlock(ctx, block)
+		}
+		return ctx.Err()
+	})
 
-		// Формируем текст для эмбединга
-		embeddingText := block.GetEmbeddingText()
+	bar.Finish()
+	r.flushQdrant(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка генерации эмбедингов: %w", err)
+	}
+	return nil
+}
 
-		// Получаем эмбединг
-		embedding, err := r.openai.GetEmbedding(ctx, embeddingText)
-		if err != nil {
-			r.logger.Warnf("⚠️ Ошибка получения эмбединга для блока %s: %v", block, err)
-			continue
-		}
+// embedPendingBlock получает и сохраняет эмбединг уже сохранённого блока.
+// Ошибки по отдельному блоку логируются и не прерывают обработку остальных.
+func (r *App) embedPendingBlock(ctx context.Context, block *models.CodeBlock) {
+	// Копия тела, эмбединг которого уже получен в этом проходе, использует общий вектор
+	embedding, err := r.database.GetVector(block)
+	if err != nil {
+		r.logger.Warnf("⚠️ Ошибка поиска вектора для блока %s: %v", block, err)
+		return
+	}
+	if embedding != nil {
+		r.addToQdrant(ctx, block, embedding)
+		return
+	}
 
-		// Обновляем эмбединг
-		if err := r.database.UpdateEmbedding(block, embedding); err != nil {
-			r.logger.Warnf("⚠️ Ошибка обновления эмбединга для блока %s: %v", block, err)
-			continue
-		}
+	// Формируем текст для эмбединга
+	embeddingText := block.GetEmbeddingText()
+
+	// Получаем эмбединг
+	embedding, err = r.openai.GetEmbedding(ctx, embeddingText)
+	if err != nil {
+		r.logger.Warnf("⚠️ Ошибка получения эмбединга для блока %s: %v", block, err)
+		return
 	}
 
-	bar.Finish()
-	return nil
+	// Обновляем эмбединг
+	if err := r.database.UpdateEmbedding(block, embedding); err != nil {
+		r.logger.Warnf("⚠️ Ошибка обновления эмбединга для блока %s: %v", block, err)
+		return
+	}
+
+	r.addToQdrant(ctx, block, embedding)
 }
 
 // ShowDatabaseStatistics показывает статистику базы данных
@@ -603,10 +851,25 @@ func (r *App) ShowDatabaseStatistics() error {
 		return fmt.Errorf("ошибка получения статистики: %w", err)
 	}
 
+	if projects, err := r.database.ListProjects(); err == nil && len(projects) > 1 {
+		r.logger.Infof("📚 Проектов в базе: %d", len(projects))
+		for _, project := range projects {
+			r.logger.Infof("   • %s (%s)", project.Name, project.Root)
+		}
+	}
+
+	r.logger.Infof("📚 Проект: %s", stats["project"])
+	if r.config.Snapshot != "" {
+		r.logger.Infof("🗂️ Снимок: %s", r.config.Snapshot)
+	} else if snapshots, err := r.database.ListSnapshots(); err == nil && len(snapshots) > 0 {
+		r.logger.Infof("🗂️ Снимков: %d (последний %s)", len(snapshots), snapshots[0].Label)
+	}
 	r.logger.Infof("📁 Всего файлов: %d", stats["file_count"])
 	r.logger.Infof("📦 Всего блоков: %d", stats["total_blocks"])
 	r.logger.Infof("✅ Блоков с эмбедингами: %d", stats["blocks_with_embeddings"])
 	r.logger.Infof("⏳ Блоков без эмбедингов: %d", stats["blocks_without_embeddings"])
+	r.logger.Infof("🧬 Уникальных векторов: %d (сэкономлено эмбедингов: %d)",
+		stats["unique_vectors"], stats["deduplicated_blocks"])
 
 	// Показываем статистику по типам блоков
 	if blockTypes, ok := stats["block_types"].(map[string]int); ok {
@@ -616,6 +879,21 @@ func (r *App) ShowDatabaseStatistics() error {
 		}
 	}
 
+	// Самые частые одинаковые тела со всеми местами, где они встречаются
+	groups, err := r.database.FindDuplicates(topDuplicateGroups)
+	if err != nil {
+		return fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+	if len(groups) > 0 {
+		r.logger.Info("👯 Самые частые дубликаты:")
+		for _, group := range groups {
+			r.logger.Infof("   • %s (%d мест)", shortSHA(group.BodyHash), len(group.Blocks))
+			for _, block := range group.Blocks {
+				r.logger.Infof("       %s:%d-%d", block.GetRelativePath(), block.StartLine, block.EndLine)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -642,11 +920,33 @@ func (r *App) createEmbeddings(blocks []*models.CodeBlock) error {
 			continue // Пропускаем существующий блок
 		}
 
+		// Неизменённый блок из снимка возвращается в индекс вместе со своим эмбедингом
+		if reused, err := r.database.ReuseBlock(block); err != nil {
+			r.logger.Warnf("⚠️ Ошибка повторного использования блока %s: %v", block, err)
+		} else if reused {
+			continue
+		}
+
 		// Формируем текст для эмбединга
 		embeddingText := block.GetEmbeddingText()
 
+		// Тело уже встречалось: сохраняем только новое место, вектор общий
+		embedding, err := r.database.GetVector(block)
+		if err != nil {
+			r.logger.Warnf("⚠️ Ошибка поиска вектора для блока %s: %v", block, err)
+			continue
+		}
+		if embedding != nil {
+			if err := r.database.SaveBlockWithoutEmbedding(block, embeddingText); err != nil {
+				r.logger.Warnf("⚠️ Ошибка сохранения блока %s: %v", block, err)
+				continue
+			}
+			r.addToQdrant(ctx, block, embedding)
+			continue
+		}
+
 		// Получаем эмбединг
-		embedding, err := r.openai.GetEmbedding(ctx, embeddingText)
+		embedding, err = r.openai.GetEmbedding(ctx, embeddingText)
 		if err != nil {
 			r.logger.Warnf("⚠️ Ошибка получения эмбединга для блока %s: %v", block, err)
 			continue
@@ -657,23 +957,15 @@ func (r *App) createEmbeddings(blocks []*models.CodeBlock) error {
 			r.logger.Warnf("⚠️ Ошибка сохранения эмбединга для блока %s: %v", block, err)
 			continue
 		}
+
+		r.addToQdrant(ctx, block, embedding)
 	}
 
 	bar.Finish()
+	r.flushQdrant(ctx)
 	return nil
 }
 
-// getFileHash получает MD5 хеш файла
-func (r *App) getFileHash(filePath string) (string, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", err
-	}
-
-	hash := md5.Sum(data)
-	return fmt.Sprintf("%x", hash), nil
-}
-
 // ExportDatabaseToCSV экспортирует базу данных в CSV файл
 func (r *App) ExportDatabaseToCSV(outputPath string) error {
 	r.logger.Info("📤 Экспорт базы данных в CSV...")
@@ -704,3 +996,296 @@ func (r *App) ExportDatabaseToCSV(outputPath string) error {
 	r.logger.Infof("✅ Экспорт завершён! Файл сохранён: %s", outputPath)
 	return nil
 }
+
+// ExportBulkNDJSON экспортирует эмбединги в NDJSON для _bulk и маппинг индекса рядом с ним
+func (r *App) ExportBulkNDJSON(outputPath string) error {
+	r.logger.Info("📤 Экспорт эмбедингов в формате _bulk NDJSON...")
+
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	exporter, err := elastic.NewExporter(r.config.SearchIndex, r.config.SearchFlavor, r.config.EmbeddingDimensions)
+	if err != nil {
+		return err
+	}
+
+	// Маппинг индекса
+	mappingPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".mapping.json"
+	mappingJSON, err := json.MarshalIndent(exporter.Mapping(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации маппинга: %w", err)
+	}
+	if err := os.WriteFile(mappingPath, mappingJSON, 0o644); err != nil {
+		return fmt.Errorf("ошибка записи маппинга: %w", err)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла экспорта: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	count := 0
+	err = r.database.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		count++
+		return exporter.WriteDocument(writer, block, embedding)
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка экспорта: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("ошибка записи файла экспорта: %w", err)
+	}
+
+	r.logger.Infof("✅ Экспортировано документов: %d", count)
+	r.logger.Infof("📁 NDJSON: %s", outputPath)
+	r.logger.Infof("📁 Маппинг: %s", mappingPath)
+	return nil
+}
+
+// PushToSearch создаёт индекс и отправляет эмбединги в OpenSearch/Elasticsearch чанками
+func (r *App) PushToSearch() error {
+	r.logger.Info("📡 Отправка эмбедингов в поисковый движок...")
+
+	if r.config.SearchURL == "" {
+		return fmt.Errorf("поисковый движок не настроен (SEARCH_URL)")
+	}
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	exporter, err := elastic.NewExporter(r.config.SearchIndex, r.config.SearchFlavor, r.config.EmbeddingDimensions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	client := elastic.NewClient(r.config.SearchURL, r.config.SearchUsername, r.config.SearchPassword)
+	if err := client.CreateIndex(ctx, r.config.SearchIndex, exporter.Mapping()); err != nil {
+		return err
+	}
+
+	bulk := elastic.NewBulkWriter(client, exporter, r.config.SearchChunkSize)
+	err = r.database.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		return bulk.Add(ctx, block, embedding)
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки в %s: %w", r.config.SearchFlavor, err)
+	}
+	if err := bulk.Flush(ctx); err != nil {
+		return fmt.Errorf("ошибка отправки в %s: %w", r.config.SearchFlavor, err)
+	}
+
+	r.logger.Infof("✅ Отправлено документов в индекс %s: %d", r.config.SearchIndex, bulk.Sent())
+	return nil
+}
+
+// MaintainDatabase проверяет и обслуживает базу данных: целостность, векторы, хеши файлов, VACUUM/ANALYZE
+func (r *App) MaintainDatabase(repair bool) error {
+	r.logger.Info("🛠️ Обслуживание базы данных...")
+
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	report, err := r.database.Maintain(database.MaintenanceOptions{
+		Dimensions: r.config.EmbeddingDimensions,
+		Repair:     repair,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка обслуживания базы данных: %w", err)
+	}
+
+	if len(report.IntegrityErrors) == 0 {
+		r.logger.Info("✅ Проверка целостности: ok")
+	} else {
+		r.logger.Warnf("❌ Проверка целостности: проблем %d", len(report.IntegrityErrors))
+		for _, message := range report.IntegrityErrors {
+			r.logger.Warnf("   • %s", message)
+		}
+	}
+
+	r.logger.Infof("🧬 Битых векторов: %d", len(report.MalformedVectors))
+	r.logger.Infof("📏 Векторов неверной размерности (ожидается %d): %d",
+		r.config.EmbeddingDimensions, len(report.WrongDimensionVectors))
+
+	r.logger.Infof("🔑 Хешей файлов без блоков: %d", len(report.HashesWithoutBlocks))
+	for _, ref := range report.HashesWithoutBlocks {
+		r.logger.Debugf("   • [%s] %s", ref.Project, ref.Path)
+	}
+	r.logger.Infof("📦 Файлов с блоками без хеша: %d", len(report.BlocksWithoutHashes))
+	for _, ref := range report.BlocksWithoutHashes {
+		r.logger.Debugf("   • [%s] %s", ref.Project, ref.Path)
+	}
+
+	switch {
+	case report.Repaired:
+		r.logger.Info("🔧 Найденные проблемы исправлены: файлы будут переиндексированы, эмбединги сгенерированы заново")
+	case report.Problems() > 0:
+		r.logger.Info("💡 Для исправления запустите с флагом --repair")
+	}
+
+	r.logger.Infof("💾 Размер базы: %s → %s", formatBytes(report.SizeBefore), formatBytes(report.SizeAfter))
+	return nil
+}
+
+// formatBytes форматирует размер в байтах в читаемый вид
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// CreateSnapshot сохраняет текущий индекс проекта как снимок.
+// Если метка не задана, используется короткий SHA коммита HEAD.
+func (r *App) CreateSnapshot(label string) error {
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshot := models.Snapshot{Label: label}
+	if git.IsGitRepository(r.config.RootDir) {
+		gitService, err := git.NewGitService(r.config.RootDir)
+		if err == nil {
+			if commit, err := gitService.GetHeadCommit(); err == nil {
+				snapshot.CommitSHA = commit
+			} else {
+				r.logger.Warnf("⚠️ Не удалось получить коммит HEAD: %v", err)
+			}
+			snapshot.Branch = gitService.GetCurrentBranch()
+		}
+	}
+
+	if snapshot.Label == "" {
+		if len(snapshot.CommitSHA) < 12 {
+			return fmt.Errorf("не удалось определить коммит HEAD, укажите метку снимка")
+		}
+		snapshot.Label = snapshot.CommitSHA[:12]
+	}
+
+	created, err := r.database.CreateSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	r.logger.Infof("🗂️ Снимок %s создан: блоков %d (коммит %s, ветка %s)",
+		created.Label, created.Blocks, shortSHA(created.CommitSHA), created.Branch)
+	return nil
+}
+
+// ShowSnapshots выводит список снимков текущего проекта
+func (r *App) ShowSnapshots() error {
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	snapshots, err := r.database.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		r.logger.Info("🗂️ Снимков пока нет")
+		return nil
+	}
+
+	r.logger.Infof("🗂️ Снимков проекта %s: %d", r.project.Name, len(snapshots))
+	for _, snapshot := range snapshots {
+		r.logger.Infof("   • %s: блоков %d, коммит %s, ветка %s, создан %s",
+			snapshot.Label, snapshot.Blocks, shortSHA(snapshot.CommitSHA), snapshot.Branch,
+			snapshot.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// DeleteSnapshot удаляет снимок и освобождает блоки, которые больше нигде не используются
+func (r *App) DeleteSnapshot(label string) error {
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.database.DeleteSnapshot(label); err != nil {
+		return err
+	}
+	r.logger.Infof("🗑️ Снимок %s удалён", label)
+
+	return r.collectGarbage()
+}
+
+// PruneSnapshots оставляет keep самых новых снимков, удаляет остальные и собирает мусор
+func (r *App) PruneSnapshots(keep int) error {
+	if r.database == nil {
+		return fmt.Errorf("база данных не инициализирована")
+	}
+
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshots, err := r.database.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for i, snapshot := range snapshots {
+		if i < keep {
+			continue
+		}
+		if err := r.database.DeleteSnapshot(snapshot.Label); err != nil {
+			return err
+		}
+		r.logger.Infof("🗑️ Снимок %s удалён", snapshot.Label)
+	}
+
+	return r.collectGarbage()
+}
+
+// collectGarbage удаляет блоки, не входящие ни в текущий индекс, ни в один снимок
+func (r *App) collectGarbage() error {
+	removed, err := r.database.CollectGarbage()
+	if err != nil {
+		return err
+	}
+	r.logger.Infof("🧹 Освобождено блоков: %d", removed)
+	return nil
+}
+
+// shortSHA возвращает сокращённый SHA коммита
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gokb-embedder/internal/git"
+	"gokb-embedder/internal/models"
+	"gokb-embedder/internal/scanner"
+)
+
+// scanRoot сканирует корень. Если корень — Git репозиторий и уже индексировался на коммите, который
+// остаётся предком HEAD, проверяются только файлы из git diff с этого коммита, незакоммиченные изменения
+// и файлы, которые были незакоммиченными в прошлый раз, при любом SCAN_MODE. Иначе корень сканируется полностью.
+func (r *App) scanRoot(root *workspaceRoot) (*scanner.ScanReport, error) {
+	root.indexState = nil
+	root.deleted = nil
+	root.renames = nil
+	root.failed = nil
+	root.incremental = false
+
+	if root.gitService == nil {
+		return root.scanner.Scan()
+	}
+
+	head, err := root.gitService.GetHeadCommit()
+	if err != nil {
+		r.logger.Debugf("Не удалось получить коммит HEAD корня %s: %v", root.Path, err)
+		return root.scanner.Scan()
+	}
+	dirty, err := root.gitService.WorkingTreeChanges()
+	if err != nil {
+		r.logger.Warnf("⚠️ Не удалось получить незакоммиченные изменения корня %s: %v", root.Path, err)
+		return root.scanner.Scan()
+	}
+
+	// Новое состояние сохраняется после проверки изменений
+	root.indexState = &models.IndexState{
+		Root:       root.Name,
+		CommitSHA:  head,
+		DirtyPaths: changedPaths(dirty),
+		Settings:   r.scanSettings(root),
+	}
+
+	stored, err := r.database.GetIndexState(root.Name)
+	if err != nil {
+		r.logger.Warnf("⚠️ %v", err)
+		return root.scanner.Scan()
+	}
+	if reason := r.fullScanReason(root, stored); reason != "" {
+		r.logger.Infof("🔍 Полная проверка %s: %s", root.Path, reason)
+		return root.scanner.Scan()
+	}
+
+	changes, err := root.gitService.DiffSince(stored.CommitSHA)
+	if err != nil {
+		r.logger.Warnf("⚠️ Не удалось получить изменения с коммита %s: %v", shortSHA(stored.CommitSHA), err)
+		return root.scanner.Scan()
+	}
+
+	// Файлы, незакоммиченные в прошлый раз, проверяются снова: их правки могли откатить
+	candidates := changedPaths(append(changes, dirty...))
+	candidates = mergePaths(candidates, stored.DirtyPaths)
+	for _, path := range candidates {
+		if name := filepath.Base(path); name == ".gitignore" || name == scanner.GokbIgnoreFile {
+			r.logger.Infof("🔍 Полная проверка %s: изменился %s", root.Path, path)
+			return root.scanner.Scan()
+		}
+	}
+
+	report, err := root.scanner.ScanPaths(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	// Изменённые пути, которых нет среди найденных файлов, удалены или больше не индексируются;
+	// из индекса убираются те из них, что были проиндексированы раньше
+	found := make(map[string]bool, len(report.Files))
+	for _, path := range report.Files {
+		found[path] = true
+	}
+	for _, path := range candidates {
+		if !found[path] {
+			root.deleted = append(root.deleted, path)
+		}
+	}
+
+	root.renames = gitRenames(append(changes, dirty...))
+	root.incremental = true
+	r.logger.Infof("🔀 %s: изменённых путей с коммита %s: %d (к проверке %d, удалены или исключены %d)",
+		root.Path, shortSHA(stored.CommitSHA), len(candidates), len(report.Files), len(root.deleted))
+	return report, nil
+}
+
+// fullScanReason возвращает причину полной проверки корня или пустую строку, если достаточно git diff
+func (r *App) fullScanReason(root *workspaceRoot, stored models.IndexState) string {
+	switch {
+	case r.config.Rehash:
+		return "режим --rehash"
+	case stored.CommitSHA == "":
+		return "корень ещё не индексировался по коммиту"
+	case stored.Settings != root.indexState.Settings:
+		return "изменились настройки сканирования"
+	case !root.gitService.IsAncestor(stored.CommitSHA):
+		return fmt.Sprintf("коммит %s не найден в истории HEAD (история переписана)", shortSHA(stored.CommitSHA))
+	}
+	return ""
+}
+
+// scanSettings возвращает отпечаток настроек, от которых зависит выбор файлов корня
+func (r *App) scanSettings(root *workspaceRoot) string {
+	settings := fmt.Sprintf("%q %q %q %d %q %q %t %q", root.Extensions, root.IncludeGlobs, root.ExcludeGlobs,
+		r.config.MaxFileSize, r.config.SymlinkPolicy, r.config.FileTypes, r.config.DetectFileTypes, r.config.ScanMode)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(settings)))
+}
+
+// removeDeletedFiles удаляет из индекса блоки и хеши проиндексированных ранее файлов,
+// которые удалены или исключены с прошлой индексации. Удалённый путь может быть директорией
+// (событие наблюдения): тогда удаляются все проиндексированные файлы под ней.
+func (r *App) removeDeletedFiles(storedStates map[string]models.FileState) {
+	var indexed []string
+	removed := make(map[string]bool)
+	for _, root := range r.roots {
+		for _, path := range root.deleted {
+			file := sourceFile{root: root, path: path}
+			paths := []string{path}
+			if _, ok := storedStates[file.indexPath()]; !ok {
+				if indexed == nil {
+					indexed = sortedPaths(storedStates)
+				}
+				paths = r.filesUnder(root, path, indexed)
+			}
+
+			for _, filePath := range paths {
+				file := sourceFile{root: root, path: filePath}
+				if removed[file.indexPath()] {
+					continue
+				}
+				if err := r.removeFile(file); err != nil {
+					r.logger.Warnf("⚠️ Не удалось удалить из индекса %s: %v", file.indexPath(), err)
+					continue
+				}
+				removed[file.indexPath()] = true
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		r.logger.Infof("🗑️ Удалено из индекса файлов: %d", len(removed))
+	}
+}
+
+// filesUnder возвращает пути относительно корня проиндексированных файлов внутри директории dir корня.
+// indexed — отсортированные пути индекса.
+func (r *App) filesUnder(root *workspaceRoot, dir string, indexed []string) []string {
+	prefix := sourceFile{root: root, path: dir}.indexPath() + string(filepath.Separator)
+
+	var paths []string
+	for i := sort.SearchStrings(indexed, prefix); i < len(indexed) && strings.HasPrefix(indexed[i], prefix); i++ {
+		if owner, path := r.rootOf(indexed[i]); owner == root {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// sortedPaths возвращает отсортированные пути сохранённых состояний файлов
+func sortedPaths(states map[string]models.FileState) []string {
+	paths := make([]string, 0, len(states))
+	for path := range states {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// removeFile удаляет блоки, точки Qdrant и хеш файла
+func (r *App) removeFile(file sourceFile) error {
+	fullPath := file.fullPath()
+	if err := r.database.DeleteFileBlocks(fullPath); err != nil {
+		return err
+	}
+	if r.qdrantSink != nil {
+		if err := r.qdrantSink.DeleteFile(context.Background(), r.project.Name, fullPath); err != nil {
+			return err
+		}
+	}
+	return r.database.DeleteFileHash(file.indexPath())
+}
+
+// saveIndexStates запоминает коммит HEAD и незакоммиченные файлы каждого Git корня.
+// Файлы, которые не удалось прочитать, сохраняются как незакоммиченные, чтобы следующий запуск проверил их снова.
+func (r *App) saveIndexStates() {
+	for _, root := range r.roots {
+		if root.indexState == nil {
+			continue
+		}
+		root.indexState.DirtyPaths = mergePaths(root.indexState.DirtyPaths, root.failed)
+		if err := r.database.SaveIndexState(*root.indexState); err != nil {
+			r.logger.Warnf("⚠️ %v", err)
+			continue
+		}
+		r.logger.Debugf("📌 Корень %s проиндексирован на коммите %s", root.Path, shortSHA(root.indexState.CommitSHA))
+	}
+}
+
+// changedPaths возвращает пути изменений без повторов: новые пути и прежние пути переименованных файлов
+func changedPaths(changes []git.FileChange) []string {
+	var paths []string
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+		if change.OldPath != "" {
+			paths = append(paths, change.OldPath)
+		}
+	}
+	return mergePaths(paths, nil)
+}
+
+// gitRenames возвращает переименования из изменений git: новый путь → прежний
+func gitRenames(changes []git.FileChange) map[string]string {
+	renames := make(map[string]string)
+	for _, change := range changes {
+		if change.Status == git.StatusRenamed && change.OldPath != "" {
+			renames[change.Path] = change.OldPath
+		}
+	}
+	return renames
+}
+
+// mergePaths объединяет списки путей без повторов в отсортированном порядке
+func mergePaths(a, b []string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, path := range append(append([]string(nil), a...), b...) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gokb-embedder/internal/scanner"
+)
+
+// initGitRepo создаёт репозиторий в root с изолированной конфигурацией git
+func initGitRepo(t *testing.T, root string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git не установлен")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	runGit(t, root, "init", "-q")
+}
+
+// runGit выполняет команду git в root
+func runGit(t *testing.T, root string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+}
+
+// indexOnce выполняет один запуск без эмбедингов и возвращает отсортированные пути
+// выбранных для проверки файлов и признак выбора по git diff
+func indexOnce(t *testing.T, app *App) ([]string, bool) {
+	t.Helper()
+	files, err := app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	processed, err := app.checkFileChanges(files)
+	if err != nil {
+		t.Fatalf("checkFileChanges: %v", err)
+	}
+	if err := app.processFilesWithoutEmbeddings(processed); err != nil {
+		t.Fatalf("processFilesWithoutEmbeddings: %v", err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, filepath.ToSlash(file.path))
+	}
+	sort.Strings(paths)
+	return paths, app.roots[0].incremental
+}
+
+func TestGitDiffSelection(t *testing.T) {
+	// Выбор по git diff работает при любом источнике списка файлов
+	for _, mode := range []string{scanner.ModeGit, scanner.ModeWalk} {
+		t.Run(mode, func(t *testing.T) {
+			testGitDiffSelection(t, mode)
+		})
+	}
+}
+
+func testGitDiffSelection(t *testing.T, mode string) {
+	root := t.TempDir()
+	initGitRepo(t, root)
+	writeFixture(t, root, map[string]string{
+		"a.py":     "def a():\n    return 1\n",
+		"b.py":     "def b():\n    return 1\n",
+		"c.py":     "def c():\n    return 1\n",
+		"lib/d.py": "def d():\n    return 1\n",
+	})
+	runGit(t, root, "add", "-A")
+	runGit(t, root, "commit", "-q", "-m", "initial")
+
+	cfg := testConfig(t, root)
+	cfg.ScanMode = mode
+	app := newTestApp(t, cfg)
+
+	all := []string{"a.py", "b.py", "lib/e.py", "new.py"}
+	steps := []struct {
+		name        string
+		change      func()
+		selected    []string
+		incremental bool
+		indexed     []string
+	}{
+		{
+			name:     "первый запуск сканирует всё",
+			change:   func() {},
+			selected: []string{"a.py", "b.py", "c.py", "lib/d.py"},
+			indexed:  []string{"a.py", "b.py", "c.py", "lib/d.py"},
+		},
+		{
+			name: "коммиты, удаление, переименование, правка и новый файл вне коммита",
+			change: func() {
+				writeFixture(t, root, map[string]string{"b.py": "def b():\n    return 22\n"})
+				runGit(t, root, "rm", "-q", "c.py")
+				runGit(t, root, "mv", "lib/d.py", "lib/e.py")
+				runGit(t, root, "commit", "-q", "-am", "edit")
+				writeFixture(t, root, map[string]string{
+					"a.py":   "def a():\n    return 333\n",
+					"new.py": "def new():\n    return 1\n",
+				})
+			},
+			selected:    all,
+			incremental: true,
+			indexed:     all,
+		},
+		{
+			name: "незакоммиченные в прошлый раз файлы проверяются снова",
+			change: func() {
+				runGit(t, root, "checkout", "--", "a.py")
+			},
+			selected:    []string{"a.py", "new.py"},
+			incremental: true,
+			indexed:     all,
+		},
+		{
+			name: "переписанная история ведёт к полной проверке",
+			change: func() {
+				writeFixture(t, root, map[string]string{"b.py": "def b():\n    return 4444\n"})
+				runGit(t, root, "commit", "-q", "--amend", "-am", "rewritten")
+			},
+			selected: all,
+			indexed:  all,
+		},
+		{
+			name:        "без изменений проверяется только прошлый незакоммиченный файл",
+			change:      func() {},
+			selected:    []string{"new.py"},
+			incremental: true,
+			indexed:     all,
+		},
+		{
+			name: "смена источника списка файлов ведёт к полной проверке",
+			change: func() {
+				if mode == scanner.ModeGit {
+					cfg.ScanMode = scanner.ModeWalk
+				} else {
+					cfg.ScanMode = scanner.ModeGit
+				}
+			},
+			selected: all,
+			indexed:  all,
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		selected, incremental := indexOnce(t, app)
+		if strings.Join(selected, ",") != strings.Join(step.selected, ",") {
+			t.Errorf("%s: выбраны %v, ожидалось %v", step.name, selected, step.selected)
+		}
+		if incremental != step.incremental {
+			t.Errorf("%s: выбор по git diff = %v, ожидалось %v", step.name, incremental, step.incremental)
+		}
+
+		states, err := app.database.GetFileStates()
+		if err != nil {
+			t.Fatalf("GetFileStates: %v", err)
+		}
+		var indexed []string
+		for path := range states {
+			indexed = append(indexed, filepath.ToSlash(path))
+		}
+		sort.Strings(indexed)
+		if strings.Join(indexed, ",") != strings.Join(step.indexed, ",") {
+			t.Errorf("%s: в индексе %v, ожидалось %v", step.name, indexed, step.indexed)
+		}
+	}
+}
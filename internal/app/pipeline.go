@@ -0,0 +1,333 @@
+package app
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+
+	"gokb-embedder/internal/database"
+	"gokb-embedder/internal/models"
+	"gokb-embedder/internal/scanner"
+)
+
+// racyWindow файлы, изменённые позже этого интервала до проверки, сохраняются без времени изменения:
+// запись в пределах точности mtime не отличалась бы по stat, поэтому при следующем запуске они хешируются заново
+const racyWindow = 2 * time.Second
+
+// scannedFile результат обработки файла воркером: состояние файла и, если он изменился, его блоки
+type scannedFile struct {
+	source sourceFile
+
+	// file путь файла в индексе (с префиксом корня)
+	file   string
+	state  models.FileState
+	stored models.FileState
+	blocks []*models.CodeBlock
+
+	// modified файл новый или его содержимое отличается от сохранённого
+	modified bool
+
+	// renamedFrom путь в индексе исчезнувшего файла, блоки которого перенесены на этот файл
+	renamedFrom string
+
+	// kept сохранённые блоки, оставшиеся в индексе после сопоставления с разобранными
+	kept []*models.CodeBlock
+
+	// statOnly файл признан неизменённым по size/mtime/inode, содержимое не читалось
+	statOnly bool
+
+	// err ошибка чтения: файл пропускается целиком
+	err error
+
+	// skipReason причина пропуска изменённого файла по содержимому: хеш сохраняется, блоков нет
+	skipReason string
+
+	// parseErr ошибка парсинга или отсутствие парсера: хеш сохраняется, блоков нет
+	parseErr error
+}
+
+// changed проверяет, что файл новый или его содержимое изменилось
+func (f scannedFile) changed() bool {
+	return f.modified
+}
+
+// stale проверяет, что сохранённое состояние устарело: изменились содержимое, данные stat или формат хеша
+func (f scannedFile) stale() bool {
+	return f.state != f.stored
+}
+
+// fileState собирает данные stat файла без хеша содержимого
+func fileState(path string, info os.FileInfo) models.FileState {
+	state := models.FileState{
+		Path:  path,
+		Size:  info.Size(),
+		Inode: scanner.Inode(info),
+	}
+	if time.Since(info.ModTime()) >= racyWindow {
+		state.ModTime = info.ModTime().UnixNano()
+	}
+	return state
+}
+
+// contentHash возвращает SHA-256 содержимого файла
+func contentHash(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// sameContent проверяет, что содержимое совпадает с сохранённым хешем.
+// MD5 из баз до перехода на SHA-256 сверяется по MD5, чтобы обновление не переиндексировало все файлы.
+func sameContent(storedHash, hash string, content []byte) bool {
+	if len(storedHash) == md5.Size*2 {
+		return storedHash == fmt.Sprintf("%x", md5.Sum(content))
+	}
+	return storedHash == hash
+}
+
+// blockStats счётчики сопоставления блоков изменённых файлов с сохранёнными за запуск
+type blockStats struct {
+	reused  int
+	moved   int
+	changed int
+	added   int
+	removed int
+}
+
+// add учитывает результат сопоставления блоков одного файла
+func (s *blockStats) add(diff database.BlockDiff) {
+	s.reused += len(diff.Reused)
+	s.moved += len(diff.Moved)
+	s.changed += len(diff.Changed)
+	s.added += len(diff.Added) - len(diff.Changed)
+	s.removed += len(diff.Removed)
+}
+
+// total возвращает количество сопоставленных блоков
+func (s *blockStats) total() int {
+	return s.reused + s.moved + s.changed + s.added + s.removed
+}
+
+// workerCount возвращает размер пула воркеров (SCAN_WORKERS, по умолчанию по числу ядер)
+func (r *App) workerCount() int {
+	if r.config.ScanWorkers > 0 {
+		return r.config.ScanWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// readFiles читает файлы пулом воркеров. Файлы с неизменёнными size/mtime/inode не читаются,
+// остальные читаются один раз: прочитанное содержимое идёт в хеш и, если файл изменился, в парсер.
+// Результаты возвращаются в порядке входного списка.
+func (r *App) readFiles(files []sourceFile, storedStates map[string]models.FileState) []scannedFile {
+	results := make([]scannedFile, len(files))
+	jobs := make(chan int)
+
+	workers := r.workerCount()
+	r.logger.Infof("⚙️ Воркеров чтения и хеширования: %d", workers)
+	bar := progressbar.Default(int64(len(files)), "Чтение файлов")
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = r.scanFile(files[i], storedStates[files[i].indexPath()])
+				bar.Add(1)
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	bar.Finish()
+
+	return results
+}
+
+// scanFile проверяет файл по stat и, если stat изменился, читает его, считает хеш
+// и, если хеш отличается от сохранённого, проверяет содержимое и парсит
+func (r *App) scanFile(source sourceFile, stored models.FileState) scannedFile {
+	file := source.indexPath()
+	result := scannedFile{source: source, file: file, stored: stored}
+	fullPath := source.fullPath()
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.state = fileState(file, info)
+
+	// Размер, время изменения и inode совпадают с сохранёнными: содержимое не читаем
+	if !r.config.Rehash && result.state.SameStat(stored) {
+		result.state.Hash = stored.Hash
+		result.statOnly = true
+		return result
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.state.Hash = contentHash(content)
+
+	result.modified = !sameContent(stored.Hash, result.state.Hash, content)
+	if !result.modified {
+		return result
+	}
+
+	// Бинарные, минифицированные и сгенерированные файлы не парсятся
+	if reason := scanner.ClassifyContent(content); reason != "" {
+		result.skipReason = reason
+		return result
+	}
+
+	// Получаем парсер для файла
+	parser, found := r.parsers.GetParser(r.parsers.DetectLanguage(source.path, content))
+	if !found {
+		result.parseErr = fmt.Errorf("не найден парсер")
+		return result
+	}
+
+	blocks, err := parser.ParseContent(fullPath, content)
+	if err != nil {
+		result.parseErr = err
+		return result
+	}
+	models.AssignOrdinals(blocks)
+
+	// Сообщения коммитов одинаковы для всех блоков файла
+	var commitMessages []string
+	if source.root.gitService != nil && len(blocks) > 0 {
+		commitMessages, err = source.root.gitService.GetLastCommitMessages(fullPath, r.config.NCommits)
+		if err != nil {
+			r.logger.Debugf("Не удалось получить коммиты для %s: %v", file, err)
+		}
+	}
+
+	// Устанавливаем проект, относительный путь от корня проекта и сообщения коммитов
+	for _, block := range blocks {
+		block.Project = r.project.Name
+		block.SetRelativePath(file)
+		block.RealPath = source.root.scanner.RealPath(source.path)
+		if commitMessages != nil {
+			block.SetCommitMessages(commitMessages)
+		}
+	}
+	result.blocks = blocks
+
+	return result
+}
+
+// updateFileBlocks сопоставляет блоки изменённого файла с сохранёнными по пути символа и хешу тела.
+// Неизменённые блоки остаются в индексе вместе с векторами, сдвинутые получают новые строки,
+// старые версии изменённых и удалённые блоки убираются. В result остаются только блоки, которым нужен эмбединг.
+func (r *App) updateFileBlocks(result *scannedFile, stats *blockStats) {
+	file := result.file
+	fullPath := result.source.fullPath()
+
+	var diff database.BlockDiff
+	stored, err := r.database.GetFileBlocks(fullPath)
+	if err != nil {
+		r.logger.Warnf("⚠️ Не удалось получить сохранённые блоки %s: %v", file, err)
+	}
+
+	// Файл не разобран, пропущен по содержимому или сохранённые блоки недоступны: старые блоки удаляются целиком
+	if result.parseErr != nil || result.skipReason != "" || err != nil {
+		if err := r.database.DeleteFileBlocks(fullPath); err != nil {
+			r.logger.Warnf("⚠️ Не удалось удалить старые блоки для %s: %v", file, err)
+		}
+		diff.Removed = stored
+	} else {
+		diff = database.DiffBlocks(stored, result.blocks)
+		result.blocks = diff.Added
+
+		for _, moved := range diff.Moved {
+			if err := r.database.MoveBlock(moved.ID, moved.CodeBlock, moved.GetEmbeddingText()); err != nil {
+				r.logger.Warnf("⚠️ Не удалось обновить положение блока %s: %v", moved.CodeBlock, err)
+			}
+		}
+
+		var staleIDs []int64
+		for _, block := range diff.Stale() {
+			staleIDs = append(staleIDs, block.ID)
+		}
+		if err := r.database.DeleteBlocks(staleIDs); err != nil {
+			r.logger.Warnf("⚠️ Не удалось удалить старые блоки для %s: %v", file, err)
+		}
+	}
+	stats.add(diff)
+	for _, kept := range append(append([]database.StoredBlock(nil), diff.Reused...), diff.Moved...) {
+		result.kept = append(result.kept, kept.CodeBlock)
+	}
+
+	if r.qdrantSink == nil {
+		return
+	}
+	ctx := context.Background()
+	if result.parseErr != nil || result.skipReason != "" || err != nil {
+		if err := r.qdrantSink.DeleteFile(ctx, r.project.Name, fullPath); err != nil {
+			r.logger.Warnf("⚠️ Не удалось удалить точки Qdrant для %s: %v", file, err)
+		}
+		return
+	}
+
+	// Точки Qdrant адресуются путём символа и его номером среди одноимённых: удаляются точки старых версий
+	// и блоков, сменивших номер; сдвинутые блоки отправляются с новыми строками, неизменённые не трогаются.
+	// У переименованного файла точек по новому пути ещё нет, поэтому отправляются все сохранённые блоки.
+	storedByID := make(map[int64]*models.CodeBlock, len(stored))
+	for _, block := range stored {
+		storedByID[block.ID] = block.CodeBlock
+	}
+	var stalePoints []*models.CodeBlock
+	for _, block := range diff.Stale() {
+		stalePoints = append(stalePoints, block.CodeBlock)
+	}
+	for _, moved := range diff.Moved {
+		if old := storedByID[moved.ID]; old != nil && old.StableID() != moved.StableID() {
+			stalePoints = append(stalePoints, old)
+		}
+	}
+	if err := r.qdrantSink.Delete(ctx, stalePoints); err != nil {
+		r.logger.Warnf("⚠️ Не удалось удалить точки Qdrant для %s: %v", file, err)
+	}
+
+	upsert := diff.Moved
+	if result.renamedFrom != "" {
+		upsert = append(append([]database.StoredBlock(nil), diff.Reused...), diff.Moved...)
+	}
+	for _, kept := range upsert {
+		embedding, err := r.database.GetVector(kept.CodeBlock)
+		if err != nil {
+			r.logger.Warnf("⚠️ Ошибка поиска вектора для блока %s: %v", kept.CodeBlock, err)
+			continue
+		}
+		if embedding != nil {
+			r.addToQdrant(ctx, kept.CodeBlock, embedding)
+		}
+	}
+}
+
+// collectBlocks собирает блоки обработанных файлов и сообщает о файлах, которые не удалось разобрать
+func (r *App) collectBlocks(files []scannedFile) []*models.CodeBlock {
+	var allBlocks []*models.CodeBlock
+	for _, file := range files {
+		if file.parseErr != nil {
+			r.logger.Warnf("⚠️ Ошибка парсинга файла %s: %v", file.file, file.parseErr)
+			continue
+		}
+		allBlocks = append(allBlocks, file.blocks...)
+	}
+	return allBlocks
+}
@@ -0,0 +1,371 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gokb-embedder/internal/config"
+	"gokb-embedder/internal/database"
+	"gokb-embedder/internal/models"
+	"gokb-embedder/internal/scanner"
+)
+
+// writeFixture создаёт файлы относительно root. Время изменения сдвигается за racyWindow,
+// чтобы следующая проверка могла признать файлы неизменёнными по stat.
+func writeFixture(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	past := time.Now().Add(-time.Hour)
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+}
+
+// testConfig возвращает конфигурацию для корня root с базой SQLite во временной директории
+func testConfig(t *testing.T, root string) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.RootDir = root
+	cfg.DBPath = filepath.Join(t.TempDir(), "kb.sqlite3")
+	cfg.FileExtensions = []string{".py"}
+	cfg.ProjectName = "test"
+	return cfg
+}
+
+// newTestApp создаёт и инициализирует приложение без вывода логов
+func newTestApp(t *testing.T, cfg *config.Config) *App {
+	t.Helper()
+	app := New(cfg)
+	app.logger.SetOutput(io.Discard)
+	if err := app.initialize(); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	t.Cleanup(app.cleanup)
+	return app
+}
+
+// countingStorage считает запросы сохранённых хешей: пакетные и по одному файлу
+type countingStorage struct {
+	database.Storage
+	fileStates atomic.Int32
+	fileHashes atomic.Int32
+}
+
+func (s *countingStorage) GetFileStates() (map[string]models.FileState, error) {
+	s.fileStates.Add(1)
+	return s.Storage.GetFileStates()
+}
+
+func (s *countingStorage) GetFileHash(filePath string) (string, error) {
+	s.fileHashes.Add(1)
+	return s.Storage.GetFileHash(filePath)
+}
+
+// fakeEmbedder возвращает эмбединг из длины текста и считает запросы
+type fakeEmbedder struct {
+	calls atomic.Int32
+}
+
+func (e *fakeEmbedder) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	e.calls.Add(1)
+	return []float64{float64(len(text)), 1}, nil
+}
+
+func TestCheckFileChangesParallel(t *testing.T) {
+	root := t.TempDir()
+	fixture := map[string]string{
+		"gen/api_pb.py":    "# @generated by protoc\nclass Api:\n    pass\n",
+		"dist/bundle.py":   strings.Repeat("x=1;", 400) + "\n",
+		"bin/data.py":      "\x00\x01\x02",
+		"src/notes.txt":    "not selected\n",
+		"src/deep/last.py": "def last():\n    return 0\n",
+	}
+	for i := 0; i < 40; i++ {
+		fixture[fmt.Sprintf("src/mod%02d.py", i)] = fmt.Sprintf("def f%d():\n    return %d\n", i, i)
+	}
+	writeFixture(t, root, fixture)
+
+	cfg := testConfig(t, root)
+	cfg.ScanWorkers = 4
+	app := newTestApp(t, cfg)
+	storage := &countingStorage{Storage: app.database}
+	app.database = storage
+
+	// Первый запуск: все файлы читаются воркерами, сгенерированные, минифицированные и бинарные пропускаются
+	files, err := app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	if len(files) != 44 {
+		t.Fatalf("scanFiles: %d файлов, ожидалось 44", len(files))
+	}
+	processed, err := app.checkFileChanges(files)
+	if err != nil {
+		t.Fatalf("checkFileChanges: %v", err)
+	}
+	if len(processed) != 41 {
+		t.Fatalf("к обработке %d файлов, ожидалось 41", len(processed))
+	}
+
+	// Результаты воркеров идут в порядке найденных файлов
+	next := 0
+	for _, file := range files {
+		if next < len(processed) && processed[next].file == file.indexPath() {
+			next++
+		}
+	}
+	if next != len(processed) {
+		t.Errorf("порядок обработанных файлов не совпадает с порядком сканирования")
+	}
+	for _, result := range processed {
+		if result.statOnly || len(result.blocks) == 0 {
+			t.Errorf("%s: statOnly=%v, блоков %d; ожидалось чтение и разбор", result.file, result.statOnly, len(result.blocks))
+		}
+	}
+	if err := app.processFilesWithoutEmbeddings(processed); err != nil {
+		t.Fatalf("processFilesWithoutEmbeddings: %v", err)
+	}
+
+	// Причины пропуска по содержимому попадают в отчёт сканирования корня
+	report := app.roots[0].scanner.Report()
+	for _, reason := range []string{scanner.SkipGenerated, scanner.SkipMinified, scanner.SkipBinary} {
+		if report.Skipped[reason] != 1 {
+			t.Errorf("Skipped[%s] = %d, ожидалось 1 (%v)", reason, report.Skipped[reason], report.Skipped)
+		}
+	}
+	if report.SkippedFiles != 3 {
+		t.Errorf("SkippedFiles = %d, ожидалось 3", report.SkippedFiles)
+	}
+
+	// Хеши пропущенных файлов сохранены, блоков у них нет
+	states, err := storage.Storage.GetFileStates()
+	if err != nil {
+		t.Fatalf("GetFileStates: %v", err)
+	}
+	if len(states) != 44 {
+		t.Errorf("сохранено состояний %d, ожидалось 44", len(states))
+	}
+	for _, name := range []string{"gen/api_pb.py", "dist/bundle.py", "bin/data.py"} {
+		blocks, err := app.database.GetFileBlocks(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || len(blocks) != 0 {
+			t.Errorf("%s: блоков %d (%v), ожидалось 0", name, len(blocks), err)
+		}
+	}
+
+	// Второй запуск: все файлы проверяются по stat без чтения
+	files, err = app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	for _, result := range app.readFiles(files, states) {
+		if !result.statOnly || result.changed() {
+			t.Errorf("%s: statOnly=%v, changed=%v; ожидалась проверка по stat", result.file, result.statOnly, result.changed())
+		}
+	}
+	processed, err = app.checkFileChanges(files)
+	if err != nil {
+		t.Fatalf("checkFileChanges: %v", err)
+	}
+	if len(processed) != 0 {
+		t.Errorf("к обработке %d файлов, ожидалось 0", len(processed))
+	}
+
+	// Изменённый файл читается заново, остальные — нет
+	writeFixture(t, root, map[string]string{"src/mod07.py": "def f7():\n    return 70\n"})
+	files, err = app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	processed, err = app.checkFileChanges(files)
+	if err != nil {
+		t.Fatalf("checkFileChanges: %v", err)
+	}
+	if len(processed) != 1 || processed[0].file != filepath.Join("src", "mod07.py") {
+		t.Errorf("к обработке %v, ожидался только src/mod07.py", processed)
+	}
+
+	// Сохранённые хеши загружаются одним запросом на запуск, а не по файлу
+	if got := storage.fileStates.Load(); got != 3 {
+		t.Errorf("GetFileStates вызван %d раз, ожидалось 3 (по одному на запуск)", got)
+	}
+	if got := storage.fileHashes.Load(); got != 0 {
+		t.Errorf("GetFileHash вызван %d раз, ожидалось 0", got)
+	}
+}
+
+func TestFileTypesFollowEnabledParsers(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"docs/guide.md": "# Guide\n",
+		"app.py":        "print(1)\n",
+		"Dockerfile":    "FROM alpine\n",
+		"rules.mk":      "all:\n",
+		"bin/manage":    "#!/usr/bin/env python3\nprint(1)\n",
+		"bin/deploy":    "#!/bin/bash\necho ok\n",
+		"Justfile":      "build:\n",
+	})
+
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+		want      []string
+		parsers   []string
+	}{
+		{
+			name:      "встроенные правила выключены по умолчанию",
+			configure: func(cfg *config.Config) { cfg.FileExtensions = []string{".md"} },
+			want:      []string{"docs/guide.md"},
+			parsers:   []string{"text"},
+		},
+		{
+			name: "встроенные правила только для выбранных языков",
+			configure: func(cfg *config.Config) {
+				cfg.FileExtensions = []string{".py"}
+				cfg.DetectFileTypes = true
+			},
+			want:    []string{"app.py", "bin/manage"},
+			parsers: []string{"python"},
+		},
+		{
+			name: "явное правило включает свой парсер",
+			configure: func(cfg *config.Config) {
+				cfg.FileExtensions = []string{".py"}
+				cfg.FileTypes = []string{"Justfile=text"}
+			},
+			want:    []string{"Justfile", "app.py"},
+			parsers: []string{"python", "text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, root)
+			tt.configure(cfg)
+			app := newTestApp(t, cfg)
+
+			files, err := app.scanFiles()
+			if err != nil {
+				t.Fatalf("scanFiles: %v", err)
+			}
+			var paths []string
+			for _, file := range files {
+				paths = append(paths, filepath.ToSlash(file.path))
+			}
+			sort.Strings(paths)
+			if strings.Join(paths, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("файлы %v, ожидалось %v", paths, tt.want)
+			}
+
+			var names []string
+			for _, parser := range app.parsers.GetAllParsers() {
+				names = append(names, parser.GetName())
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.parsers, ",") {
+				t.Errorf("парсеры %v, ожидалось %v", names, tt.parsers)
+			}
+		})
+	}
+}
+
+func TestUpdateFileBlocksCounts(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{"app.py": "def keep():\n    return 1\n\n\n" +
+		"def shift():\n    return 2\n\n\n" +
+		"def edit():\n    return 3\n\n\n" +
+		"def gone():\n    return 4\n"})
+
+	app := newTestApp(t, testConfig(t, root))
+	if _, incremental := indexOnce(t, app); incremental {
+		t.Fatalf("первый запуск должен сканировать всё")
+	}
+	fullPath := filepath.Join(root, "app.py")
+	before := storedBlocksByMethod(t, app, fullPath)
+
+	// keep на месте, fresh вставлен перед shift, тело edit изменено, gone удалён
+	writeFixture(t, root, map[string]string{"app.py": "def keep():\n    return 1\n\n\n" +
+		"def fresh():\n    return 0\n\n\n" +
+		"def shift():\n    return 2\n\n\n" +
+		"def edit():\n    return 30\n"})
+	files, err := app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	states, err := app.database.GetFileStates()
+	if err != nil {
+		t.Fatalf("GetFileStates: %v", err)
+	}
+	results := app.readFiles(files, states)
+	if len(results) != 1 || !results[0].changed() {
+		t.Fatalf("ожидался один изменённый файл, получено %d", len(results))
+	}
+
+	var stats blockStats
+	result := results[0]
+	app.updateFileBlocks(&result, &stats)
+
+	want := blockStats{reused: 1, moved: 1, changed: 1, added: 1, removed: 1}
+	if stats != want {
+		t.Errorf("счётчики %+v, ожидалось %+v", stats, want)
+	}
+	var embed []string
+	for _, block := range result.blocks {
+		embed = append(embed, *block.MethodName)
+	}
+	if strings.Join(embed, ",") != "fresh,edit" {
+		t.Errorf("к эмбедингу %v, ожидались только fresh и новая версия edit", embed)
+	}
+	if len(result.kept) != 2 {
+		t.Errorf("сохранено блоков %d, ожидалось 2", len(result.kept))
+	}
+
+	// Неизменённый и сдвинутый блоки сохраняют строки индекса, сдвинутый получает новые строки
+	if err := app.processFilesWithoutEmbeddings([]scannedFile{result}); err != nil {
+		t.Fatalf("processFilesWithoutEmbeddings: %v", err)
+	}
+	after := storedBlocksByMethod(t, app, fullPath)
+	if after["keep"].ID != before["keep"].ID || after["keep"].StartLine != before["keep"].StartLine {
+		t.Errorf("keep: %+v → %+v, ожидался тот же блок на месте", before["keep"], after["keep"])
+	}
+	if after["shift"].ID != before["shift"].ID || after["shift"].StartLine == before["shift"].StartLine {
+		t.Errorf("shift: строка %d → %d, ожидался тот же блок на новой строке", before["shift"].StartLine, after["shift"].StartLine)
+	}
+	if after["edit"].ID == before["edit"].ID {
+		t.Errorf("edit: старая версия блока должна быть заменена")
+	}
+	if _, ok := after["gone"]; ok || len(after) != 4 {
+		t.Errorf("в индексе блоки %v, ожидались keep, fresh, shift и edit", after)
+	}
+}
+
+// storedBlocksByMethod возвращает сохранённые блоки файла по имени функции
+func storedBlocksByMethod(t *testing.T, app *App, fullPath string) map[string]database.StoredBlock {
+	t.Helper()
+	stored, err := app.database.GetFileBlocks(fullPath)
+	if err != nil {
+		t.Fatalf("GetFileBlocks: %v", err)
+	}
+	blocks := make(map[string]database.StoredBlock)
+	for _, block := range stored {
+		if block.MethodName != nil {
+			blocks[*block.MethodName] = block
+		}
+	}
+	return blocks
+}
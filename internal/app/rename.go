@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+
+	"gokb-embedder/internal/models"
+)
+
+// Политики эмбедингов переименованных файлов (RENAME_EMBEDDINGS)
+const (
+	// RenameKeep блоки переносятся на новый путь вместе с векторами, API не вызывается
+	RenameKeep = "keep"
+
+	// RenameReembed блоки переносятся, но эмбединги пересчитываются: текст эмбединга содержит путь файла
+	RenameReembed = "reembed"
+)
+
+// validateRenamePolicy проверяет значение RENAME_EMBEDDINGS
+func validateRenamePolicy(policy string) error {
+	switch policy {
+	case RenameKeep, RenameReembed:
+		return nil
+	}
+	return fmt.Errorf("неизвестное значение %q (допустимо %s или %s)", policy, RenameKeep, RenameReembed)
+}
+
+// renameCandidate проиндексированный файл, исчезнувший с прошлой индексации
+type renameCandidate struct {
+	source sourceFile
+	state  models.FileState
+	used   bool
+}
+
+// markVanishedFiles отмечает удалёнными проиндексированные файлы полностью просканированных корней,
+// которых больше нет на диске. Существующие файлы, исключённые правилами, остаются в индексе.
+func (r *App) markVanishedFiles(files []sourceFile, storedStates map[string]models.FileState) {
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		found[file.indexPath()] = true
+	}
+
+	for _, indexPath := range sortedPaths(storedStates) {
+		if found[indexPath] {
+			continue
+		}
+		root, path := r.rootOf(indexPath)
+		if root == nil || !root.complete {
+			continue
+		}
+		if _, err := os.Lstat(sourceFile{root: root, path: path}.fullPath()); !os.IsNotExist(err) {
+			continue
+		}
+		root.deleted = mergePaths(root.deleted, []string{path})
+	}
+}
+
+// detectRenames сопоставляет новые файлы с исчезнувшими: сначала по переименованиям git,
+// затем по совпадению хеша содержимого. Блоки найденной пары переносятся на новый путь
+// вместо повторного получения эмбедингов. Прежний путь остаётся удалённым: его хеш
+// и точки Qdrant убирает removeDeletedFiles.
+func (r *App) detectRenames(results []scannedFile, storedStates map[string]models.FileState) {
+	var indexed []string
+	byPath := make(map[string]*renameCandidate)
+	byHash := make(map[string][]*renameCandidate)
+	for _, root := range r.roots {
+		for _, deleted := range root.deleted {
+			paths := []string{deleted}
+			if _, ok := storedStates[sourceFile{root: root, path: deleted}.indexPath()]; !ok {
+				// Исчезнувшая директория (событие наблюдения): кандидаты — её проиндексированные файлы
+				if indexed == nil {
+					indexed = sortedPaths(storedStates)
+				}
+				paths = r.filesUnder(root, deleted, indexed)
+			}
+
+			for _, path := range paths {
+				source := sourceFile{root: root, path: path}
+				if byPath[source.indexPath()] != nil {
+					continue
+				}
+				candidate := &renameCandidate{source: source, state: storedStates[source.indexPath()]}
+				byPath[source.indexPath()] = candidate
+				byHash[candidate.state.Hash] = append(byHash[candidate.state.Hash], candidate)
+			}
+		}
+	}
+	if len(byPath) == 0 {
+		return
+	}
+
+	renamed, moved := 0, 0
+	for i := range results {
+		result := &results[i]
+		if result.err != nil || result.stored.Hash != "" || result.state.Hash == "" {
+			continue
+		}
+
+		var candidate *renameCandidate
+		if oldPath, ok := result.source.root.renames[result.source.path]; ok {
+			candidate = byPath[sourceFile{root: result.source.root, path: oldPath}.indexPath()]
+		}
+		if candidate == nil || candidate.used {
+			candidate = nil
+			for _, c := range byHash[result.state.Hash] {
+				if !c.used {
+					candidate = c
+					break
+				}
+			}
+		}
+		if candidate == nil {
+			continue
+		}
+
+		count, err := r.renameFile(candidate, result)
+		if err != nil {
+			r.logger.Warnf("⚠️ Не удалось перенести блоки %s → %s: %v", candidate.source.indexPath(), result.file, err)
+			continue
+		}
+		candidate.used = true
+		renamed++
+		moved += count
+		r.logger.Debugf("🚚 %s → %s (блоков %d)", candidate.source.indexPath(), result.file, count)
+	}
+
+	if renamed > 0 {
+		r.logger.Infof("🚚 Переименовано файлов: %d (блоков перенесено %d)", renamed, moved)
+	}
+}
+
+// renameFile переносит сохранённые блоки исчезнувшего файла на путь нового и подставляет
+// прежнее состояние файла как сохранённое: дальше файл обрабатывается как изменённый,
+// и updateFileBlocks сопоставляет перенесённые блоки с разобранными.
+func (r *App) renameFile(old *renameCandidate, result *scannedFile) (int, error) {
+	stored, err := r.database.GetFileBlocks(old.source.fullPath())
+	if err != nil {
+		return 0, err
+	}
+
+	fullPath := result.source.fullPath()
+	realPath := result.source.root.scanner.RealPath(result.source.path)
+	for _, block := range stored {
+		block.FilePath = fullPath
+		block.SetRelativePath(result.file)
+		block.RealPath = realPath
+		if err := r.database.MoveBlock(block.ID, block.CodeBlock, block.GetEmbeddingText()); err != nil {
+			return 0, err
+		}
+	}
+
+	result.stored = old.state
+	result.renamedFrom = old.source.indexPath()
+	return len(stored), nil
+}
+
+// reembedRenamedBlocks пересчитывает эмбединги блоков, перенесённых из переименованных файлов
+// с сохранёнными векторами. Вектор общий для одинаковых тел, поэтому он обновляется и у их копий.
+func (r *App) reembedRenamedBlocks(files []scannedFile) error {
+	var blocks []*models.CodeBlock
+	for _, file := range files {
+		if file.renamedFrom != "" {
+			blocks = append(blocks, file.kept...)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	r.logger.Infof("🚚 Пересчёт эмбедингов перенесённых блоков: %d", len(blocks))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	bar := progressbar.Default(int64(len(blocks)), "Пересчёт эмбедингов")
+	for _, block := range blocks {
+		bar.Add(1)
+
+		embedding, err := r.openai.GetEmbedding(ctx, block.GetEmbeddingText())
+		if err != nil {
+			r.logger.Warnf("⚠️ Ошибка получения эмбединга для блока %s: %v", block, err)
+			continue
+		}
+		if err := r.database.UpdateEmbedding(block, embedding); err != nil {
+			r.logger.Warnf("⚠️ Ошибка обновления эмбединга для блока %s: %v", block, err)
+			continue
+		}
+		r.addToQdrant(ctx, block, embedding)
+	}
+
+	bar.Finish()
+	r.flushQdrant(ctx)
+	return nil
+}
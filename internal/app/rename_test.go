@@ -0,0 +1,112 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameByHash(t *testing.T) {
+	const content = "def first():\n    return 1\n\n\ndef second():\n    return 2\n"
+
+	tests := []struct {
+		name     string
+		policy   string
+		reembeds bool
+	}{
+		{name: "keep переносит векторы без запросов", policy: RenameKeep},
+		{name: "reembed пересчитывает перенесённые блоки", policy: RenameReembed, reembeds: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFixture(t, root, map[string]string{
+				"src/a.py":    content,
+				"src/keep.py": "def keep():\n    return 0\n",
+			})
+
+			cfg := testConfig(t, root)
+			cfg.RenameEmbeddings = tt.policy
+			app := newTestApp(t, cfg)
+			embeddings := &fakeEmbedder{}
+			app.openai = embeddings
+
+			index := func() {
+				t.Helper()
+				files, err := app.scanFiles()
+				if err != nil {
+					t.Fatalf("scanFiles: %v", err)
+				}
+				if err := app.indexFiles(files); err != nil {
+					t.Fatalf("indexFiles: %v", err)
+				}
+			}
+			index()
+
+			oldPath := filepath.Join(root, "src", "a.py")
+			before := storedBlocksByMethod(t, app, oldPath)
+			if len(before) != 2 {
+				t.Fatalf("до переименования блоков %d, ожидалось 2", len(before))
+			}
+			vectors := make(map[string][]float64)
+			for name, block := range before {
+				vector, err := app.database.GetVector(block.CodeBlock)
+				if err != nil || vector == nil {
+					t.Fatalf("%s: вектор не найден (%v)", name, err)
+				}
+				vectors[name] = vector
+			}
+			embeddings.calls.Store(0)
+
+			// Переименование без правок: файл находится по хешу содержимого
+			newPath := filepath.Join(root, "library", "a.py")
+			if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+				t.Fatalf("MkdirAll: %v", err)
+			}
+			if err := os.Rename(oldPath, newPath); err != nil {
+				t.Fatalf("Rename: %v", err)
+			}
+			index()
+
+			want := int32(0)
+			if tt.reembeds {
+				want = 2
+			}
+			if got := embeddings.calls.Load(); got != want {
+				t.Errorf("запросов эмбедингов %d, ожидалось %d", got, want)
+			}
+
+			after := storedBlocksByMethod(t, app, newPath)
+			if len(after) != 2 {
+				t.Fatalf("после переименования блоков %d, ожидалось 2", len(after))
+			}
+			for name, block := range after {
+				if block.ID != before[name].ID {
+					t.Errorf("%s: ID %d → %d, ожидался перенос той же строки", name, before[name].ID, block.ID)
+				}
+				if block.RelativePath != filepath.Join("library", "a.py") {
+					t.Errorf("%s: относительный путь %q, ожидался library/a.py", name, block.RelativePath)
+				}
+				vector, err := app.database.GetVector(block.CodeBlock)
+				if err != nil {
+					t.Fatalf("GetVector: %v", err)
+				}
+				if changed := vector[0] != vectors[name][0]; changed != tt.reembeds {
+					t.Errorf("%s: вектор %v → %v, ожидался пересчёт: %v", name, vectors[name], vector, tt.reembeds)
+				}
+			}
+
+			if blocks := storedBlocksByMethod(t, app, oldPath); len(blocks) != 0 {
+				t.Errorf("по прежнему пути осталось блоков %d", len(blocks))
+			}
+			states, err := app.database.GetFileStates()
+			if err != nil {
+				t.Fatalf("GetFileStates: %v", err)
+			}
+			if _, ok := states[filepath.Join("src", "a.py")]; ok || len(states) != 2 {
+				t.Errorf("состояния файлов %v, ожидались src/keep.py и library/a.py", states)
+			}
+		})
+	}
+}
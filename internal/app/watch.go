@@ -0,0 +1,284 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gokb-embedder/internal/database"
+	"gokb-embedder/internal/models"
+	"gokb-embedder/internal/scanner"
+	"gokb-embedder/internal/watcher"
+)
+
+// watchMaxHold предел, на который пачка откладывается из-за index.lock: дольше держится только забытая блокировка
+const watchMaxHold = time.Minute
+
+// Watch индексирует изменения, сделанные с прошлого запуска, и дальше следит за файлами корней,
+// переиндексируя только затронутые файлы. Работает до SIGINT или SIGTERM.
+// Блокировка записи берётся на первый проход и на каждую пачку: между пачками базу может обновить обычный запуск.
+func (r *App) Watch() error {
+	r.logger.Info("👀 Запуск режима наблюдения")
+
+	unlock, err := r.lockRun()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Инициализируем компоненты
+	if err := r.initialize(); err != nil {
+		return fmt.Errorf("ошибка инициализации: %w", err)
+	}
+	defer r.cleanup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// После первого сигнала текущая пачка дообрабатывается, повторный сигнал завершает процесс сразу
+	stopAfter := context.AfterFunc(ctx, func() {
+		stop()
+		r.logger.Info("⏳ Остановка наблюдения (повторный Ctrl+C — немедленный выход)...")
+	})
+	defer stopAfter()
+
+	// Подписка оформляется до первого прохода, чтобы не потерять правки, сделанные во время него
+	debounce := time.Duration(r.config.WatchDebounceMs) * time.Millisecond
+	w, err := r.newWatcher(debounce)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	files, err := r.scanFiles()
+	if err != nil {
+		return fmt.Errorf("ошибка сканирования файлов: %w", err)
+	}
+	if err := r.indexFiles(files); err != nil {
+		return err
+	}
+	unlock()
+
+	r.logger.Infof("👀 Наблюдение за %d директориями, пауза перед индексацией %s. Ctrl+C — выход", w.DirCount(), debounce)
+	if err := w.Run(ctx, r.batchHandler(w)); err != nil {
+		return fmt.Errorf("ошибка наблюдения за файлами: %w", err)
+	}
+
+	r.logger.Info("👋 Наблюдение остановлено")
+	return nil
+}
+
+// newWatcher подписывается на директории корней, кроме отсечённых правилами игнорирования.
+// Пока git держит index.lock (checkout, rebase, merge), пачка изменений откладывается.
+func (r *App) newWatcher(debounce time.Duration) (*watcher.Watcher, error) {
+	var roots []watcher.Root
+	var locks []string
+	for _, root := range r.roots {
+		roots = append(roots, watcher.Root{Path: root.Path, SkipDir: root.scanner.DirExcluded})
+
+		if root.gitService != nil {
+			if gitDir, err := root.gitService.GitDir(); err == nil {
+				locks = append(locks, filepath.Join(gitDir, "index.lock"))
+			}
+		}
+	}
+
+	w, err := watcher.New(roots, debounce)
+	if err != nil {
+		return nil, err
+	}
+	w.SetErrorHandler(func(err error) {
+		r.logger.Warnf("⚠️ Наблюдение: %v", err)
+	})
+
+	var holdSince time.Time
+	w.SetHold(func() bool {
+		for _, lock := range locks {
+			if _, err := os.Stat(lock); err != nil {
+				continue
+			}
+			if holdSince.IsZero() {
+				holdSince = time.Now()
+				r.logger.Info("⏳ Идёт операция git, индексация отложена до её завершения")
+			}
+			if time.Since(holdSince) < watchMaxHold {
+				return true
+			}
+			r.logger.Warnf("⚠️ %s держится дольше %s, изменения индексируются без ожидания", lock, watchMaxHold)
+		}
+		holdSince = time.Time{}
+		return false
+	})
+
+	return w, nil
+}
+
+// batchHandler возвращает обработчик пачек наблюдения: пачка индексируется под блокировкой записи,
+// а пока блокировку держит другой процесс, откладывается и выдаётся снова вместе с новыми изменениями
+func (r *App) batchHandler(w *watcher.Watcher) func(watcher.Batch) bool {
+	waiting := false
+	return func(batch watcher.Batch) bool {
+		unlock, err := r.lockRun()
+		if err != nil {
+			if !waiting {
+				var busy *database.RunInProgressError
+				if errors.As(err, &busy) {
+					r.logger.Infof("⏳ %v, индексация изменений отложена до её завершения", err)
+				} else {
+					r.logger.Errorf("❌ %v, индексация изменений отложена", err)
+				}
+			}
+			waiting = true
+			return false
+		}
+		defer unlock()
+
+		waiting = false
+		r.indexBatch(w, batch)
+		return true
+	}
+}
+
+// indexBatch переиндексирует файлы из пачки событий наблюдения
+func (r *App) indexBatch(w *watcher.Watcher, batch watcher.Batch) {
+	started := time.Now()
+
+	files, err := r.batchFiles(w, batch)
+	if err != nil {
+		r.logger.Errorf("❌ Ошибка сканирования изменений: %v", err)
+		return
+	}
+	if len(files) == 0 && !r.hasDeletedFiles() {
+		r.logger.Debug("Изменения не затрагивают индексируемые файлы")
+		return
+	}
+
+	if err := r.indexFiles(files); err != nil {
+		r.logger.Errorf("❌ Ошибка индексации изменений: %v", err)
+		return
+	}
+	r.logger.Infof("✅ Изменения проиндексированы за %s, ожидание новых...", time.Since(started).Round(time.Millisecond))
+}
+
+// batchFiles проверяет затронутые пути каждого корня по правилам сканера и отмечает удалённые.
+// При переполнении очереди событий или изменении правил игнорирования корень сканируется полностью.
+func (r *App) batchFiles(w *watcher.Watcher, batch watcher.Batch) ([]sourceFile, error) {
+	var files []sourceFile
+	for i, root := range r.roots {
+		touched := batch.Paths[i]
+		root.complete = false
+		root.deleted = nil
+		root.renames = nil
+		root.failed = nil
+		root.indexState = r.watchIndexState(root, touched)
+
+		var report *scanner.ScanReport
+		var err error
+		switch reason := rescanReason(batch, touched); {
+		case reason != "":
+			r.logger.Infof("🔍 Полная проверка %s: %s", root.Path, reason)
+			if err := root.scanner.LoadGitignore(); err != nil {
+				r.logger.Warnf("⚠️ Не удалось загрузить .gitignore корня %s: %v", root.Path, err)
+			}
+			if err := w.Sync(); err != nil {
+				r.logger.Warnf("⚠️ Наблюдение: %v", err)
+			}
+			report, err = root.scanner.Scan()
+		case len(touched) > 0:
+			report, err = root.scanner.ScanChanged(touched)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		root.complete = !report.Partial
+
+		found := make(map[string]bool, len(report.Files))
+		for _, path := range report.Files {
+			found[path] = true
+			files = append(files, sourceFile{root: root, path: path})
+		}
+
+		// Не найденные сканером пути удалены или исключены; существующие директории
+		// не удаляются: их файлы приходят собственными событиями
+		for _, path := range touched {
+			if found[path] {
+				continue
+			}
+			if info, err := os.Lstat(filepath.Join(root.Path, path)); err == nil && info.IsDir() {
+				continue
+			}
+			root.deleted = append(root.deleted, path)
+		}
+
+		r.logger.Infof("👀 %s: изменённых путей %d (к проверке %d, удалены или исключены %d)",
+			root.Path, len(touched), len(report.Files), len(root.deleted))
+	}
+	return files, nil
+}
+
+// watchIndexState возвращает состояние индексации корня для сохранения после пачки. Коммит не меняется,
+// а затронутые пути добавляются к незакоммиченным: следующий обычный запуск проверит их снова,
+// даже если правки откатят, пока наблюдение не запущено.
+func (r *App) watchIndexState(root *workspaceRoot, touched []string) *models.IndexState {
+	if root.gitService == nil || len(touched) == 0 {
+		return nil
+	}
+
+	state, err := r.database.GetIndexState(root.Name)
+	if err != nil {
+		r.logger.Warnf("⚠️ %v", err)
+		return nil
+	}
+	if state.CommitSHA == "" {
+		return nil
+	}
+	state.DirtyPaths = mergePaths(state.DirtyPaths, touched)
+	return &state
+}
+
+// rescanReason возвращает причину полной проверки корня по пачке или пустую строку
+func rescanReason(batch watcher.Batch, touched []string) string {
+	if batch.Rescan {
+		return "переполнена очередь событий файловой системы"
+	}
+	for _, path := range touched {
+		if name := filepath.Base(path); name == ".gitignore" || name == scanner.GokbIgnoreFile {
+			return "изменился " + path
+		}
+	}
+	return ""
+}
+
+// hasDeletedFiles проверяет, что хотя бы в одном корне есть удалённые пути
+func (r *App) hasDeletedFiles() bool {
+	for _, root := range r.roots {
+		if len(root.deleted) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFiles проверяет изменения файлов и создаёт эмбединги для новых и изменённых блоков
+func (r *App) indexFiles(files []sourceFile) error {
+	filesToProcess, err := r.checkFileChanges(files)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки изменений файлов: %w", err)
+	}
+
+	if len(filesToProcess) == 0 {
+		r.logger.Info("✅ Все файлы актуальны, обновление не требуется!")
+		return nil
+	}
+
+	if err := r.processFiles(filesToProcess); err != nil {
+		return fmt.Errorf("ошибка обработки файлов: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gokb-embedder/internal/database"
+	"gokb-embedder/internal/watcher"
+)
+
+func TestWatchBatches(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"a.py": "def a():\n    return 1\n",
+		"b.py": "def b():\n    return 1\n",
+	})
+
+	cfg := testConfig(t, root)
+	app := newTestApp(t, cfg)
+	embeddings := &fakeEmbedder{}
+	app.openai = embeddings
+
+	files, err := app.scanFiles()
+	if err != nil {
+		t.Fatalf("scanFiles: %v", err)
+	}
+	if err := app.indexFiles(files); err != nil {
+		t.Fatalf("indexFiles: %v", err)
+	}
+	if got := embeddings.calls.Load(); got != 2 {
+		t.Fatalf("эмбедингов при первом проходе %d, ожидалось 2", got)
+	}
+
+	w, err := app.newWatcher(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("newWatcher: %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Каждая выданная пачка и результат её обработки передаются тесту
+	type handled struct {
+		batch watcher.Batch
+		ok    bool
+	}
+	batches := make(chan handled, 10)
+	handle := app.batchHandler(w)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx, func(batch watcher.Batch) bool {
+			ok := handle(batch)
+			batches <- handled{batch, ok}
+			return ok
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next := func() handled {
+		t.Helper()
+		select {
+		case result := <-batches:
+			return result
+		case <-ctx.Done():
+			t.Fatal("пачка изменений не получена")
+		}
+		return handled{}
+	}
+
+	// Серия правок с паузами короче debounce индексируется одной пачкой
+	writeFixture(t, root, map[string]string{"a.py": "def a():\n    return 22\n"})
+	time.Sleep(30 * time.Millisecond)
+	writeFixture(t, root, map[string]string{"c.py": "def c():\n    return 1\n"})
+	time.Sleep(30 * time.Millisecond)
+	writeFixture(t, root, map[string]string{"a.py": "def a():\n    return 333\n"})
+
+	result := next()
+	if !result.ok || len(result.batch.Paths[0]) != 2 {
+		t.Fatalf("пачка %+v (обработана %v), ожидались a.py и c.py", result.batch, result.ok)
+	}
+	if got := embeddings.calls.Load(); got != 4 {
+		t.Errorf("эмбедингов после пачки %d, ожидалось 4 (новые версии a и c)", got)
+	}
+	select {
+	case extra := <-batches:
+		t.Errorf("лишняя пачка %+v", extra.batch)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Пока блокировку записи держит другой запуск, пачка откладывается и выдаётся снова
+	lock, err := database.AcquireRunLock(cfg.DBPath)
+	if err != nil {
+		t.Fatalf("AcquireRunLock: %v", err)
+	}
+	writeFixture(t, root, map[string]string{"b.py": "def b():\n    return 4444\n"})
+	if result := next(); result.ok {
+		t.Fatalf("пачка обработана под чужой блокировкой")
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	for result = next(); !result.ok; result = next() {
+	}
+	if len(result.batch.Paths[0]) != 1 || result.batch.Paths[0][0] != "b.py" {
+		t.Errorf("повторная пачка %v, ожидался b.py", result.batch.Paths[0])
+	}
+
+	states, err := app.database.GetFileStates()
+	if err != nil {
+		t.Fatalf("GetFileStates: %v", err)
+	}
+	if len(states) != 3 {
+		t.Errorf("в индексе %d файлов, ожидалось 3", len(states))
+	}
+	blocks, err := app.database.GetFileBlocks(filepath.Join(root, "b.py"))
+	if err != nil || len(blocks) != 1 || !strings.Contains(blocks[0].RawText, "4444") {
+		t.Errorf("блоки b.py %v (%v), ожидалась новая версия", blocks, err)
+	}
+}
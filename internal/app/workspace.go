@@ -0,0 +1,204 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gokb-embedder/internal/config"
+	"gokb-embedder/internal/git"
+	"gokb-embedder/internal/models"
+	"gokb-embedder/internal/scanner"
+)
+
+// workspaceRoot корень индексации со своим сканером, правилами игнорирования и историей коммитов
+type workspaceRoot struct {
+	config.Root
+	scanner    *scanner.Scanner
+	gitService *git.GitService
+
+	// indexState состояние, сохраняемое после проверки изменений (nil — корень вне Git или режим walk)
+	indexState *models.IndexState
+
+	// incremental корень проверен по git diff, а не полным сканированием
+	incremental bool
+
+	// complete список файлов корня получен полным сканированием, а не по git diff или событиям наблюдения
+	complete bool
+
+	// deleted пути относительно корня, удалённые с прошлой индексации
+	deleted []string
+
+	// renames переименования, найденные git: новый путь относительно корня → прежний
+	renames map[string]string
+
+	// failed пути относительно корня, которые не удалось прочитать при проверке изменений
+	failed []string
+}
+
+// sourceFile найденный файл корня
+type sourceFile struct {
+	root *workspaceRoot
+
+	// path путь относительно корня
+	path string
+}
+
+// fullPath возвращает путь к файлу на диске
+func (f sourceFile) fullPath() string {
+	return filepath.Join(f.root.Path, f.path)
+}
+
+// indexPath возвращает путь файла в общем индексе: с префиксом имени корня, если корней несколько
+func (f sourceFile) indexPath() string {
+	if f.root.Name == "" {
+		return f.path
+	}
+	return filepath.Join(filepath.FromSlash(f.root.Name), f.path)
+}
+
+// rootOf возвращает корень, которому принадлежит путь индекса, и путь относительно этого корня.
+// Если имена корней вложены друг в друга, выбирается корень с самым длинным именем.
+func (r *App) rootOf(indexPath string) (*workspaceRoot, string) {
+	var owner *workspaceRoot
+	var relPath string
+	for _, root := range r.roots {
+		if owner != nil && len(root.Name) <= len(owner.Name) {
+			continue
+		}
+		if root.Name == "" {
+			owner, relPath = root, indexPath
+			continue
+		}
+		prefix := filepath.FromSlash(root.Name) + string(filepath.Separator)
+		if strings.HasPrefix(indexPath, prefix) {
+			owner, relPath = root, strings.TrimPrefix(indexPath, prefix)
+		}
+	}
+	return owner, relPath
+}
+
+// initRoots создаёт сканер и Git сервис для каждого корня индексации
+func (r *App) initRoots() error {
+	roots, err := r.config.WorkspaceRoots()
+	if err != nil {
+		return fmt.Errorf("ошибка в ROOTS: %w", err)
+	}
+
+	r.roots = nil
+	for _, root := range roots {
+		if root.Name != "" {
+			r.logger.Infof("📂 Корень %s: %s %v", root.Name, root.Path, root.Extensions)
+		}
+
+		item := &workspaceRoot{Root: root}
+		item.scanner = scanner.NewScanner(root.Path, root.Extensions)
+		item.scanner.SetEventHandler(r.onScanEvent)
+
+		if err := item.scanner.SetGlobs(root.IncludeGlobs, root.ExcludeGlobs); err != nil {
+			return fmt.Errorf("ошибка в INCLUDE_GLOBS/EXCLUDE_GLOBS корня %q: %w", root.Name, err)
+		}
+		item.scanner.SetMaxFileSize(int64(r.config.MaxFileSize))
+		if err := item.scanner.SetMode(r.config.ScanMode); err != nil {
+			return fmt.Errorf("ошибка в SCAN_MODE: %w", err)
+		}
+		if err := item.scanner.SetSymlinkPolicy(r.config.SymlinkPolicy); err != nil {
+			return fmt.Errorf("ошибка в SYMLINK_POLICY: %w", err)
+		}
+
+		if err := item.scanner.LoadGitignore(); err != nil {
+			r.logger.Warnf("⚠️ Не удалось загрузить .gitignore корня %s: %v", root.Path, err)
+		}
+
+		// Инициализируем Git сервис (если корень в Git репозитории)
+		if git.IsGitRepository(root.Path) {
+			gitService, err := git.NewGitService(root.Path)
+			if err != nil {
+				r.logger.Warnf("⚠️ Не удалось инициализировать Git сервис для %s: %v", root.Path, err)
+			} else {
+				item.gitService = gitService
+			}
+		} else {
+			r.logger.Debugf("Git репозиторий не найден в %s, история коммитов не добавляется", root.Path)
+		}
+
+		r.roots = append(r.roots, item)
+	}
+
+	r.logger.Debugf("✅ Корней индексации: %d", len(r.roots))
+	return nil
+}
+
+// incremental проверяет, что хотя бы один корень проверен по git diff
+func (r *App) incremental() bool {
+	for _, root := range r.roots {
+		if root.incremental {
+			return true
+		}
+	}
+	return false
+}
+
+// allExtensions возвращает расширения всех корней без повторов
+func (r *App) allExtensions() []string {
+	seen := make(map[string]bool)
+	var extensions []string
+	for _, root := range r.roots {
+		for _, ext := range root.Extensions {
+			if !seen[ext] {
+				seen[ext] = true
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+	return extensions
+}
+
+// onScanEvent выводит события сканирования в отладочный лог
+func (r *App) onScanEvent(event scanner.ScanEvent) {
+	switch event.Type {
+	case scanner.EventSource:
+		r.logger.Debugf("📂 Источник файлов %s: %s", event.Path, event.Reason)
+	case scanner.EventExcluded:
+		r.logger.Debugf("🚫 %s исключён правилом %s", event.Path, event.Reason)
+	case scanner.EventSkipped:
+		r.logger.Debugf("⏭️ %s пропущен: %s", event.Path, event.Reason)
+	case scanner.EventPruned:
+		r.logger.Debugf("✂️ Директория %s отсечена правилом %s", event.Path, event.Reason)
+	case scanner.EventLink:
+		r.logger.Debugf("🔗 Ссылка %s: %s", event.Path, event.Reason)
+	}
+}
+
+// logScanReport выводит статистику сканирования корня
+func (r *App) logScanReport(report *scanner.ScanReport) {
+	if report.Fallback != "" {
+		r.logger.Warnf("⚠️ %s %s, используется обход файловой системы", report.RootDir, report.Fallback)
+	}
+
+	r.logger.Info("📊 Статистика сканирования:")
+	r.logger.Infof("  - Источник файлов: %s", report.Source)
+	if report.GitignoreRules > 0 {
+		r.logger.Infof("  - Gitignore правил (корень и глобальные): %d", report.GitignoreRules)
+	}
+	r.logger.Infof("  - Время сканирования: %s (список файлов %s, проверка shebang %s)",
+		report.Duration.Round(time.Millisecond), report.ListDuration.Round(time.Millisecond),
+		report.ContentDuration.Round(time.Millisecond))
+	r.logCounts(fmt.Sprintf("Отсечено директорий: %d", report.PrunedDirs), report.PrunedDirRules)
+	r.logCounts(fmt.Sprintf("Символических ссылок: %d (политика %s)", report.LinkCount(), report.SymlinkPolicy), report.Links)
+	r.logger.Infof("  - Всего файлов: %d", report.TotalFiles)
+	r.logger.Infof("  - Подходящих расширений: %d", report.MatchedFiles-report.DetectedFiles)
+	r.logger.Infof("  - Распознано по имени или shebang: %d", report.DetectedFiles)
+	r.logCounts(fmt.Sprintf("Исключено правилами: %d", report.IgnoredFiles), report.Exclusions)
+	r.logCounts(fmt.Sprintf("Пропущено по размеру: %d", report.SkippedFiles), report.Skipped)
+	r.logCounts(fmt.Sprintf("Обработано: %d", len(report.Files)), report.Extensions)
+}
+
+// logCounts выводит строку статистики и её счётчики по убыванию
+func (r *App) logCounts(title string, counts map[string]int) {
+	r.logger.Infof("  - %s", title)
+	for _, key := range scanner.SortedCounts(counts) {
+		r.logger.Infof("      • %s — %d", key, counts[key])
+	}
+}
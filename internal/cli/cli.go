@@ -3,6 +3,7 @@ package cli
 import (
 	"bufio"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -73,7 +74,7 @@ func (c *CLI) quickStart() error {
 	fmt.Println()
 
 	if c.config == nil {
-		c.config = &config.Config{}
+		c.config = config.Default()
 	}
 
 	// Запрашиваем только обязательные параметры
@@ -133,9 +134,13 @@ func (c *CLI) showMainMenu() (*config.Config, error) {
 				"🔍 Проверить настройки",
 				"📊 Статистика базы данных",
 				"📤 Экспорт базы данных в CSV",
+				"📤 Экспорт в OpenSearch/Elasticsearch",
+				"📡 Синхронизация с Qdrant",
+				"🛠️  Обслуживание базы данных",
 				"📝 Предварительная обработка файлов",
 				"🧠 Генерация эмбедингов",
 				"▶️  Полная обработка (файлы + эмбединги)",
+				"👀 Наблюдение за изменениями",
 				"❌ Выход",
 			},
 		}
@@ -175,6 +180,39 @@ func (c *CLI) showMainMenu() (*config.Config, error) {
 			if err := c.exportToCSV(); err != nil {
 				color.Red("❌ Ошибка экспорта: %v", err)
 			}
+		case "📤 Экспорт в OpenSearch/Elasticsearch":
+			if c.config == nil {
+				color.Red("❌ Сначала настройте конфигурацию!")
+				continue
+			}
+			if err := c.exportToSearch(); err != nil {
+				color.Red("❌ Ошибка экспорта: %v", err)
+			}
+		case "📡 Синхронизация с Qdrant":
+			if c.config == nil {
+				color.Red("❌ Сначала настройте конфигурацию!")
+				continue
+			}
+			if c.config.QdrantURL == "" {
+				color.Red("❌ Qdrant не настроен: укажите QDRANT_URL в .env")
+				continue
+			}
+			c.config.OperationMode = "qdrant_sync"
+			return c.config, nil
+		case "🛠️  Обслуживание базы данных":
+			if c.config == nil {
+				color.Red("❌ Сначала настройте конфигурацию!")
+				continue
+			}
+			repairPrompt := promptui.Prompt{
+				Label:     "Исправить найденные проблемы (удалить рассинхронизированные записи)",
+				IsConfirm: true,
+			}
+			c.config.OperationMode = "maintain"
+			if _, err := repairPrompt.Run(); err == nil {
+				c.config.OperationMode = "maintain_repair"
+			}
+			return c.config, nil
 		case "📝 Предварительная обработка файлов":
 			if c.config == nil {
 				color.Red("❌ Сначала настройте конфигурацию!")
@@ -196,6 +234,14 @@ func (c *CLI) showMainMenu() (*config.Config, error) {
 			}
 			c.config.OperationMode = "full"
 			return c.config, nil
+		case "👀 Наблюдение за изменениями":
+			if c.config == nil {
+				color.Red("❌ Сначала настройте конфигурацию!")
+				continue
+			}
+			color.Cyan("👀 Индекс будет обновляться при каждом сохранении файлов. Ctrl+C — возврат в меню")
+			c.config.OperationMode = "watch"
+			return c.config, nil
 		case "❌ Выход":
 			color.Yellow("👋 До свидания!")
 			c.config.OperationMode = "exit"
@@ -210,7 +256,7 @@ func (c *CLI) configureSettings() error {
 	fmt.Println()
 
 	if c.config == nil {
-		c.config = &config.Config{}
+		c.config = config.Default()
 	}
 
 	// OpenAI API Key
@@ -328,6 +374,12 @@ func (c *CLI) configureParsers() error {
 			"features":    "• Поддержка ООП (классы, интерфейсы, трейты)\n• Извлечение namespace\n• Обработка абстрактных классов\n• Поддержка анонимных функций",
 			"parser":      "php",
 		},
+		".go": {
+			"name":        "Go Parser",
+			"description": "Извлекает функции, методы, типы и группы const/var из Go файлов",
+			"features":    "• Разбор через go/ast\n• Методы с типом получателя, включая дженерики\n• Структуры, интерфейсы и остальные типы\n• Документирующие комментарии в блоках",
+			"parser":      "go",
+		},
 		".md": {
 			"name":        "Markdown Parser",
 			"description": "Обрабатывает документацию и README файлы",
@@ -406,6 +458,7 @@ func (c *CLI) configureParsers() error {
 	pythonCount := 0
 	javascriptCount := 0
 	phpCount := 0
+	goCount := 0
 	textCount := 0
 	for _, ext := range selectedExtensions {
 		if availableParsers[ext]["parser"] == "python" {
@@ -414,6 +467,8 @@ func (c *CLI) configureParsers() error {
 			javascriptCount++
 		} else if availableParsers[ext]["parser"] == "php" {
 			phpCount++
+		} else if availableParsers[ext]["parser"] == "go" {
+			goCount++
 		} else if availableParsers[ext]["parser"] == "text" {
 			textCount++
 		}
@@ -421,6 +476,7 @@ func (c *CLI) configureParsers() error {
 	fmt.Printf("   🐍 Python парсер: %d расширений\n", pythonCount)
 	fmt.Printf("   🟨 JavaScript парсер: %d расширений\n", javascriptCount)
 	fmt.Printf("   🟦 PHP парсер: %d расширений\n", phpCount)
+	fmt.Printf("   🐹 Go парсер: %d расширений\n", goCount)
 	fmt.Printf("   📝 Text парсер: %d расширений\n", textCount)
 	fmt.Printf("   📁 Всего расширений: %d\n", len(selectedExtensions))
 	fmt.Println()
@@ -461,11 +517,39 @@ func (c *CLI) showCurrentConfig() {
 
 	fmt.Printf("🔑 OpenAI API Key: %s\n", maskAPIKey(c.config.OpenAIAPIKey))
 	fmt.Printf("📁 Root Directory: %s\n", c.config.RootDir)
+	for _, root := range c.config.Roots {
+		fmt.Printf("   📂 %s: %s\n", root.Name, root.Path)
+	}
+	if c.config.ProjectName != "" {
+		fmt.Printf("📚 Project: %s\n", c.config.ProjectName)
+	}
 	fmt.Printf("💾 Database Path: %s\n", c.config.DBPath)
+	if c.config.PostgresDSN != "" {
+		fmt.Printf("🐘 PostgreSQL DSN: %s\n", maskDSN(c.config.PostgresDSN))
+	}
+	if c.config.QdrantURL != "" {
+		fmt.Printf("📡 Qdrant: %s (коллекция %s)\n", c.config.QdrantURL, c.config.QdrantCollection)
+	}
 	fmt.Printf("📚 Number of Commits: %d\n", c.config.NCommits)
 	fmt.Printf("🔢 Token Limit: %d\n", c.config.TokenLimit)
+	fmt.Printf("📏 Max File Size: %d\n", c.config.MaxFileSize)
+	fmt.Printf("📂 Scan Mode: %s\n", c.config.ScanMode)
+	fmt.Printf("🔗 Symlink Policy: %s\n", c.config.SymlinkPolicy)
+	fmt.Printf("⚙️ Scan Workers: %d\n", c.config.ScanWorkers)
+	fmt.Printf("🚚 Rename Embeddings: %s\n", c.config.RenameEmbeddings)
+	fmt.Printf("👀 Watch Debounce: %d ms\n", c.config.WatchDebounceMs)
 	fmt.Printf("📊 Log Level: %s\n", c.config.LogLevel)
 	fmt.Printf("📝 File Extensions: %s\n", strings.Join(c.config.FileExtensions, ", "))
+	if len(c.config.IncludeGlobs) > 0 {
+		fmt.Printf("✅ Include Globs: %s\n", strings.Join(c.config.IncludeGlobs, ", "))
+	}
+	if len(c.config.ExcludeGlobs) > 0 {
+		fmt.Printf("🚫 Exclude Globs: %s\n", strings.Join(c.config.ExcludeGlobs, ", "))
+	}
+	fmt.Printf("🏷️ Detect File Types: %t\n", c.config.DetectFileTypes)
+	if len(c.config.FileTypes) > 0 {
+		fmt.Printf("🏷️ File Types: %s\n", strings.Join(c.config.FileTypes, ", "))
+	}
 
 	// Показываем статистику парсеров
 	if len(c.config.FileExtensions) > 0 {
@@ -474,6 +558,7 @@ func (c *CLI) showCurrentConfig() {
 		pythonCount := 0
 		javascriptCount := 0
 		phpCount := 0
+		goCount := 0
 		textCount := 0
 		for _, ext := range c.config.FileExtensions {
 			if ext == ".py" {
@@ -482,6 +567,8 @@ func (c *CLI) showCurrentConfig() {
 				javascriptCount++
 			} else if ext == ".php" {
 				phpCount++
+			} else if ext == ".go" {
+				goCount++
 			} else {
 				textCount++
 			}
@@ -489,6 +576,7 @@ func (c *CLI) showCurrentConfig() {
 		fmt.Printf("   🐍 Python парсер: %d расширений\n", pythonCount)
 		fmt.Printf("   🟨 JavaScript парсер: %d расширений\n", javascriptCount)
 		fmt.Printf("   🟦 PHP парсер: %d расширений\n", phpCount)
+		fmt.Printf("   🐹 Go парсер: %d расширений\n", goCount)
 		fmt.Printf("   📝 Text парсер: %d расширений\n", textCount)
 	}
 	fmt.Println()
@@ -547,9 +635,42 @@ func (c *CLI) saveToEnv() error {
 	fmt.Fprintf(writer, "# Корневая директория для поиска файлов\n")
 	fmt.Fprintf(writer, "ROOT_DIR=%s\n\n", c.config.RootDir)
 
+	if len(c.config.Roots) > 0 {
+		var roots []string
+		for _, root := range c.config.Roots {
+			roots = append(roots, root.Name+"="+root.Path)
+		}
+		fmt.Fprintf(writer, "# Корни индексации (имя=путь относительно ROOT_DIR, через запятую)\n")
+		fmt.Fprintf(writer, "ROOTS=%s\n", strings.Join(roots, ","))
+		for _, root := range c.config.Roots {
+			prefix := config.RootEnvPrefix(root.Name)
+			if len(root.Extensions) > 0 {
+				fmt.Fprintf(writer, "%sEXTENSIONS=%s\n", prefix, strings.Join(root.Extensions, ","))
+			}
+			if len(root.IncludeGlobs) > 0 {
+				fmt.Fprintf(writer, "%sINCLUDE_GLOBS=%s\n", prefix, strings.Join(root.IncludeGlobs, ","))
+			}
+			if len(root.ExcludeGlobs) > 0 {
+				fmt.Fprintf(writer, "%sEXCLUDE_GLOBS=%s\n", prefix, strings.Join(root.ExcludeGlobs, ","))
+			}
+		}
+		fmt.Fprintf(writer, "\n")
+	}
+
+	if c.config.ProjectName != "" {
+		fmt.Fprintf(writer, "# Имя проекта в общей базе (по умолчанию имя корневой директории)\n")
+		fmt.Fprintf(writer, "PROJECT_NAME=%s\n\n", c.config.ProjectName)
+	}
+
 	fmt.Fprintf(writer, "# Расширения файлов для обработки (через запятую)\n")
 	fmt.Fprintf(writer, "FILE_EXTENSIONS=%s\n\n", strings.Join(c.config.FileExtensions, ","))
 
+	if len(c.config.IncludeGlobs) > 0 || len(c.config.ExcludeGlobs) > 0 {
+		fmt.Fprintf(writer, "# Шаблоны путей doublestar (через запятую): индексировать только / исключить\n")
+		fmt.Fprintf(writer, "INCLUDE_GLOBS=%s\n", strings.Join(c.config.IncludeGlobs, ","))
+		fmt.Fprintf(writer, "EXCLUDE_GLOBS=%s\n\n", strings.Join(c.config.ExcludeGlobs, ","))
+	}
+
 	fmt.Fprintf(writer, "# Путь к файлу базы данных\n")
 	fmt.Fprintf(writer, "DB_PATH=%s\n\n", c.config.DBPath)
 
@@ -559,9 +680,65 @@ func (c *CLI) saveToEnv() error {
 	fmt.Fprintf(writer, "# Лимит токенов на блок для текстовых файлов\n")
 	fmt.Fprintf(writer, "TOKEN_LIMIT=%d\n\n", c.config.TokenLimit)
 
+	fmt.Fprintf(writer, "# Максимальный размер файла в байтах (0 — без ограничения)\n")
+	fmt.Fprintf(writer, "MAX_FILE_SIZE=%d\n\n", c.config.MaxFileSize)
+
+	fmt.Fprintf(writer, "# Источник списка файлов: git (git ls-files) или walk (обход файловой системы)\n")
+	fmt.Fprintf(writer, "SCAN_MODE=%s\n\n", c.config.ScanMode)
+
+	fmt.Fprintf(writer, "# Символические ссылки: ignore, inside-root (цель внутри ROOT_DIR) или follow\n")
+	fmt.Fprintf(writer, "SYMLINK_POLICY=%s\n\n", c.config.SymlinkPolicy)
+
+	fmt.Fprintf(writer, "# Количество воркеров чтения и парсинга файлов (0 — по числу ядер)\n")
+	fmt.Fprintf(writer, "SCAN_WORKERS=%d\n\n", c.config.ScanWorkers)
+
+	fmt.Fprintf(writer, "# Векторы блоков переименованных файлов: keep (сохранить) или reembed (пересчитать)\n")
+	fmt.Fprintf(writer, "RENAME_EMBEDDINGS=%s\n\n", c.config.RenameEmbeddings)
+
+	fmt.Fprintf(writer, "# Пауза в событиях файлов (мс), после которой режим наблюдения индексирует изменения\n")
+	fmt.Fprintf(writer, "WATCH_DEBOUNCE_MS=%d\n\n", c.config.WatchDebounceMs)
+
+	fmt.Fprintf(writer, "# Встроенные правила для файлов без расширения (Dockerfile, Makefile, shebang) выбранных языков\n")
+	fmt.Fprintf(writer, "DETECT_FILE_TYPES=%t\n\n", c.config.DetectFileTypes)
+
+	if len(c.config.FileTypes) > 0 {
+		fmt.Fprintf(writer, "# Определение типа файла без расширения: имя, шаблон или #!интерпретатор=парсер\n")
+		fmt.Fprintf(writer, "FILE_TYPES=%s\n\n", strings.Join(c.config.FileTypes, ","))
+	}
+
 	fmt.Fprintf(writer, "# Уровень логирования (debug, info, warn, error)\n")
 	fmt.Fprintf(writer, "LOG_LEVEL=%s\n", c.config.LogLevel)
 
+	if c.config.QdrantURL != "" {
+		fmt.Fprintf(writer, "\n# Qdrant для отправки эмбедингов\n")
+		fmt.Fprintf(writer, "QDRANT_URL=%s\n", c.config.QdrantURL)
+		if c.config.QdrantAPIKey != "" {
+			fmt.Fprintf(writer, "QDRANT_API_KEY=%s\n", c.config.QdrantAPIKey)
+		}
+		fmt.Fprintf(writer, "QDRANT_COLLECTION=%s\n", c.config.QdrantCollection)
+		fmt.Fprintf(writer, "QDRANT_DISTANCE=%s\n", c.config.QdrantDistance)
+	}
+
+	if c.config.SearchURL != "" {
+		fmt.Fprintf(writer, "\n# OpenSearch/Elasticsearch для экспорта эмбедингов\n")
+		fmt.Fprintf(writer, "SEARCH_URL=%s\n", c.config.SearchURL)
+		fmt.Fprintf(writer, "SEARCH_INDEX=%s\n", c.config.SearchIndex)
+		fmt.Fprintf(writer, "SEARCH_FLAVOR=%s\n", c.config.SearchFlavor)
+		if c.config.SearchUsername != "" {
+			fmt.Fprintf(writer, "SEARCH_USERNAME=%s\n", c.config.SearchUsername)
+			fmt.Fprintf(writer, "SEARCH_PASSWORD=%s\n", c.config.SearchPassword)
+		}
+		fmt.Fprintf(writer, "SEARCH_CHUNK_SIZE=%d\n", c.config.SearchChunkSize)
+	}
+
+	if c.config.PostgresDSN != "" {
+		fmt.Fprintf(writer, "\n# Подключение к PostgreSQL с pgvector (вместо SQLite)\n")
+		fmt.Fprintf(writer, "POSTGRES_DSN=%s\n", c.config.PostgresDSN)
+		if c.config.EmbeddingDimensions > 0 {
+			fmt.Fprintf(writer, "EMBEDDING_DIMENSIONS=%d\n", c.config.EmbeddingDimensions)
+		}
+	}
+
 	return writer.Flush()
 }
 
@@ -573,13 +750,24 @@ func maskAPIKey(apiKey string) string {
 	return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
 }
 
+// maskDSN скрывает пароль в строке подключения
+func maskDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "***")
+			return u.String()
+		}
+	}
+	return dsn
+}
+
 // exportToCSV экспортирует базу данных в CSV файл
 func (c *CLI) exportToCSV() error {
 	color.Cyan("📤 Экспорт базы данных в CSV")
 	fmt.Println()
 
-	// Проверяем существование базы данных
-	if _, err := os.Stat(c.config.DBPath); os.IsNotExist(err) {
+	// Проверяем существование базы данных (для SQLite)
+	if _, err := os.Stat(c.config.DBPath); c.config.PostgresDSN == "" && os.IsNotExist(err) {
 		color.Red("❌ База данных не найдена: %s", c.config.DBPath)
 		color.Yellow("💡 Сначала создайте базу данных, запустив обработку файлов")
 		fmt.Println()
@@ -643,3 +831,64 @@ func (c *CLI) exportToCSV() error {
 
 	return nil
 }
+
+// exportToSearch экспортирует эмбединги в NDJSON для _bulk и при необходимости отправляет их в индекс
+func (c *CLI) exportToSearch() error {
+	color.Cyan("📤 Экспорт в OpenSearch/Elasticsearch")
+	fmt.Println()
+
+	if _, err := os.Stat(c.config.DBPath); c.config.PostgresDSN == "" && os.IsNotExist(err) {
+		color.Red("❌ База данных не найдена: %s", c.config.DBPath)
+		color.Yellow("💡 Сначала создайте базу данных, запустив обработку файлов")
+		fmt.Println()
+		return nil
+	}
+
+	color.Yellow("📁 Путь для сохранения NDJSON файла")
+	prompt := promptui.Prompt{
+		Label:   "Введите путь к файлу",
+		Default: "embeddings_bulk.ndjson",
+	}
+	outputPath, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	app := app.New(c.config)
+	if err := app.InitializeDatabase(); err != nil {
+		return fmt.Errorf("ошибка инициализации базы данных: %w", err)
+	}
+
+	color.Yellow("📤 Выполняется экспорт...")
+	if err := app.ExportBulkNDJSON(outputPath); err != nil {
+		return err
+	}
+	color.Green("✅ Экспорт завершён успешно!")
+	fmt.Println()
+
+	if c.config.SearchURL == "" {
+		color.Cyan("💡 Укажите SEARCH_URL в .env, чтобы отправлять данные в индекс напрямую")
+		fmt.Println()
+		return nil
+	}
+
+	confirmPrompt := promptui.Select{
+		Label: fmt.Sprintf("Отправить данные в %s (индекс %s)?", c.config.SearchURL, c.config.SearchIndex),
+		Items: []string{"✅ Да, отправить", "❌ Нет"},
+	}
+	_, result, err := confirmPrompt.Run()
+	if err != nil {
+		return err
+	}
+	if strings.Contains(result, "Нет") {
+		return nil
+	}
+
+	color.Yellow("📡 Выполняется отправка...")
+	if err := app.PushToSearch(); err != nil {
+		return err
+	}
+	color.Green("✅ Данные отправлены!")
+	fmt.Println()
+	return nil
+}
@@ -14,11 +14,70 @@ type Config struct {
 	OpenAIAPIKey string
 
 	// Настройки проекта
+	ProjectName    string // Имя проекта в общей базе (по умолчанию — имя корневой директории)
 	RootDir        string
 	FileExtensions []string
 	DBPath         string
-	NCommits       int
-	TokenLimit     int
+
+	// Корни индексации (ROOTS): если заданы, сканируются они, а ROOT_DIR служит базой для относительных путей корней
+	Roots []Root
+
+	// Шаблоны doublestar относительно ROOT_DIR: INCLUDE_GLOBS ограничивает сканирование, EXCLUDE_GLOBS исключает
+	IncludeGlobs []string
+	ExcludeGlobs []string
+
+	// Файлы больше MaxFileSize байт не индексируются (0 — без ограничения)
+	MaxFileSize int
+
+	// Источник списка файлов: "git" (git ls-files, вне репозитория — обход) или "walk" (обход файловой системы)
+	ScanMode string
+
+	// Дополнительные правила распознавания файлов без расширения (FILE_TYPES): "правило=язык",
+	// правило — точное имя файла, шаблон имени или "#!интерпретатор", язык — имя парсера
+	FileTypes []string
+
+	// Встроенные правила распознавания файлов без расширения (Dockerfile, Makefile, shebang) — DETECT_FILE_TYPES.
+	// Применяются только для языков, парсеры которых включены выбранными расширениями
+	DetectFileTypes bool
+
+	// Количество воркеров чтения, хеширования и парсинга файлов (0 — по числу ядер)
+	ScanWorkers int
+
+	// Rehash отключает быструю проверку по size/mtime/inode: содержимое всех файлов читается и хешируется
+	Rehash bool
+
+	// Эмбединги блоков переименованных и перемещённых файлов: "keep" (сохранить векторы) или "reembed" (пересчитать)
+	RenameEmbeddings string
+
+	// Пауза в событиях файловой системы в миллисекундах, после которой режим наблюдения переиндексирует изменения
+	WatchDebounceMs int
+
+	// Обработка символических ссылок: "ignore", "inside-root" (цель внутри ROOT_DIR) или "follow"
+	SymlinkPolicy string
+
+	NCommits   int
+	TokenLimit int
+
+	// Настройки хранилища: если задан PostgresDSN, вместо SQLite используется PostgreSQL с pgvector
+	PostgresDSN         string
+	EmbeddingDimensions int
+
+	// Снимок индекса (метка или SHA коммита), из которого читают экспорт и статистика; пусто — текущий индекс
+	Snapshot string
+
+	// Настройки Qdrant: если задан QdrantURL, эмбединги дополнительно отправляются в коллекцию
+	QdrantURL        string
+	QdrantAPIKey     string
+	QdrantCollection string
+	QdrantDistance   string
+
+	// Настройки экспорта в OpenSearch/Elasticsearch
+	SearchURL       string
+	SearchIndex     string
+	SearchFlavor    string
+	SearchUsername  string
+	SearchPassword  string
+	SearchChunkSize int
 
 	// Настройки логирования
 	LogLevel string
@@ -27,6 +86,33 @@ type Config struct {
 	OperationMode string
 }
 
+// Default возвращает конфигурацию со значениями по умолчанию (без ключа OpenAI)
+func Default() *Config {
+	return &Config{
+		RootDir:        ".",
+		FileExtensions: []string{".py", ".js", ".php", ".md", ".yml", ".conf"},
+		DBPath:         "embeddings.sqlite3",
+		NCommits:       3,
+		TokenLimit:     1600,
+		MaxFileSize:    1 << 20,
+		ScanMode:       "git",
+		SymlinkPolicy:  "inside-root",
+		LogLevel:       "info",
+
+		RenameEmbeddings: "keep",
+		WatchDebounceMs:  1000,
+
+		EmbeddingDimensions: 1536,
+
+		QdrantCollection: "gokb",
+		QdrantDistance:   "Cosine",
+
+		SearchIndex:     "gokb",
+		SearchFlavor:    "opensearch",
+		SearchChunkSize: 500,
+	}
+}
+
 // Load загружает конфигурацию из .env файла и переменных окружения
 func Load() (*Config, error) {
 	// Загружаем .env файл если он существует
@@ -42,23 +128,44 @@ func Load() (*Config, error) {
 		return nil, ErrMissingOpenAIKey
 	}
 
-	rootDir := getEnv("ROOT_DIR", ".")
-	fileExtensionsStr := getEnv("FILE_EXTENSIONS", ".py,.js,.php,.md,.yml,.conf")
-	fileExtensions := parseFileExtensions(fileExtensionsStr)
-	dbPath := getEnv("DB_PATH", "embeddings.sqlite3")
-	nCommits := getEnvAsInt("N_COMMITS", 3)
-	tokenLimit := getEnvAsInt("TOKEN_LIMIT", 1600)
-	logLevel := getEnv("LOG_LEVEL", "info")
+	cfg := Default()
+	cfg.OpenAIAPIKey = openAIKey
+	cfg.RootDir = getEnv("ROOT_DIR", cfg.RootDir)
+	cfg.ProjectName = getEnv("PROJECT_NAME", "")
+	cfg.FileExtensions = parseFileExtensions(getEnv("FILE_EXTENSIONS", ""))
+	cfg.IncludeGlobs = parseList(getEnv("INCLUDE_GLOBS", ""))
+	cfg.ExcludeGlobs = parseList(getEnv("EXCLUDE_GLOBS", ""))
+	cfg.Roots = parseRoots(getEnv("ROOTS", ""))
+	cfg.MaxFileSize = getEnvAsInt("MAX_FILE_SIZE", cfg.MaxFileSize)
+	cfg.ScanMode = getEnv("SCAN_MODE", cfg.ScanMode)
+	cfg.SymlinkPolicy = getEnv("SYMLINK_POLICY", cfg.SymlinkPolicy)
+	cfg.ScanWorkers = getEnvAsInt("SCAN_WORKERS", cfg.ScanWorkers)
+	cfg.FileTypes = parseList(getEnv("FILE_TYPES", ""))
+	cfg.DetectFileTypes = getEnvAsBool("DETECT_FILE_TYPES", cfg.DetectFileTypes)
+	cfg.WatchDebounceMs = getEnvAsInt("WATCH_DEBOUNCE_MS", cfg.WatchDebounceMs)
+	cfg.RenameEmbeddings = getEnv("RENAME_EMBEDDINGS", cfg.RenameEmbeddings)
+	cfg.DBPath = getEnv("DB_PATH", cfg.DBPath)
+	cfg.NCommits = getEnvAsInt("N_COMMITS", cfg.NCommits)
+	cfg.TokenLimit = getEnvAsInt("TOKEN_LIMIT", cfg.TokenLimit)
+	cfg.LogLevel = getEnv("LOG_LEVEL", cfg.LogLevel)
 
-	return &Config{
-		OpenAIAPIKey:   openAIKey,
-		RootDir:        rootDir,
-		FileExtensions: fileExtensions,
-		DBPath:         dbPath,
-		NCommits:       nCommits,
-		TokenLimit:     tokenLimit,
-		LogLevel:       logLevel,
-	}, nil
+	cfg.PostgresDSN = getEnv("POSTGRES_DSN", "")
+	cfg.EmbeddingDimensions = getEnvAsInt("EMBEDDING_DIMENSIONS", cfg.EmbeddingDimensions)
+	cfg.Snapshot = getEnv("SNAPSHOT", "")
+
+	cfg.QdrantURL = getEnv("QDRANT_URL", "")
+	cfg.QdrantAPIKey = getEnv("QDRANT_API_KEY", "")
+	cfg.QdrantCollection = getEnv("QDRANT_COLLECTION", cfg.QdrantCollection)
+	cfg.QdrantDistance = getEnv("QDRANT_DISTANCE", cfg.QdrantDistance)
+
+	cfg.SearchURL = getEnv("SEARCH_URL", "")
+	cfg.SearchIndex = getEnv("SEARCH_INDEX", cfg.SearchIndex)
+	cfg.SearchFlavor = getEnv("SEARCH_FLAVOR", cfg.SearchFlavor)
+	cfg.SearchUsername = getEnv("SEARCH_USERNAME", "")
+	cfg.SearchPassword = getEnv("SEARCH_PASSWORD", "")
+	cfg.SearchChunkSize = getEnvAsInt("SEARCH_CHUNK_SIZE", cfg.SearchChunkSize)
+
+	return cfg, nil
 }
 
 // getEnv получает значение переменной окружения или возвращает значение по умолчанию
@@ -79,6 +186,17 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool получает логическое значение переменной окружения (true, 1, yes)
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		return strings.EqualFold(value, "yes")
+	}
+	return defaultValue
+}
+
 // parseFileExtensions парсит строку расширений файлов в слайс
 func parseFileExtensions(extensions string) []string {
 	if extensions == "" {
@@ -96,3 +214,14 @@ func parseFileExtensions(extensions string) []string {
 	}
 	return result
 }
+
+// parseList парсит список значений через запятую (пустые элементы отбрасываются)
+func parseList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Root корень индексации: имя служит префиксом относительных путей в общем индексе,
+// пустые расширения и шаблоны наследуются из общих настроек
+type Root struct {
+	Name         string
+	Path         string
+	Extensions   []string
+	IncludeGlobs []string
+	ExcludeGlobs []string
+}
+
+// parseRoots парсит ROOTS вида "services=services/*,docs=../docs" и читает для каждого корня
+// ROOT_<ИМЯ>_EXTENSIONS, ROOT_<ИМЯ>_INCLUDE_GLOBS и ROOT_<ИМЯ>_EXCLUDE_GLOBS
+func parseRoots(value string) []Root {
+	var roots []Root
+	for _, item := range parseList(value) {
+		name, path, found := strings.Cut(item, "=")
+		if !found {
+			path = name
+			name = filepath.Base(filepath.Clean(path))
+		}
+
+		root := Root{Name: strings.TrimSpace(name), Path: strings.TrimSpace(path)}
+		prefix := RootEnvPrefix(root.Name)
+		if extensions := getEnv(prefix+"EXTENSIONS", ""); extensions != "" {
+			root.Extensions = parseFileExtensions(extensions)
+		}
+		root.IncludeGlobs = parseList(getEnv(prefix+"INCLUDE_GLOBS", ""))
+		root.ExcludeGlobs = parseList(getEnv(prefix+"EXCLUDE_GLOBS", ""))
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// RootEnvPrefix возвращает префикс переменных окружения корня: ROOT_<ИМЯ>_ в верхнем регистре,
+// символы кроме букв и цифр заменяются на "_"
+func RootEnvPrefix(name string) string {
+	key := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+	return "ROOT_" + key + "_"
+}
+
+// WorkspaceRoots возвращает корни индексации с заполненными настройками по умолчанию.
+// Без ROOTS единственный корень — ROOT_DIR без префикса путей. Относительные пути корней
+// считаются от ROOT_DIR, а путь с шаблоном (services/*) раскрывается в корень на каждую директорию
+// с именем "<имя>/<директория>".
+func (c *Config) WorkspaceRoots() ([]Root, error) {
+	if len(c.Roots) == 0 {
+		return []Root{{
+			Path:         c.RootDir,
+			Extensions:   c.FileExtensions,
+			IncludeGlobs: c.IncludeGlobs,
+			ExcludeGlobs: c.ExcludeGlobs,
+		}}, nil
+	}
+
+	var roots []Root
+	names := make(map[string]bool)
+	for _, root := range c.Roots {
+		if root.Name == "" || root.Path == "" {
+			return nil, fmt.Errorf("корень %q: имя и путь обязательны", root.Name)
+		}
+		if len(root.Extensions) == 0 {
+			root.Extensions = c.FileExtensions
+		}
+		if len(root.IncludeGlobs) == 0 {
+			root.IncludeGlobs = c.IncludeGlobs
+		}
+		if len(root.ExcludeGlobs) == 0 {
+			root.ExcludeGlobs = c.ExcludeGlobs
+		}
+
+		path := root.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.RootDir, path)
+		}
+
+		expanded, err := expandRoot(root, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range expanded {
+			if names[item.Name] {
+				return nil, fmt.Errorf("корень %q указан несколько раз", item.Name)
+			}
+			names[item.Name] = true
+			roots = append(roots, item)
+		}
+	}
+
+	return roots, nil
+}
+
+// expandRoot раскрывает шаблон пути корня в директории; путь без шаблона должен существовать
+func expandRoot(root Root, path string) ([]Root, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("корень %q: %w", root.Name, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("корень %q: %s не является директорией", root.Name, path)
+		}
+		root.Path = path
+		return []Root{root}, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("корень %q: некорректный шаблон %s: %w", root.Name, path, err)
+	}
+	sort.Strings(matches)
+
+	var roots []Root
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || !info.IsDir() {
+			continue
+		}
+		item := root
+		item.Name = root.Name + "/" + filepath.Base(match)
+		item.Path = match
+		roots = append(roots, item)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("корень %q: шаблон %s не совпал ни с одной директорией", root.Name, path)
+	}
+	return roots, nil
+}
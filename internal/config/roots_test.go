@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRoots(t *testing.T) {
+	t.Setenv("ROOT_SERVICES_EXTENSIONS", ".go,.proto")
+	t.Setenv("ROOT_PLATFORM_DOCS_EXCLUDE_GLOBS", "drafts/**")
+
+	roots := parseRoots("services=services/*, platform-docs=../docs, libs")
+	if len(roots) != 3 {
+		t.Fatalf("parseRoots = %+v, ожидалось 3 корня", roots)
+	}
+
+	tests := []struct {
+		root    Root
+		name    string
+		path    string
+		exts    string
+		exclude string
+	}{
+		{roots[0], "services", "services/*", ".go,.proto", ""},
+		{roots[1], "platform-docs", "../docs", "", "drafts/**"},
+		{roots[2], "libs", "libs", "", ""},
+	}
+	for _, tt := range tests {
+		if tt.root.Name != tt.name || tt.root.Path != tt.path {
+			t.Errorf("корень = %s=%s, ожидалось %s=%s", tt.root.Name, tt.root.Path, tt.name, tt.path)
+		}
+		if got := strings.Join(tt.root.Extensions, ","); got != tt.exts {
+			t.Errorf("%s: расширения %q, ожидалось %q", tt.name, got, tt.exts)
+		}
+		if got := strings.Join(tt.root.ExcludeGlobs, ","); got != tt.exclude {
+			t.Errorf("%s: EXCLUDE_GLOBS %q, ожидалось %q", tt.name, got, tt.exclude)
+		}
+	}
+}
+
+func TestWorkspaceRoots(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"repo/services/api", "repo/services/billing", "docs"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(base, "repo", "services", "README.md"), []byte("x"), 0o644)
+
+	cfg := Default()
+	cfg.RootDir = filepath.Join(base, "repo")
+	cfg.ExcludeGlobs = []string{"**/testdata/**"}
+	cfg.Roots = []Root{
+		{Name: "services", Path: "services/*", Extensions: []string{".go"}},
+		{Name: "docs", Path: filepath.Join("..", "docs")},
+	}
+
+	roots, err := cfg.WorkspaceRoots()
+	if err != nil {
+		t.Fatalf("WorkspaceRoots: %v", err)
+	}
+
+	var names []string
+	for _, root := range roots {
+		names = append(names, root.Name)
+	}
+	if strings.Join(names, ",") != "services/api,services/billing,docs" {
+		t.Errorf("корни = %v", names)
+	}
+	if roots[0].Path != filepath.Join(base, "repo", "services", "api") {
+		t.Errorf("путь services/api = %s", roots[0].Path)
+	}
+	if strings.Join(roots[2].Extensions, ",") != strings.Join(cfg.FileExtensions, ",") {
+		t.Errorf("docs должен наследовать FILE_EXTENSIONS, получено %v", roots[2].Extensions)
+	}
+	if len(roots[0].ExcludeGlobs) != 1 {
+		t.Errorf("services/api должен наследовать EXCLUDE_GLOBS, получено %v", roots[0].ExcludeGlobs)
+	}
+
+	// Без ROOTS единственный корень — ROOT_DIR без имени
+	cfg.Roots = nil
+	roots, err = cfg.WorkspaceRoots()
+	if err != nil || len(roots) != 1 || roots[0].Name != "" || roots[0].Path != cfg.RootDir {
+		t.Errorf("WorkspaceRoots без ROOTS = %+v, %v", roots, err)
+	}
+
+	errorCases := [][]Root{
+		{{Name: "missing", Path: "nowhere"}},
+		{{Name: "empty", Path: "nothing/*"}},
+		{{Name: "dup", Path: "services"}, {Name: "dup", Path: "services"}},
+	}
+	for _, roots := range errorCases {
+		cfg.Roots = roots
+		if _, err := cfg.WorkspaceRoots(); err == nil {
+			t.Errorf("ожидалась ошибка для %+v", roots)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import "gokb-embedder/internal/models"
+
+// StoredBlock блок текущего индекса вместе с его ID в таблице embeddings
+type StoredBlock struct {
+	ID int64
+	*models.CodeBlock
+}
+
+// BlockDiff результат сопоставления блоков изменённого файла с сохранёнными блоками этого файла
+type BlockDiff struct {
+	// Reused блоки, не изменившиеся ни по тексту, ни по положению, ни по номеру среди одноимённых
+	Reused []StoredBlock
+
+	// Moved блоки с тем же телом на новом месте: ID сохранённой строки и новый блок.
+	// Строки обновляются на месте, вектор остаётся прежним.
+	Moved []StoredBlock
+
+	// Changed сохранённые версии символов, тело которых изменилось
+	Changed []StoredBlock
+
+	// Removed сохранённые блоки, символов которых больше нет в файле
+	Removed []StoredBlock
+
+	// Added новые блоки и новые версии изменённых символов: только им нужен эмбединг
+	Added []*models.CodeBlock
+}
+
+// Stale возвращает сохранённые блоки, которые нужно удалить из текущего индекса
+func (d BlockDiff) Stale() []StoredBlock {
+	return append(append([]StoredBlock(nil), d.Changed...), d.Removed...)
+}
+
+// DiffBlocks сопоставляет разобранные блоки файла с сохранёнными.
+// Сначала блоки сопоставляются по пути символа и хешу тела (неизменённые и сдвинутые),
+// затем оставшиеся — только по пути символа (изменённые). Одинаковые ключи сопоставляются по порядку.
+func DiffBlocks(stored []StoredBlock, parsed []*models.CodeBlock) BlockDiff {
+	type blockKey struct {
+		symbol string
+		body   string
+	}
+
+	var diff BlockDiff
+	used := make([]bool, len(stored))
+
+	byBody := make(map[blockKey][]int)
+	for i, block := range stored {
+		key := blockKey{block.SymbolPath(), block.BodyHash()}
+		byBody[key] = append(byBody[key], i)
+	}
+
+	var pending []*models.CodeBlock
+	for _, block := range parsed {
+		key := blockKey{block.SymbolPath(), block.BodyHash()}
+		candidates := byBody[key]
+		if len(candidates) == 0 {
+			pending = append(pending, block)
+			continue
+		}
+
+		i := candidates[0]
+		byBody[key] = candidates[1:]
+		used[i] = true
+
+		old := stored[i]
+		if old.StartLine == block.StartLine && old.EndLine == block.EndLine && old.Ordinal == block.Ordinal &&
+			old.ContentHash() == block.ContentHash() {
+			diff.Reused = append(diff.Reused, old)
+		} else {
+			diff.Moved = append(diff.Moved, StoredBlock{ID: old.ID, CodeBlock: block})
+		}
+	}
+
+	// Тот же символ с другим телом — изменённый блок: старая версия удаляется, новая эмбедится
+	bySymbol := make(map[string][]int)
+	for i, block := range stored {
+		if !used[i] {
+			bySymbol[block.SymbolPath()] = append(bySymbol[block.SymbolPath()], i)
+		}
+	}
+
+	for _, block := range pending {
+		if candidates := bySymbol[block.SymbolPath()]; len(candidates) > 0 {
+			i := candidates[0]
+			bySymbol[block.SymbolPath()] = candidates[1:]
+			used[i] = true
+			diff.Changed = append(diff.Changed, stored[i])
+		}
+		diff.Added = append(diff.Added, block)
+	}
+
+	for i, block := range stored {
+		if !used[i] {
+			diff.Removed = append(diff.Removed, block)
+		}
+	}
+
+	return diff
+}
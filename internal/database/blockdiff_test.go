@@ -0,0 +1,80 @@
+package database
+
+import (
+	"testing"
+
+	"gokb-embedder/internal/models"
+)
+
+func diffBlock(method string, start, end int, text string) *models.CodeBlock {
+	return models.NewCodeBlock("/src/app.py", "method", nil, &method, start, end, text)
+}
+
+func TestDiffBlocks(t *testing.T) {
+	stored := []StoredBlock{
+		{ID: 1, CodeBlock: diffBlock("keep", 1, 3, "def keep(): pass")},
+		{ID: 2, CodeBlock: diffBlock("shift", 5, 7, "def shift(): pass")},
+		{ID: 3, CodeBlock: diffBlock("edit", 9, 11, "def edit(): return 1")},
+		{ID: 4, CodeBlock: diffBlock("gone", 13, 15, "def gone(): pass")},
+	}
+	parsed := []*models.CodeBlock{
+		diffBlock("keep", 1, 3, "def keep(): pass"),
+		diffBlock("fresh", 5, 6, "def fresh(): pass"),
+		diffBlock("shift", 8, 10, "def shift(): pass"),
+		diffBlock("edit", 12, 14, "def edit(): return 2"),
+	}
+
+	diff := DiffBlocks(stored, parsed)
+
+	if len(diff.Reused) != 1 || diff.Reused[0].ID != 1 {
+		t.Errorf("Reused = %v, ожидался блок 1", diff.Reused)
+	}
+	if len(diff.Moved) != 1 || diff.Moved[0].ID != 2 || diff.Moved[0].StartLine != 8 {
+		t.Errorf("Moved = %v, ожидался блок 2 на строке 8", diff.Moved)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].ID != 3 {
+		t.Errorf("Changed = %v, ожидался блок 3", diff.Changed)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != 4 {
+		t.Errorf("Removed = %v, ожидался блок 4", diff.Removed)
+	}
+	if len(diff.Added) != 2 || *diff.Added[0].MethodName != "fresh" || *diff.Added[1].MethodName != "edit" {
+		t.Errorf("Added = %v, ожидались fresh и новая версия edit", diff.Added)
+	}
+	if len(diff.Stale()) != 2 {
+		t.Errorf("Stale = %v, ожидались изменённый и удалённый блоки", diff.Stale())
+	}
+}
+
+func TestDiffBlocksReindentedBody(t *testing.T) {
+	// Нормализованное тело совпадает, текст отличается отступом: блок сдвинут, вектор сохраняется
+	stored := []StoredBlock{{ID: 1, CodeBlock: diffBlock("run", 1, 2, "def run():\n    pass")}}
+	parsed := []*models.CodeBlock{diffBlock("run", 1, 2, "    def run():\n        pass")}
+
+	diff := DiffBlocks(stored, parsed)
+	if len(diff.Moved) != 1 || len(diff.Added) != 0 {
+		t.Errorf("Moved = %v, Added = %v; ожидался один сдвинутый блок", diff.Moved, diff.Added)
+	}
+}
+
+func TestDiffBlocksDuplicateSymbols(t *testing.T) {
+	// Первый из двух одноимённых блоков удалён: второй сохраняет вектор, но получает номер 0
+	first := diffBlock("dup", 1, 2, "def dup(): return 1")
+	second := diffBlock("dup", 4, 5, "def dup(): return 2")
+	models.AssignOrdinals([]*models.CodeBlock{first, second})
+	stored := []StoredBlock{{ID: 1, CodeBlock: first}, {ID: 2, CodeBlock: second}}
+
+	parsed := []*models.CodeBlock{diffBlock("dup", 4, 5, "def dup(): return 2")}
+	models.AssignOrdinals(parsed)
+
+	diff := DiffBlocks(stored, parsed)
+	if len(diff.Moved) != 1 || diff.Moved[0].ID != 2 || diff.Moved[0].Ordinal != 0 {
+		t.Errorf("Moved = %v, ожидался блок 2 с номером 0", diff.Moved)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != 1 || len(diff.Added) != 0 {
+		t.Errorf("Removed = %v, Added = %v; ожидалось удаление блока 1 без новых блоков", diff.Removed, diff.Added)
+	}
+	if diff.Moved[0].StableID() == second.StableID() {
+		t.Errorf("смена номера должна менять стабильный идентификатор")
+	}
+}
@@ -2,24 +2,36 @@ package database
 
 import (
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
 	"gokb-embedder/internal/models"
 
 	_ "modernc.org/sqlite"
 )
 
-// Database предоставляет методы для работы с базой данных
+// Database предоставляет методы для работы с базой данных SQLite
 type Database struct {
 	db *sql.DB
+
+	// project имя текущего проекта, которым ограничены все запросы
+	project string
+
+	// snapshot идентификатор выбранного для чтения снимка (0 - текущий индекс)
+	snapshot int64
 }
 
-// NewDatabase создаёт новое подключение к базе данных
+var _ Storage = (*Database)(nil)
+
+// busyTimeout время ожидания снятия блокировки другим процессом вместо ошибки "database is locked"
+const busyTimeout = 10 * time.Second
+
+// NewDatabase создаёт новое подключение к базе данных в режиме WAL:
+// читатели не блокируются на время записи другим процессом
 func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("ошибка открытия базы данных: %w", err)
 	}
@@ -36,6 +48,16 @@ func NewDatabase(dbPath string) (*Database, error) {
 	return database, nil
 }
 
+// sqliteDSN добавляет к пути базы прагмы WAL и busy_timeout, применяемые к каждому соединению
+func sqliteDSN(dbPath string) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)",
+		dbPath, separator, busyTimeout.Milliseconds())
+}
+
 // Close закрывает подключение к базе данных
 func (d *Database) Close() error {
 	return d.db.Close()
@@ -47,102 +69,482 @@ func (d *Database) initTables() error {
 	embeddingsTable := `
 	CREATE TABLE IF NOT EXISTS embeddings (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project TEXT NOT NULL DEFAULT '',
 		embedding TEXT NOT NULL,
 		file_path TEXT NOT NULL,
 		relative_path TEXT NOT NULL,
+		real_path TEXT NOT NULL DEFAULT '',
 		block_type TEXT NOT NULL,
 		class_name TEXT,
 		method_name TEXT,
 		start_line INTEGER NOT NULL,
 		end_line INTEGER NOT NULL,
+		ordinal INTEGER NOT NULL DEFAULT 0,
 		commit_messages TEXT,
 		raw_text TEXT NOT NULL,
 		embedding_text TEXT NOT NULL,
+		content_hash TEXT NOT NULL DEFAULT '',
+		body_hash TEXT NOT NULL DEFAULT '',
+		live INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	// Общие векторы: один эмбединг на нормализованное тело блока
+	vectorsTable := `
+	CREATE TABLE IF NOT EXISTS vectors (
+		body_hash TEXT PRIMARY KEY,
+		vector TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`
 
 	// Таблица для хешей файлов
 	fileHashesTable := `
 	CREATE TABLE IF NOT EXISTS file_hashes (
-		file_path TEXT PRIMARY KEY,
+		project TEXT NOT NULL DEFAULT '',
+		file_path TEXT NOT NULL,
 		file_hash TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		mtime INTEGER NOT NULL DEFAULT 0,
+		inode INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (project, file_path)
+	)`
+
+	// Таблица проектов (репозиториев)
+	projectsTable := `
+	CREATE TABLE IF NOT EXISTS projects (
+		name TEXT PRIMARY KEY,
+		root TEXT NOT NULL,
+		remote_url TEXT NOT NULL DEFAULT '',
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`
 
+	// Снимки индекса и блоки, входящие в каждый снимок
+	snapshotsTable := `
+	CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project TEXT NOT NULL,
+		label TEXT NOT NULL,
+		commit_sha TEXT NOT NULL DEFAULT '',
+		branch TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (project, label)
+	)`
+
+	// Последний проиндексированный коммит каждого корня
+	indexStatesTable := `
+	CREATE TABLE IF NOT EXISTS index_states (
+		project TEXT NOT NULL,
+		root TEXT NOT NULL DEFAULT '',
+		commit_sha TEXT NOT NULL,
+		dirty_paths TEXT NOT NULL DEFAULT '[]',
+		settings TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (project, root)
+	)`
+
+	snapshotBlocksTable := `
+	CREATE TABLE IF NOT EXISTS snapshot_blocks (
+		snapshot_id INTEGER NOT NULL,
+		block_id INTEGER NOT NULL,
+		PRIMARY KEY (snapshot_id, block_id)
+	)`
+
 	// Создаём таблицы
 	if _, err := d.db.Exec(embeddingsTable); err != nil {
 		return fmt.Errorf("ошибка создания таблицы embeddings: %w", err)
 	}
 
+	if _, err := d.db.Exec(vectorsTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы vectors: %w", err)
+	}
+
 	if _, err := d.db.Exec(fileHashesTable); err != nil {
 		return fmt.Errorf("ошибка создания таблицы file_hashes: %w", err)
 	}
 
+	if _, err := d.db.Exec(projectsTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы projects: %w", err)
+	}
+
+	if _, err := d.db.Exec(snapshotsTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы snapshots: %w", err)
+	}
+
+	if _, err := d.db.Exec(snapshotBlocksTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы snapshot_blocks: %w", err)
+	}
+
+	if _, err := d.db.Exec(indexStatesTable); err != nil {
+		return fmt.Errorf("ошибка создания таблицы index_states: %w", err)
+	}
+
+	if err := d.migrateProjects(); err != nil {
+		return err
+	}
+
+	if err := d.migrateSnapshots(); err != nil {
+		return err
+	}
+
+	if err := d.migrateVectors(); err != nil {
+		return err
+	}
+
+	if err := d.migrateFileStates(); err != nil {
+		return err
+	}
+
+	if err := d.migrateOrdinals(); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_embeddings_project_file
+		ON embeddings (project, file_path)`); err != nil {
+		return fmt.Errorf("ошибка создания индекса embeddings: %w", err)
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_snapshot_blocks_block
+		ON snapshot_blocks (block_id)`); err != nil {
+		return fmt.Errorf("ошибка создания индекса snapshot_blocks: %w", err)
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_embeddings_body_hash
+		ON embeddings (body_hash)`); err != nil {
+		return fmt.Errorf("ошибка создания индекса embeddings: %w", err)
+	}
+
 	return nil
 }
 
-// SaveEmbedding сохраняет эмбединг в базу данных
+// migrateVectors переносит эмбединги, хранившиеся в строках embeddings, в общую таблицу vectors.
+// Блоки с одинаковым нормализованным телом после миграции ссылаются на один вектор.
+func (d *Database) migrateVectors() error {
+	exists, err := d.hasColumn("embeddings", "body_hash")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := d.db.Exec("ALTER TABLE embeddings ADD COLUMN body_hash TEXT NOT NULL DEFAULT ''"); err != nil {
+			return fmt.Errorf("ошибка миграции таблицы embeddings: %w", err)
+		}
+	}
+
+	rows, err := d.db.Query("SELECT id, raw_text, embedding FROM embeddings WHERE body_hash = ''")
+	if err != nil {
+		return fmt.Errorf("ошибка миграции векторов: %w", err)
+	}
+	legacy, err := scanLegacyVectors(rows)
+	if err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка миграции векторов: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, row := range legacy {
+		if _, err := tx.Exec("UPDATE embeddings SET body_hash = ?, embedding = '' WHERE id = ?",
+			row.bodyHash, row.id); err != nil {
+			return fmt.Errorf("ошибка миграции векторов: %w", err)
+		}
+		if row.vector == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO vectors (body_hash, vector) VALUES (?, ?)",
+			row.bodyHash, row.vector); err != nil {
+			return fmt.Errorf("ошибка миграции векторов: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// migrateFileStates добавляет колонки stat в таблицу file_hashes, созданную до быстрой проверки изменений.
+// Старые записи получают нулевое время изменения, поэтому при первом запуске файлы хешируются заново.
+func (d *Database) migrateFileStates() error {
+	for _, column := range []string{"size", "mtime", "inode"} {
+		exists, err := d.hasColumn("file_hashes", column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := d.db.Exec("ALTER TABLE file_hashes ADD COLUMN " + column + " INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return fmt.Errorf("ошибка миграции таблицы file_hashes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateOrdinals добавляет колонку ordinal и нумерует одноимённые блоки файлов, сохранённые до её появления
+func (d *Database) migrateOrdinals() error {
+	exists, err := d.hasColumn("embeddings", "ordinal")
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := d.db.Exec("ALTER TABLE embeddings ADD COLUMN ordinal INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return fmt.Errorf("ошибка миграции таблицы embeddings: %w", err)
+	}
+	if _, err := d.db.Exec(backfillOrdinalsSQL); err != nil {
+		return fmt.Errorf("ошибка нумерации блоков: %w", err)
+	}
+	return nil
+}
+
+// migrateSnapshots добавляет колонки content_hash и live в таблицу, созданную до поддержки снимков
+func (d *Database) migrateSnapshots() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"content_hash", "content_hash TEXT NOT NULL DEFAULT ''"},
+		{"live", "live INTEGER NOT NULL DEFAULT 1"},
+		{"real_path", "real_path TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, column := range columns {
+		exists, err := d.hasColumn("embeddings", column.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := d.db.Exec("ALTER TABLE embeddings ADD COLUMN " + column.definition); err != nil {
+			return fmt.Errorf("ошибка миграции таблицы embeddings: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateProjects добавляет колонку project в таблицы, созданные до поддержки нескольких проектов
+func (d *Database) migrateProjects() error {
+	hasProject, err := d.hasColumn("embeddings", "project")
+	if err != nil {
+		return err
+	}
+	if !hasProject {
+		if _, err := d.db.Exec(`ALTER TABLE embeddings ADD COLUMN project TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("ошибка миграции таблицы embeddings: %w", err)
+		}
+	}
+
+	hasProject, err = d.hasColumn("file_hashes", "project")
+	if err != nil {
+		return err
+	}
+	if hasProject {
+		return nil
+	}
+
+	// Первичный ключ меняется, поэтому таблица file_hashes пересоздаётся
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка миграции таблицы file_hashes: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`ALTER TABLE file_hashes RENAME TO file_hashes_old`,
+		`CREATE TABLE file_hashes (
+			project TEXT NOT NULL DEFAULT '',
+			file_path TEXT NOT NULL,
+			file_hash TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (project, file_path)
+		)`,
+		`INSERT INTO file_hashes (project, file_path, file_hash, updated_at)
+			SELECT '', file_path, file_hash, updated_at FROM file_hashes_old`,
+		`DROP TABLE file_hashes_old`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("ошибка миграции таблицы file_hashes: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// hasColumn проверяет наличие колонки в таблице
+func (d *Database) hasColumn(table, column string) (bool, error) {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения схемы таблицы %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("ошибка чтения схемы таблицы %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// UseProject регистрирует проект и ограничивает им все последующие запросы.
+// Записи, сохранённые до появления проектов, переходят к первому зарегистрированному проекту.
+func (d *Database) UseProject(project models.Project) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+	defer tx.Rollback()
+
+	var projectCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM projects").Scan(&projectCount); err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO projects (name, root, remote_url, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (name) DO UPDATE
+		SET root = excluded.root, remote_url = excluded.remote_url, updated_at = excluded.updated_at`,
+		project.Name, project.Root, project.RemoteURL)
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	if projectCount == 0 {
+		for _, table := range []string{"embeddings", "file_hashes"} {
+			query := fmt.Sprintf("UPDATE %s SET project = ? WHERE project = ''", table)
+			if _, err := tx.Exec(query, project.Name); err != nil {
+				return fmt.Errorf("ошибка переноса записей в проект %s: %w", project.Name, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	d.project = project.Name
+	d.snapshot = 0
+	return nil
+}
+
+// ListProjects возвращает все проекты в базе данных
+func (d *Database) ListProjects() ([]models.Project, error) {
+	rows, err := d.db.Query("SELECT name, root, remote_url FROM projects ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка проектов: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var project models.Project
+		if err := rows.Scan(&project.Name, &project.Root, &project.RemoteURL); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования проекта: %w", err)
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, rows.Err()
+}
+
+// SaveEmbedding сохраняет блок и общий вектор его тела
 func (d *Database) SaveEmbedding(block *models.CodeBlock, embedding []float64, embeddingText string) error {
+	if err := d.saveVector(block.BodyHash(), embedding); err != nil {
+		return err
+	}
+
+	if err := d.insertBlock(block, embeddingText); err != nil {
+		return fmt.Errorf("ошибка вставки эмбединга: %w", err)
+	}
+
+	return nil
+}
+
+// SaveBlockWithoutEmbedding сохраняет блок кода без эмбединга (только embedding_text)
+func (d *Database) SaveBlockWithoutEmbedding(block *models.CodeBlock, embeddingText string) error {
+	if err := d.insertBlock(block, embeddingText); err != nil {
+		return fmt.Errorf("ошибка вставки блока: %w", err)
+	}
+
+	return nil
+}
+
+// saveVector сохраняет вектор тела блока (существующий вектор заменяется)
+func (d *Database) saveVector(bodyHash string, embedding []float64) error {
 	// Сериализуем эмбединг в JSON
 	embeddingJSON, err := json.Marshal(embedding)
 	if err != nil {
 		return fmt.Errorf("ошибка сериализации эмбединга: %w", err)
 	}
 
-	// Сериализуем сообщения коммитов в JSON
-	var commitMessagesJSON *string
-	if len(block.CommitMessages) > 0 {
-		commitJSON, err := json.Marshal(block.CommitMessages)
-		if err != nil {
-			return fmt.Errorf("ошибка сериализации сообщений коммитов: %w", err)
-		}
-		commitStr := string(commitJSON)
-		commitMessagesJSON = &commitStr
+	_, err = d.db.Exec("INSERT OR REPLACE INTO vectors (body_hash, vector) VALUES (?, ?)",
+		bodyHash, string(embeddingJSON))
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения вектора: %w", err)
 	}
+	return nil
+}
 
-	// Подготавливаем значения для вставки
-	className := ""
-	if block.ClassName != nil {
-		className = *block.ClassName
+// insertBlock вставляет блок текущего проекта; вектор хранится отдельно в таблице vectors
+func (d *Database) insertBlock(block *models.CodeBlock, embeddingText string) error {
+	commitMessagesJSON, err := marshalCommitMessages(block.CommitMessages)
+	if err != nil {
+		return err
 	}
 
-	methodName := ""
-	if block.MethodName != nil {
-		methodName = *block.MethodName
-	}
+	className, methodName := blockNames(block)
 
-	// Вставляем запись
 	query := `
-	INSERT INTO embeddings 
-	(embedding, file_path, relative_path, block_type, class_name, method_name, 
-	 start_line, end_line, commit_messages, raw_text, embedding_text)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	INSERT INTO embeddings
+	(project, embedding, file_path, relative_path, real_path, block_type, class_name, method_name,
+	 start_line, end_line, ordinal, commit_messages, raw_text, embedding_text, content_hash, body_hash)
+	VALUES (?, '', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err = d.db.Exec(query,
-		string(embeddingJSON),
+		d.project,
 		block.FilePath,
 		block.GetRelativePath(),
+		block.RealPath,
 		block.BlockType,
 		className,
 		methodName,
 		block.StartLine,
 		block.EndLine,
+		block.Ordinal,
 		commitMessagesJSON,
 		block.RawText,
 		embeddingText,
+		block.ContentHash(),
+		block.BodyHash(),
 	)
 
-	if err != nil {
-		return fmt.Errorf("ошибка вставки эмбединга: %w", err)
-	}
-
-	return nil
+	return err
 }
 
 // GetFileHash возвращает хеш файла из базы данных
 func (d *Database) GetFileHash(filePath string) (string, error) {
 	var hash string
-	err := d.db.QueryRow("SELECT file_hash FROM file_hashes WHERE file_path = ?", filePath).Scan(&hash)
+	err := d.db.QueryRow("SELECT file_hash FROM file_hashes WHERE project = ? AND file_path = ?",
+		d.project, filePath).Scan(&hash)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
@@ -152,13 +554,40 @@ func (d *Database) GetFileHash(filePath string) (string, error) {
 	return hash, nil
 }
 
+// GetFileHashes возвращает хеши всех файлов текущего проекта по путям
+func (d *Database) GetFileHashes() (map[string]string, error) {
+	rows, err := d.db.Query("SELECT file_path, file_hash FROM file_hashes WHERE project = ?", d.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения хешей файлов: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFileHashes(rows)
+}
+
 // UpdateFileHash обновляет хеш файла в базе данных
 func (d *Database) UpdateFileHash(filePath, hash string) error {
+	return d.UpdateFileState(models.FileState{Path: filePath, Hash: hash})
+}
+
+// GetFileStates возвращает хеши и данные stat всех файлов текущего проекта по путям
+func (d *Database) GetFileStates() (map[string]models.FileState, error) {
+	rows, err := d.db.Query("SELECT "+fileStateColumns+" FROM file_hashes WHERE project = ?", d.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения состояний файлов: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFileStates(rows)
+}
+
+// UpdateFileState сохраняет хеш и данные stat файла
+func (d *Database) UpdateFileState(state models.FileState) error {
 	query := `
-	INSERT OR REPLACE INTO file_hashes (file_path, file_hash, updated_at)
-	VALUES (?, ?, CURRENT_TIMESTAMP)`
+	INSERT OR REPLACE INTO file_hashes (project, file_path, file_hash, size, mtime, inode, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
 
-	_, err := d.db.Exec(query, filePath, hash)
+	_, err := d.db.Exec(query, d.project, state.Path, state.Hash, state.Size, state.ModTime, int64(state.Inode))
 	if err != nil {
 		return fmt.Errorf("ошибка обновления хеша файла: %w", err)
 	}
@@ -166,33 +595,141 @@ func (d *Database) UpdateFileHash(filePath, hash string) error {
 	return nil
 }
 
-// DeleteFileBlocks удаляет все блоки для файла
+// DeleteFileHash удаляет сохранённый хеш файла
+func (d *Database) DeleteFileHash(filePath string) error {
+	_, err := d.db.Exec("DELETE FROM file_hashes WHERE project = ? AND file_path = ?", d.project, filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления хеша файла: %w", err)
+	}
+	return nil
+}
+
+// GetIndexState возвращает состояние индексации корня текущего проекта
+func (d *Database) GetIndexState(root string) (models.IndexState, error) {
+	row := d.db.QueryRow("SELECT commit_sha, dirty_paths, settings FROM index_states WHERE project = ? AND root = ?",
+		d.project, root)
+	return scanIndexState(row, root)
+}
+
+// SaveIndexState сохраняет состояние индексации корня текущего проекта
+func (d *Database) SaveIndexState(state models.IndexState) error {
+	dirtyPaths, err := marshalDirtyPaths(state.DirtyPaths)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`
+	INSERT OR REPLACE INTO index_states (project, root, commit_sha, dirty_paths, settings, updated_at)
+	VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		d.project, state.Root, state.CommitSHA, dirtyPaths, state.Settings)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния индексации: %w", err)
+	}
+	return nil
+}
+
+// DeleteFileBlocks удаляет блоки файла из текущего индекса.
+// Блоки, входящие в снимки, остаются в базе и только исключаются из текущего индекса.
 func (d *Database) DeleteFileBlocks(filePath string) error {
-	_, err := d.db.Exec("DELETE FROM embeddings WHERE file_path = ?", filePath)
+	_, err := d.db.Exec(`DELETE FROM embeddings
+		WHERE project = ? AND file_path = ? AND live = 1
+		AND id NOT IN (SELECT block_id FROM snapshot_blocks)`, d.project, filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков файла: %w", err)
+	}
+
+	_, err = d.db.Exec("UPDATE embeddings SET live = 0 WHERE project = ? AND file_path = ? AND live = 1",
+		d.project, filePath)
 	if err != nil {
 		return fmt.Errorf("ошибка удаления блоков файла: %w", err)
 	}
 	return nil
 }
 
-// BlockExists проверяет, существует ли блок с такими параметрами
-func (d *Database) BlockExists(block *models.CodeBlock) (bool, error) {
-	className := ""
-	if block.ClassName != nil {
-		className = *block.ClassName
+// GetFileBlocks возвращает блоки файла из текущего индекса в порядке строк
+func (d *Database) GetFileBlocks(filePath string) ([]StoredBlock, error) {
+	rows, err := d.db.Query(`
+		SELECT `+blockColumns+`, id
+		FROM embeddings
+		WHERE project = ? AND live = 1 AND file_path = ?
+		ORDER BY start_line, id`, d.project, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения блоков файла: %w", err)
+	}
+	return scanStoredBlocks(rows)
+}
+
+// MoveBlock обновляет путь, положение, текст и сообщения коммитов сохранённого блока.
+// body_hash не меняется, поэтому блок сохраняет свой вектор.
+func (d *Database) MoveBlock(id int64, block *models.CodeBlock, embeddingText string) error {
+	var inSnapshot bool
+	err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM snapshot_blocks WHERE block_id = ?)", id).Scan(&inSnapshot)
+	if err != nil {
+		return fmt.Errorf("ошибка переноса блока: %w", err)
 	}
 
-	methodName := ""
-	if block.MethodName != nil {
-		methodName = *block.MethodName
+	// Снимок хранит прежнее положение блока: строка исключается из текущего индекса, вместо неё вставляется копия
+	if inSnapshot {
+		if _, err := d.db.Exec("UPDATE embeddings SET live = 0 WHERE id = ?", id); err != nil {
+			return fmt.Errorf("ошибка переноса блока: %w", err)
+		}
+		if err := d.insertBlock(block, embeddingText); err != nil {
+			return fmt.Errorf("ошибка переноса блока: %w", err)
+		}
+		return nil
 	}
 
+	commitMessagesJSON, err := marshalCommitMessages(block.CommitMessages)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`
+		UPDATE embeddings
+		SET file_path = ?, relative_path = ?, real_path = ?, start_line = ?, end_line = ?, ordinal = ?,
+			raw_text = ?, embedding_text = ?, commit_messages = ?, content_hash = ?
+		WHERE id = ? AND project = ?`,
+		block.FilePath, block.GetRelativePath(), block.RealPath, block.StartLine, block.EndLine, block.Ordinal,
+		block.RawText, embeddingText, commitMessagesJSON, block.ContentHash(),
+		id, d.project)
+	if err != nil {
+		return fmt.Errorf("ошибка переноса блока: %w", err)
+	}
+	return nil
+}
+
+// DeleteBlocks удаляет блоки из текущего индекса по ID.
+// Блоки, входящие в снимки, остаются в базе и только исключаются из текущего индекса.
+func (d *Database) DeleteBlocks(ids []int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM embeddings
+			WHERE id = ? AND project = ? AND id NOT IN (SELECT block_id FROM snapshot_blocks)`, id, d.project); err != nil {
+			return fmt.Errorf("ошибка удаления блоков: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE embeddings SET live = 0 WHERE id = ? AND project = ?", id, d.project); err != nil {
+			return fmt.Errorf("ошибка удаления блоков: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// BlockExists проверяет, существует ли блок с такими параметрами
+func (d *Database) BlockExists(block *models.CodeBlock) (bool, error) {
+	className, methodName := blockNames(block)
+
 	var count int
 	err := d.db.QueryRow(`
 		SELECT COUNT(*) FROM embeddings
-		WHERE file_path = ? AND class_name = ? AND method_name = ? 
+		WHERE project = ? AND live = 1 AND file_path = ? AND class_name = ? AND method_name = ?
 		AND start_line = ? AND end_line = ? AND block_type = ?`,
-		block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+		d.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
 	).Scan(&count)
 
 	if err != nil {
@@ -202,9 +739,69 @@ func (d *Database) BlockExists(block *models.CodeBlock) (bool, error) {
 	return count > 0, nil
 }
 
+// GetVector возвращает общий вектор тела блока (nil, если его ещё нет)
+func (d *Database) GetVector(block *models.CodeBlock) ([]float64, error) {
+	var vectorText string
+	err := d.db.QueryRow("SELECT vector FROM vectors WHERE body_hash = ?", block.BodyHash()).Scan(&vectorText)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения вектора: %w", err)
+	}
+
+	var embedding []float64
+	if err := json.Unmarshal([]byte(vectorText), &embedding); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации вектора блока %s: %w", block, err)
+	}
+	return embedding, nil
+}
+
+// FindOccurrences возвращает все блоки текущего индекса с данным хешем тела
+func (d *Database) FindOccurrences(bodyHash string) ([]*models.CodeBlock, error) {
+	scope, arg := d.readScope()
+	rows, err := d.db.Query(`
+		SELECT `+blockColumns+`
+		FROM embeddings
+		WHERE `+scope+` AND body_hash = ?
+		ORDER BY file_path, start_line`, arg, bodyHash)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска вхождений: %w", err)
+	}
+	return scanBlocks(rows)
+}
+
+// FindDuplicates возвращает группы одинаковых тел текущего индекса, самые частые первыми
+func (d *Database) FindDuplicates(limit int) ([]DuplicateGroup, error) {
+	scope, arg := d.readScope()
+	rows, err := d.db.Query(`
+		SELECT body_hash FROM embeddings
+		WHERE `+scope+` AND body_hash != ''
+		GROUP BY body_hash HAVING COUNT(*) > 1
+		ORDER BY COUNT(*) DESC, body_hash
+		LIMIT ?`, arg, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+	hashes, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+
+	groups := make([]DuplicateGroup, 0, len(hashes))
+	for _, hash := range hashes {
+		blocks, err := d.FindOccurrences(hash)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, DuplicateGroup{BodyHash: hash, Blocks: blocks})
+	}
+	return groups, nil
+}
+
 // GetAllFilePaths возвращает все пути файлов из базы данных
 func (d *Database) GetAllFilePaths() ([]string, error) {
-	rows, err := d.db.Query("SELECT DISTINCT file_path FROM embeddings")
+	rows, err := d.db.Query("SELECT DISTINCT file_path FROM embeddings WHERE project = ? AND live = 1", d.project)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения путей файлов: %w", err)
 	}
@@ -222,174 +819,288 @@ func (d *Database) GetAllFilePaths() ([]string, error) {
 	return paths, nil
 }
 
-// SaveBlockWithoutEmbedding сохраняет блок кода без эмбединга (только embedding_text)
-func (d *Database) SaveBlockWithoutEmbedding(block *models.CodeBlock, embeddingText string) error {
-	// Сериализуем сообщения коммитов в JSON
-	var commitMessagesJSON *string
-	if len(block.CommitMessages) > 0 {
-		commitJSON, err := json.Marshal(block.CommitMessages)
+// CountBlocksWithoutEmbeddings возвращает количество блоков текущего индекса без вектора
+func (d *Database) CountBlocksWithoutEmbeddings() (int, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM embeddings
+		WHERE project = ? AND live = 1 AND NOT `+hasVectorSQL, d.project).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества блоков без эмбедингов: %w", err)
+	}
+	return count, nil
+}
+
+// ForEachBlockWithoutEmbeddings обходит блоки без вектора страницами в порядке ID (keyset-пагинация)
+func (d *Database) ForEachBlockWithoutEmbeddings(pageSize int, fn func(page []*models.CodeBlock) error) error {
+	var lastID int64
+	for {
+		rows, err := d.db.Query(`
+			SELECT `+blockColumns+`, id
+			FROM embeddings
+			WHERE project = ? AND live = 1 AND id > ? AND NOT `+hasVectorSQL+`
+			ORDER BY id
+			LIMIT ?`, d.project, lastID, pageSize)
 		if err != nil {
-			return fmt.Errorf("ошибка сериализации сообщений коммитов: %w", err)
+			return fmt.Errorf("ошибка получения блоков без эмбедингов: %w", err)
+		}
+
+		page, pageLastID, err := scanBlockPage(rows)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
 		}
-		commitStr := string(commitJSON)
-		commitMessagesJSON = &commitStr
+		lastID = pageLastID
 	}
+}
 
-	// Подготавливаем значения для вставки
-	className := ""
-	if block.ClassName != nil {
-		className = *block.ClassName
+// ForEachEmbedding вызывает fn для каждого блока с эмбедингом.
+// Блоки с одинаковым телом получают один и тот же общий вектор.
+func (d *Database) ForEachEmbedding(fn func(block *models.CodeBlock, embedding []float64) error) error {
+	scope, arg := d.readScope()
+	rows, err := d.db.Query(`
+		SELECT `+blockColumns+`, v.vector
+		FROM embeddings
+		JOIN vectors v ON v.body_hash = embeddings.body_hash
+		WHERE `+scope+`
+		ORDER BY file_path, start_line`, arg)
+	if err != nil {
+		return fmt.Errorf("ошибка получения блоков с эмбедингами: %w", err)
 	}
+	defer rows.Close()
 
-	methodName := ""
-	if block.MethodName != nil {
-		methodName = *block.MethodName
+	return forEachEmbeddingRow(rows, fn)
+}
+
+// UpdateEmbedding обновляет общий вектор тела существующего блока
+func (d *Database) UpdateEmbedding(block *models.CodeBlock, embedding []float64) error {
+	className, methodName := blockNames(block)
+
+	var bodyHash string
+	err := d.db.QueryRow(`
+		SELECT body_hash FROM embeddings
+		WHERE project = ? AND live = 1 AND file_path = ? AND class_name = ? AND method_name = ?
+		AND start_line = ? AND end_line = ? AND block_type = ?
+		LIMIT 1`,
+		d.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+	).Scan(&bodyHash)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("блок не найден для обновления")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка обновления эмбединга: %w", err)
 	}
 
-	// Вставляем запись с пустым embedding
-	query := `
-	INSERT INTO embeddings 
-	(embedding, file_path, relative_path, block_type, class_name, method_name, 
-	 start_line, end_line, commit_messages, raw_text, embedding_text)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	return d.saveVector(bodyHash, embedding)
+}
 
-	_, err := d.db.Exec(query,
-		"", // пустой embedding
-		block.FilePath,
-		block.GetRelativePath(),
-		block.BlockType,
-		className,
-		methodName,
-		block.StartLine,
-		block.EndLine,
-		commitMessagesJSON,
-		block.RawText,
-		embeddingText,
+// ReuseBlock возвращает в текущий индекс блок из снимков с тем же положением и тем же текстом
+func (d *Database) ReuseBlock(block *models.CodeBlock) (bool, error) {
+	className, methodName := blockNames(block)
+
+	result, err := d.db.Exec(`
+		UPDATE embeddings SET live = 1
+		WHERE id = (
+			SELECT id FROM embeddings
+			WHERE project = ? AND live = 0 AND file_path = ? AND class_name = ? AND method_name = ?
+			AND start_line = ? AND end_line = ? AND block_type = ? AND content_hash = ?
+			ORDER BY id DESC LIMIT 1
+		)`,
+		d.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+		block.ContentHash(),
 	)
+	if err != nil {
+		return false, fmt.Errorf("ошибка повторного использования блока: %w", err)
+	}
 
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка вставки блока: %w", err)
+		return false, fmt.Errorf("ошибка получения количества обновлённых строк: %w", err)
 	}
 
-	return nil
+	return rowsAffected > 0, nil
+}
+
+// CreateSnapshot сохраняет текущий индекс проекта как снимок.
+// Блоки не копируются: снимок ссылается на те же строки embeddings.
+func (d *Database) CreateSnapshot(snapshot models.Snapshot) (models.Snapshot, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Снимок с той же меткой заменяется
+	statements := []string{
+		`DELETE FROM snapshot_blocks WHERE snapshot_id IN
+			(SELECT id FROM snapshots WHERE project = ? AND label = ?)`,
+		`DELETE FROM snapshots WHERE project = ? AND label = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, d.project, snapshot.Label); err != nil {
+			return snapshot, fmt.Errorf("ошибка замены снимка %s: %w", snapshot.Label, err)
+		}
+	}
+
+	result, err := tx.Exec(`INSERT INTO snapshots (project, label, commit_sha, branch, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		d.project, snapshot.Label, snapshot.CommitSHA, snapshot.Branch)
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка %s: %w", snapshot.Label, err)
+	}
+	snapshotID, err := result.LastInsertId()
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка %s: %w", snapshot.Label, err)
+	}
+
+	result, err = tx.Exec(`INSERT INTO snapshot_blocks (snapshot_id, block_id)
+		SELECT ?, id FROM embeddings WHERE project = ? AND live = 1`, snapshotID, d.project)
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка сохранения блоков снимка %s: %w", snapshot.Label, err)
+	}
+	blocks, err := result.RowsAffected()
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка сохранения блоков снимка %s: %w", snapshot.Label, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка %s: %w", snapshot.Label, err)
+	}
+
+	snapshot.Blocks = int(blocks)
+	snapshot.CreatedAt = time.Now()
+	return snapshot, nil
 }
 
-// GetBlocksWithoutEmbeddings возвращает все блоки без эмбедингов
-func (d *Database) GetBlocksWithoutEmbeddings() ([]*models.CodeBlock, error) {
+// ListSnapshots возвращает снимки текущего проекта, новые первыми
+func (d *Database) ListSnapshots() ([]models.Snapshot, error) {
 	rows, err := d.db.Query(`
-		SELECT id, file_path, relative_path, block_type, class_name, method_name, 
-		       start_line, end_line, commit_messages, raw_text, embedding_text
-		FROM embeddings 
-		WHERE embedding = '' OR embedding IS NULL
-		ORDER BY file_path, start_line`)
+		SELECT s.label, s.commit_sha, s.branch, s.created_at,
+			(SELECT COUNT(*) FROM snapshot_blocks sb WHERE sb.snapshot_id = s.id)
+		FROM snapshots s
+		WHERE s.project = ?
+		ORDER BY s.id DESC`, d.project)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения блоков без эмбедингов: %w", err)
+		return nil, fmt.Errorf("ошибка получения списка снимков: %w", err)
 	}
 	defer rows.Close()
 
-	var blocks []*models.CodeBlock
+	var snapshots []models.Snapshot
 	for rows.Next() {
-		var id, startLine, endLine int
-		var filePath, relativePath, blockType, className, methodName, commitMessages, rawText, embeddingText string
-
-		err := rows.Scan(&id, &filePath, &relativePath, &blockType, &className, &methodName,
-			&startLine, &endLine, &commitMessages, &rawText, &embeddingText)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования блока: %w", err)
-		}
-
-		// Десериализуем сообщения коммитов
-		var commitMsgs []string
-		if commitMessages != "" {
-			if err := json.Unmarshal([]byte(commitMessages), &commitMsgs); err != nil {
-				return nil, fmt.Errorf("ошибка десериализации сообщений коммитов: %w", err)
-			}
+		var snapshot models.Snapshot
+		if err := rows.Scan(&snapshot.Label, &snapshot.CommitSHA, &snapshot.Branch,
+			&snapshot.CreatedAt, &snapshot.Blocks); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования снимка: %w", err)
 		}
+		snapshots = append(snapshots, snapshot)
+	}
 
-		// Создаём блок
-		block := &models.CodeBlock{
-			FilePath:       filePath,
-			RelativePath:   relativePath,
-			BlockType:      blockType,
-			StartLine:      startLine,
-			EndLine:        endLine,
-			RawText:        rawText,
-			CommitMessages: commitMsgs,
-		}
+	return snapshots, rows.Err()
+}
 
-		// Устанавливаем опциональные поля
-		if className != "" {
-			block.ClassName = &className
-		}
-		if methodName != "" {
-			block.MethodName = &methodName
-		}
+// UseSnapshot выбирает снимок для чтения по метке или префиксу SHA коммита
+func (d *Database) UseSnapshot(selector string) error {
+	if selector == "" {
+		d.snapshot = 0
+		return nil
+	}
 
-		blocks = append(blocks, block)
+	var snapshotID int64
+	err := d.db.QueryRow(`
+		SELECT id FROM snapshots
+		WHERE project = ? AND (label = ? OR commit_sha LIKE ? || '%')
+		ORDER BY label = ? DESC, id DESC
+		LIMIT 1`, d.project, selector, selector, selector).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("снимок %s не найден в проекте %s", selector, d.project)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка поиска снимка %s: %w", selector, err)
 	}
 
-	return blocks, nil
+	d.snapshot = snapshotID
+	return nil
 }
 
-// UpdateEmbedding обновляет эмбединг для существующего блока
-func (d *Database) UpdateEmbedding(block *models.CodeBlock, embedding []float64) error {
-	// Сериализуем эмбединг в JSON
-	embeddingJSON, err := json.Marshal(embedding)
+// DeleteSnapshot удаляет снимок по метке. Блоки освобождаются при сборке мусора.
+func (d *Database) DeleteSnapshot(label string) error {
+	tx, err := d.db.Begin()
 	if err != nil {
-		return fmt.Errorf("ошибка сериализации эмбединга: %w", err)
+		return fmt.Errorf("ошибка удаления снимка: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Подготавливаем значения для обновления
-	className := ""
-	if block.ClassName != nil {
-		className = *block.ClassName
+	var snapshotID int64
+	err = tx.QueryRow("SELECT id FROM snapshots WHERE project = ? AND label = ?", d.project, label).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("снимок %s не найден в проекте %s", label, d.project)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка удаления снимка %s: %w", label, err)
 	}
 
-	methodName := ""
-	if block.MethodName != nil {
-		methodName = *block.MethodName
+	statements := []string{
+		"DELETE FROM snapshot_blocks WHERE snapshot_id = ?",
+		"DELETE FROM snapshots WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, snapshotID); err != nil {
+			return fmt.Errorf("ошибка удаления снимка %s: %w", label, err)
+		}
 	}
 
-	// Обновляем запись
-	query := `
-	UPDATE embeddings 
-	SET embedding = ?
-	WHERE file_path = ? AND class_name = ? AND method_name = ? 
-	AND start_line = ? AND end_line = ? AND block_type = ?`
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка удаления снимка %s: %w", label, err)
+	}
 
-	result, err := d.db.Exec(query,
-		string(embeddingJSON),
-		block.FilePath,
-		className,
-		methodName,
-		block.StartLine,
-		block.EndLine,
-		block.BlockType,
-	)
+	if d.snapshot == snapshotID {
+		d.snapshot = 0
+	}
+	return nil
+}
 
+// CollectGarbage удаляет блоки проекта, которые не входят ни в текущий индекс, ни в один снимок,
+// и векторы, на которые больше не ссылается ни один блок
+func (d *Database) CollectGarbage() (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM embeddings
+		WHERE project = ? AND live = 0
+		AND id NOT IN (SELECT block_id FROM snapshot_blocks)`, d.project)
 	if err != nil {
-		return fmt.Errorf("ошибка обновления эмбединга: %w", err)
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	removed, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка получения количества обновлённых строк: %w", err)
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("блок не найден для обновления")
+	_, err = d.db.Exec(`DELETE FROM vectors
+		WHERE NOT EXISTS (SELECT 1 FROM embeddings e WHERE e.body_hash = vectors.body_hash)`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
 	}
 
-	return nil
+	return removed, nil
 }
 
-// GetStatistics возвращает статистику базы данных
+// GetStatistics возвращает статистику базы данных по текущему проекту
 func (d *Database) GetStatistics() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
+	stats["project"] = d.project
+
+	scope, arg := d.readScope()
 
 	// Общее количество блоков
 	var totalBlocks int
-	err := d.db.QueryRow("SELECT COUNT(*) FROM embeddings").Scan(&totalBlocks)
+	err := d.db.QueryRow("SELECT COUNT(*) FROM embeddings WHERE "+scope, arg).Scan(&totalBlocks)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения общего количества блоков: %w", err)
 	}
@@ -397,7 +1108,8 @@ func (d *Database) GetStatistics() (map[string]interface{}, error) {
 
 	// Блоки с эмбедингами
 	var blocksWithEmbeddings int
-	err = d.db.QueryRow("SELECT COUNT(*) FROM embeddings WHERE embedding != '' AND embedding IS NOT NULL").Scan(&blocksWithEmbeddings)
+	err = d.db.QueryRow(`SELECT COUNT(*) FROM embeddings
+		WHERE `+scope+` AND `+hasVectorSQL, arg).Scan(&blocksWithEmbeddings)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения количества блоков с эмбедингами: %w", err)
 	}
@@ -405,22 +1117,33 @@ func (d *Database) GetStatistics() (map[string]interface{}, error) {
 
 	// Блоки без эмбедингов
 	var blocksWithoutEmbeddings int
-	err = d.db.QueryRow("SELECT COUNT(*) FROM embeddings WHERE embedding = '' OR embedding IS NULL").Scan(&blocksWithoutEmbeddings)
+	err = d.db.QueryRow(`SELECT COUNT(*) FROM embeddings
+		WHERE `+scope+` AND NOT `+hasVectorSQL, arg).Scan(&blocksWithoutEmbeddings)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения количества блоков без эмбедингов: %w", err)
 	}
 	stats["blocks_without_embeddings"] = blocksWithoutEmbeddings
 
+	// Уникальные векторы: блоки с одинаковым телом разделяют один эмбединг
+	var uniqueVectors int
+	err = d.db.QueryRow(`SELECT COUNT(DISTINCT body_hash) FROM embeddings
+		WHERE `+scope+` AND `+hasVectorSQL, arg).Scan(&uniqueVectors)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения количества уникальных векторов: %w", err)
+	}
+	stats["unique_vectors"] = uniqueVectors
+	stats["deduplicated_blocks"] = blocksWithEmbeddings - uniqueVectors
+
 	// Количество файлов
 	var fileCount int
-	err = d.db.QueryRow("SELECT COUNT(DISTINCT file_path) FROM embeddings").Scan(&fileCount)
+	err = d.db.QueryRow("SELECT COUNT(DISTINCT file_path) FROM embeddings WHERE "+scope, arg).Scan(&fileCount)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения количества файлов: %w", err)
 	}
 	stats["file_count"] = fileCount
 
 	// Статистика по типам блоков
-	rows, err := d.db.Query("SELECT block_type, COUNT(*) FROM embeddings GROUP BY block_type")
+	rows, err := d.db.Query("SELECT block_type, COUNT(*) FROM embeddings WHERE "+scope+" GROUP BY block_type", arg)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения статистики по типам блоков: %w", err)
 	}
@@ -440,11 +1163,13 @@ func (d *Database) GetStatistics() (map[string]interface{}, error) {
 	return stats, nil
 }
 
-// ExportToCSV экспортирует данные из базы данных в CSV файл
+// ExportToCSV экспортирует данные текущего проекта (или выбранного снимка) в CSV файл
 func (d *Database) ExportToCSV(outputPath string) error {
+	scope, arg := d.readScope()
+
 	// Запрос для получения всех данных
 	query := `
-	SELECT 
+	SELECT
 		id,
 		file_path,
 		relative_path,
@@ -457,114 +1182,177 @@ func (d *Database) ExportToCSV(outputPath string) error {
 		raw_text,
 		embedding_text,
 		created_at,
-		CASE 
-			WHEN embedding != '' AND embedding IS NOT NULL THEN 'true'
+		CASE
+			WHEN ` + hasVectorSQL + ` THEN 'true'
 			ELSE 'false'
 		END as has_embedding
-	FROM embeddings 
+	FROM embeddings
+	WHERE ` + scope + `
 	ORDER BY file_path, start_line`
 
-	rows, err := d.db.Query(query)
+	rows, err := d.db.Query(query, arg)
 	if err != nil {
 		return fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
 	defer rows.Close()
 
-	// Создаём CSV файл
-	file, err := os.Create(outputPath)
+	return writeBlocksCSV(rows, outputPath)
+}
+
+// Maintain обслуживает базу SQLite: integrity_check, проверка векторов и хешей, VACUUM и ANALYZE
+func (d *Database) Maintain(options MaintenanceOptions) (*MaintenanceReport, error) {
+	report := &MaintenanceReport{}
+
+	size, err := d.size()
 	if err != nil {
-		return fmt.Errorf("ошибка создания CSV файла: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	report.SizeBefore = size
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	// Проверка целостности файла базы
+	rows, err := d.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки целостности: %w", err)
+	}
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения результата проверки целостности: %w", err)
+		}
+		if message != "ok" {
+			report.IntegrityErrors = append(report.IntegrityErrors, message)
+		}
+	}
+	rows.Close()
 
-	// Записываем заголовки
-	headers := []string{
-		"ID",
-		"File Path",
-		"Relative Path",
-		"Block Type",
-		"Class Name",
-		"Method Name",
-		"Start Line",
-		"End Line",
-		"Commit Messages",
-		"Raw Text",
-		"Embedding Text",
-		"Created At",
-		"Has Embedding",
+	// Битые векторы и векторы неверной размерности
+	rows, err = d.db.Query("SELECT body_hash, vector FROM vectors")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения векторов: %w", err)
+	}
+	err = checkVectors(rows, options.Dimensions, report)
+	rows.Close()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := writer.Write(headers); err != nil {
-		return fmt.Errorf("ошибка записи заголовков CSV: %w", err)
+	// Хеши файлов без блоков и блоки без хешей (только текущий индекс)
+	rows, err = d.db.Query(`
+		SELECT h.project, h.file_path FROM file_hashes h
+		WHERE NOT EXISTS (
+			SELECT 1 FROM embeddings e
+			WHERE e.project = h.project AND e.relative_path = h.file_path AND e.live = 1
+		)
+		ORDER BY h.project, h.file_path`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска хешей без блоков: %w", err)
+	}
+	if report.HashesWithoutBlocks, err = scanFileRefs(rows); err != nil {
+		return nil, err
 	}
 
-	// Записываем данные
-	rowCount := 0
-	for rows.Next() {
-		var (
-			id             int
-			filePath       string
-			relativePath   string
-			blockType      string
-			className      sql.NullString
-			methodName     sql.NullString
-			startLine      int
-			endLine        int
-			commitMessages sql.NullString
-			rawText        string
-			embeddingText  string
-			createdAt      string
-			hasEmbedding   string
+	rows, err = d.db.Query(`
+		SELECT DISTINCT e.project, e.relative_path FROM embeddings e
+		WHERE e.live = 1 AND NOT EXISTS (
+			SELECT 1 FROM file_hashes h
+			WHERE h.project = e.project AND h.file_path = e.relative_path
 		)
+		ORDER BY e.project, e.relative_path`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска блоков без хешей: %w", err)
+	}
+	if report.BlocksWithoutHashes, err = scanFileRefs(rows); err != nil {
+		return nil, err
+	}
 
-		if err := rows.Scan(
-			&id,
-			&filePath,
-			&relativePath,
-			&blockType,
-			&className,
-			&methodName,
-			&startLine,
-			&endLine,
-			&commitMessages,
-			&rawText,
-			&embeddingText,
-			&createdAt,
-			&hasEmbedding,
-		); err != nil {
-			return fmt.Errorf("ошибка сканирования строки: %w", err)
+	if options.Repair {
+		if err := d.repair(report); err != nil {
+			return nil, err
 		}
+		report.Repaired = true
+	}
 
-		// Подготавливаем данные для CSV
-		row := []string{
-			fmt.Sprintf("%d", id),
-			filePath,
-			relativePath,
-			blockType,
-			className.String,
-			methodName.String,
-			fmt.Sprintf("%d", startLine),
-			fmt.Sprintf("%d", endLine),
-			commitMessages.String,
-			rawText,
-			embeddingText,
-			createdAt,
-			hasEmbedding,
+	for _, stmt := range []string{"VACUUM", "ANALYZE"} {
+		if _, err := d.db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("ошибка выполнения %s: %w", stmt, err)
 		}
+	}
+
+	if report.SizeAfter, err = d.size(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// repair исправляет проблемы из отчёта в одной транзакции
+func (d *Database) repair(report *MaintenanceReport) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка исправления базы: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Векторы удаляются, и эмбединги всех их блоков будут сгенерированы заново
+	for _, hashes := range [][]string{report.MalformedVectors, report.WrongDimensionVectors} {
+		for _, hash := range hashes {
+			if _, err := tx.Exec("DELETE FROM vectors WHERE body_hash = ?", hash); err != nil {
+				return fmt.Errorf("ошибка удаления вектора %s: %w", hash, err)
+			}
+		}
+	}
 
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("ошибка записи строки CSV: %w", err)
+	// Без хеша файл будет обработан заново при следующем запуске
+	for _, ref := range report.HashesWithoutBlocks {
+		if _, err := tx.Exec("DELETE FROM file_hashes WHERE project = ? AND file_path = ?", ref.Project, ref.Path); err != nil {
+			return fmt.Errorf("ошибка удаления хеша %s: %w", ref.Path, err)
 		}
+	}
 
-		rowCount++
+	// Блоки без хеша убираются из текущего индекса (блоки снимков сохраняются)
+	for _, ref := range report.BlocksWithoutHashes {
+		statements := []string{
+			`DELETE FROM embeddings WHERE project = ? AND relative_path = ? AND live = 1
+				AND id NOT IN (SELECT block_id FROM snapshot_blocks)`,
+			"UPDATE embeddings SET live = 0 WHERE project = ? AND relative_path = ? AND live = 1",
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt, ref.Project, ref.Path); err != nil {
+				return fmt.Errorf("ошибка удаления блоков %s: %w", ref.Path, err)
+			}
+		}
 	}
 
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("ошибка при чтении строк: %w", err)
+	// Следующий запуск проверяет такие проекты полностью, а не по git diff
+	for _, project := range report.repairedProjects() {
+		if _, err := tx.Exec("DELETE FROM index_states WHERE project = ?", project); err != nil {
+			return fmt.Errorf("ошибка сброса состояния индексации %s: %w", project, err)
+		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка исправления базы: %w", err)
+	}
 	return nil
 }
+
+// size возвращает размер базы в байтах
+func (d *Database) size() (int64, error) {
+	var pageCount, pageSize int64
+	if err := d.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("ошибка получения размера базы: %w", err)
+	}
+	if err := d.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("ошибка получения размера базы: %w", err)
+	}
+	return pageCount * pageSize, nil
+}
+
+// readScope возвращает условие выборки блоков для чтения: выбранный снимок или текущий индекс проекта
+func (d *Database) readScope() (string, interface{}) {
+	if d.snapshot != 0 {
+		return "id IN (SELECT block_id FROM snapshot_blocks WHERE snapshot_id = ?)", d.snapshot
+	}
+	return "project = ? AND live = 1", d.project
+}
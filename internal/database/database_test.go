@@ -0,0 +1,717 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gokb-embedder/internal/models"
+)
+
+func testBlock(filePath string) *models.CodeBlock {
+	method := "handler"
+	block := models.NewCodeBlock(filePath, "function", nil, &method, 1, 5, "def handler(): pass")
+	block.SetRelativePath(filepath.Base(filePath))
+	return block
+}
+
+// pendingBlocks собирает все блоки без эмбедингов постранично
+func pendingBlocks(t *testing.T, db Storage, pageSize int) []*models.CodeBlock {
+	t.Helper()
+
+	var blocks []*models.CodeBlock
+	err := db.ForEachBlockWithoutEmbeddings(pageSize, func(page []*models.CodeBlock) error {
+		if len(page) > pageSize {
+			t.Errorf("страница из %d блоков больше лимита %d", len(page), pageSize)
+		}
+		blocks = append(blocks, page...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachBlockWithoutEmbeddings: %v", err)
+	}
+	return blocks
+}
+
+func TestProjectIsolation(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	// Оба проекта хранят файл с одинаковым путём
+	for _, name := range []string{"alpha", "beta"} {
+		if err := db.UseProject(models.Project{Name: name, Root: "/src/" + name}); err != nil {
+			t.Fatalf("UseProject(%s): %v", name, err)
+		}
+		if err := db.SaveEmbedding(testBlock("/src/app.py"), []float64{0.1, 0.2}, "text"); err != nil {
+			t.Fatalf("SaveEmbedding: %v", err)
+		}
+		if err := db.UpdateFileHash("/src/app.py", "hash-"+name); err != nil {
+			t.Fatalf("UpdateFileHash: %v", err)
+		}
+	}
+
+	// Удаление в beta не затрагивает alpha
+	if err := db.DeleteFileBlocks("/src/app.py"); err != nil {
+		t.Fatalf("DeleteFileBlocks: %v", err)
+	}
+
+	if err := db.UseProject(models.Project{Name: "alpha", Root: "/src/alpha"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+	hash, err := db.GetFileHash("/src/app.py")
+	if err != nil || hash != "hash-alpha" {
+		t.Errorf("хеш файла alpha = %q (%v), ожидался hash-alpha", hash, err)
+	}
+	hashes, err := db.GetFileHashes()
+	if err != nil || len(hashes) != 1 || hashes["/src/app.py"] != "hash-alpha" {
+		t.Errorf("GetFileHashes = %v (%v), ожидался только хеш alpha", hashes, err)
+	}
+
+	count := 0
+	db.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		if block.Project != "alpha" {
+			t.Errorf("блок проекта %q в выборке alpha", block.Project)
+		}
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("в проекте alpha %d блоков, ожидался 1", count)
+	}
+
+	projects, err := db.ListProjects()
+	if err != nil || len(projects) != 2 {
+		t.Errorf("ListProjects вернул %v (%v), ожидалось 2 проекта", projects, err)
+	}
+}
+
+func TestFileStates(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "alpha"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	// inode больше math.MaxInt64 хранится в знаковой колонке без потерь
+	state := models.FileState{Path: "app.py", Hash: "sha", Size: 42, ModTime: 1700000000123456789, Inode: 1<<63 + 7}
+	if err := db.UpdateFileState(state); err != nil {
+		t.Fatalf("UpdateFileState: %v", err)
+	}
+
+	states, err := db.GetFileStates()
+	if err != nil || states["app.py"] != state {
+		t.Fatalf("GetFileStates = %+v (%v), ожидалось %+v", states, err, state)
+	}
+	if !states["app.py"].SameStat(state) {
+		t.Error("SameStat для сохранённого состояния = false")
+	}
+
+	// Обновление только хеша сбрасывает данные stat: файл будет прочитан заново
+	if err := db.UpdateFileHash("app.py", "other"); err != nil {
+		t.Fatalf("UpdateFileHash: %v", err)
+	}
+	states, _ = db.GetFileStates()
+	if got := states["app.py"]; got.Hash != "other" || got.SameStat(state) {
+		t.Errorf("состояние после UpdateFileHash = %+v, ожидался хеш other без данных stat", got)
+	}
+}
+
+func TestIndexStates(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "alpha"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	if state, err := db.GetIndexState("api"); err != nil || state.CommitSHA != "" {
+		t.Fatalf("GetIndexState до индексации = %+v (%v), ожидалось пустое состояние", state, err)
+	}
+
+	saved := models.IndexState{Root: "api", CommitSHA: "abc", DirtyPaths: []string{"main.py"}, Settings: "s1"}
+	if err := db.SaveIndexState(saved); err != nil {
+		t.Fatalf("SaveIndexState: %v", err)
+	}
+	saved.CommitSHA = "def"
+	if err := db.SaveIndexState(saved); err != nil {
+		t.Fatalf("SaveIndexState (повтор): %v", err)
+	}
+
+	state, err := db.GetIndexState("api")
+	if err != nil || state.CommitSHA != "def" || len(state.DirtyPaths) != 1 || state.DirtyPaths[0] != "main.py" {
+		t.Errorf("GetIndexState = %+v (%v), ожидалось %+v", state, err, saved)
+	}
+	if other, _ := db.GetIndexState(""); other.CommitSHA != "" {
+		t.Errorf("состояние другого корня = %+v, ожидалось пустое", other)
+	}
+
+	// Исправление рассинхронизации хешей сбрасывает состояние: следующий запуск проверяет проект полностью
+	db.UpdateFileHash("orphan.py", "h1")
+	if _, err := db.Maintain(MaintenanceOptions{Dimensions: 1, Repair: true}); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if state, _ := db.GetIndexState("api"); state.CommitSHA != "" {
+		t.Errorf("состояние после исправления = %+v, ожидалось пустое", state)
+	}
+}
+
+func TestMoveAndDeleteBlocks(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "alpha"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	const filePath = "/src/app.py"
+	if err := db.SaveEmbedding(testBlock(filePath), []float64{0.5}, "text"); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	stored, err := db.GetFileBlocks(filePath)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("GetFileBlocks = %v (%v), ожидался один блок", stored, err)
+	}
+
+	// Блок из снимка не меняется: снимок сохраняет прежние строки
+	if _, err := db.CreateSnapshot(models.Snapshot{Label: "v1"}); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+
+	moved := testBlock(filePath)
+	moved.StartLine, moved.EndLine = 10, 14
+	if err := db.MoveBlock(stored[0].ID, moved, moved.GetEmbeddingText()); err != nil {
+		t.Fatalf("MoveBlock: %v", err)
+	}
+
+	current, _ := db.GetFileBlocks(filePath)
+	if len(current) != 1 || current[0].StartLine != 10 {
+		t.Fatalf("блоки после переноса = %v, ожидался блок на строке 10", current)
+	}
+	if vector, _ := db.GetVector(current[0].CodeBlock); len(vector) != 1 {
+		t.Errorf("перенесённый блок потерял вектор: %v", vector)
+	}
+
+	db.UseSnapshot("v1")
+	var snapshotLines []int
+	db.ForEachEmbedding(func(block *models.CodeBlock, _ []float64) error {
+		snapshotLines = append(snapshotLines, block.StartLine)
+		return nil
+	})
+	if len(snapshotLines) != 1 || snapshotLines[0] != 1 {
+		t.Errorf("строки блока в снимке = %v, ожидалась 1", snapshotLines)
+	}
+	db.UseSnapshot("")
+
+	// Без снимка блок переносится на месте
+	again := testBlock(filePath)
+	again.StartLine, again.EndLine = 20, 24
+	if err := db.MoveBlock(current[0].ID, again, again.GetEmbeddingText()); err != nil {
+		t.Fatalf("MoveBlock: %v", err)
+	}
+	if after, _ := db.GetFileBlocks(filePath); len(after) != 1 || after[0].ID != current[0].ID || after[0].StartLine != 20 {
+		t.Errorf("блоки после переноса на месте = %v, ожидался блок %d на строке 20", after, current[0].ID)
+	}
+
+	if err := db.DeleteBlocks([]int64{current[0].ID}); err != nil {
+		t.Fatalf("DeleteBlocks: %v", err)
+	}
+	if after, _ := db.GetFileBlocks(filePath); len(after) != 0 {
+		t.Errorf("блоки после удаления = %v, ожидался пустой файл", after)
+	}
+}
+
+func TestMoveBlockToRenamedFile(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "alpha"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	if err := db.SaveEmbedding(testBlock("/src/internal/foo/bar.py"), []float64{0.5}, "text"); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	stored, _ := db.GetFileBlocks("/src/internal/foo/bar.py")
+
+	// Переименование файла переписывает пути строки, не трогая её вектор
+	renamed := stored[0].CodeBlock
+	renamed.FilePath = "/src/pkg/bar.py"
+	renamed.SetRelativePath("pkg/bar.py")
+	if err := db.MoveBlock(stored[0].ID, renamed, renamed.GetEmbeddingText()); err != nil {
+		t.Fatalf("MoveBlock: %v", err)
+	}
+
+	if old, _ := db.GetFileBlocks("/src/internal/foo/bar.py"); len(old) != 0 {
+		t.Errorf("блоки по старому пути = %v, ожидался пустой файл", old)
+	}
+	current, _ := db.GetFileBlocks("/src/pkg/bar.py")
+	if len(current) != 1 || current[0].ID != stored[0].ID || current[0].RelativePath != "pkg/bar.py" {
+		t.Fatalf("блоки по новому пути = %v, ожидалась строка %d с путём pkg/bar.py", current, stored[0].ID)
+	}
+	if vector, _ := db.GetVector(current[0].CodeBlock); len(vector) != 1 {
+		t.Errorf("переименованный блок потерял вектор: %v", vector)
+	}
+}
+
+func TestLegacyDatabaseMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.sqlite3")
+
+	// Схема до появления проектов
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	statements := []string{
+		`CREATE TABLE embeddings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			embedding TEXT NOT NULL,
+			file_path TEXT NOT NULL,
+			relative_path TEXT NOT NULL,
+			block_type TEXT NOT NULL,
+			class_name TEXT,
+			method_name TEXT,
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			commit_messages TEXT,
+			raw_text TEXT NOT NULL,
+			embedding_text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE file_hashes (
+			file_path TEXT PRIMARY KEY,
+			file_hash TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO embeddings (embedding, file_path, relative_path, block_type, start_line, end_line, raw_text, embedding_text)
+		VALUES ('[0.5]', '/src/app.py', 'app.py', 'function', 1, 5, 'pass', 'text')`,
+		`INSERT INTO embeddings (embedding, file_path, relative_path, block_type, method_name, start_line, end_line, raw_text, embedding_text)
+		VALUES ('[0.1]', '/src/app.py', 'app.py', 'function', 'dup', 20, 22, 'pass  # 2', 'text'),
+			('[0.2]', '/src/app.py', 'app.py', 'function', 'dup', 10, 12, 'pass  # 1', 'text')`,
+		`INSERT INTO file_hashes (file_path, file_hash) VALUES ('/src/app.py', 'old-hash')`,
+	}
+	for _, statement := range statements {
+		if _, err := legacy.Exec(statement); err != nil {
+			t.Fatalf("подготовка старой схемы: %v", err)
+		}
+	}
+	legacy.Close()
+
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	// Первый проект забирает записи старой схемы
+	if err := db.UseProject(models.Project{Name: "legacy"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+	if hash, _ := db.GetFileHash("/src/app.py"); hash != "old-hash" {
+		t.Errorf("хеш после миграции = %q, ожидался old-hash", hash)
+	}
+	if states, _ := db.GetFileStates(); states["/src/app.py"].ModTime != 0 {
+		t.Errorf("состояние после миграции = %+v, ожидалось без времени изменения", states["/src/app.py"])
+	}
+	var migrated []float64
+	db.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		if block.MethodName == nil {
+			migrated = embedding
+		}
+		return nil
+	})
+	if len(migrated) != 1 || migrated[0] != 0.5 {
+		t.Errorf("эмбединг после миграции = %v, ожидался [0.5]", migrated)
+	}
+
+	// Одноимённые блоки файла нумеруются в порядке строк
+	blocks, _ := db.GetFileBlocks("/src/app.py")
+	ordinals := make(map[int]int)
+	for _, block := range blocks {
+		ordinals[block.StartLine] = block.Ordinal
+	}
+	if len(blocks) != 3 || ordinals[1] != 0 || ordinals[10] != 0 || ordinals[20] != 1 {
+		t.Errorf("номера блоков по строкам = %v, ожидалось 1→0, 10→0, 20→1", ordinals)
+	}
+
+	// Второй проект начинает с пустого пространства
+	if err := db.UseProject(models.Project{Name: "fresh"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+	if hash, _ := db.GetFileHash("/src/app.py"); hash != "" {
+		t.Errorf("новый проект видит чужой хеш %q", hash)
+	}
+	paths, _ := db.GetAllFilePaths()
+	if len(paths) != 0 {
+		t.Errorf("новый проект видит чужие файлы: %v", paths)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "repo"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	countBlocks := func() int {
+		count := 0
+		if err := db.ForEachEmbedding(func(*models.CodeBlock, []float64) error {
+			count++
+			return nil
+		}); err != nil {
+			t.Fatalf("ForEachEmbedding: %v", err)
+		}
+		return count
+	}
+	storedRows := func() int {
+		var count int
+		db.db.QueryRow("SELECT COUNT(*) FROM embeddings").Scan(&count)
+		return count
+	}
+
+	// Версия 1: два файла
+	db.SaveEmbedding(testBlock("/src/a.py"), []float64{1}, "a")
+	db.SaveEmbedding(testBlock("/src/b.py"), []float64{2}, "b")
+
+	first, err := db.CreateSnapshot(models.Snapshot{Label: "v1", CommitSHA: "abc123def456"})
+	if err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	if first.Blocks != 2 {
+		t.Errorf("в снимке v1 %d блоков, ожидалось 2", first.Blocks)
+	}
+
+	// Версия 2: a.py изменён, b.py переиндексирован без изменений
+	db.DeleteFileBlocks("/src/a.py")
+	changed := testBlock("/src/a.py")
+	changed.RawText = "def handler(): return 1"
+	db.SaveEmbedding(changed, []float64{3}, "a2")
+
+	db.DeleteFileBlocks("/src/b.py")
+	reused, err := db.ReuseBlock(testBlock("/src/b.py"))
+	if err != nil || !reused {
+		t.Fatalf("неизменённый блок не переиспользован: %v, %v", reused, err)
+	}
+
+	if _, err := db.CreateSnapshot(models.Snapshot{Label: "v2"}); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+
+	// Неизменённый блок общий для обоих снимков: 3 строки вместо 4
+	if rows := storedRows(); rows != 3 {
+		t.Errorf("в таблице %d строк, ожидалось 3", rows)
+	}
+	if blocks := countBlocks(); blocks != 2 {
+		t.Errorf("в текущем индексе %d блоков, ожидалось 2", blocks)
+	}
+
+	// Выбор снимка по префиксу SHA
+	if err := db.UseSnapshot("abc123"); err != nil {
+		t.Fatalf("UseSnapshot: %v", err)
+	}
+	var texts []string
+	db.ForEachEmbedding(func(block *models.CodeBlock, _ []float64) error {
+		texts = append(texts, block.RawText)
+		return nil
+	})
+	if len(texts) != 2 || texts[0] != "def handler(): pass" {
+		t.Errorf("снимок v1 содержит %v, ожидался старый текст a.py", texts)
+	}
+	if err := db.UseSnapshot("missing"); err == nil {
+		t.Error("ожидалась ошибка для несуществующего снимка")
+	}
+	db.UseSnapshot("")
+
+	// Пока снимок v1 жив, старая версия a.py не собирается
+	if removed, _ := db.CollectGarbage(); removed != 0 {
+		t.Errorf("сборка мусора удалила %d блоков при живом снимке", removed)
+	}
+
+	if err := db.DeleteSnapshot("v1"); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if removed, _ := db.CollectGarbage(); removed != 1 {
+		t.Errorf("сборка мусора удалила %d блоков, ожидался 1", removed)
+	}
+
+	snapshots, err := db.ListSnapshots()
+	if err != nil || len(snapshots) != 1 || snapshots[0].Label != "v2" || snapshots[0].Blocks != 2 {
+		t.Errorf("ListSnapshots = %+v (%v), ожидался только v2 с 2 блоками", snapshots, err)
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "repo"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	// У каждого файла своё тело, чтобы векторы не были общими
+	block := func(name string) *models.CodeBlock {
+		block := testBlock("/src/" + name + ".py")
+		block.RawText = "def " + name + "(): pass"
+		return block
+	}
+
+	// Корректный блок с хешем
+	db.SaveEmbedding(block("ok"), []float64{1, 2}, "ok")
+	db.UpdateFileHash("ok.py", "h1")
+	// Вектор неверной размерности и битый вектор
+	db.SaveEmbedding(block("short"), []float64{1}, "short")
+	db.UpdateFileHash("short.py", "h2")
+	broken := block("broken")
+	db.SaveBlockWithoutEmbedding(broken, "broken")
+	db.UpdateFileHash("broken.py", "h3")
+	db.db.Exec("INSERT INTO vectors (body_hash, vector) VALUES (?, '[1, oops')", broken.BodyHash())
+	// Хеш без блоков и блоки без хеша
+	db.UpdateFileHash("deleted.py", "h4")
+	db.SaveEmbedding(block("orphan"), []float64{1, 2}, "orphan")
+
+	report, err := db.Maintain(MaintenanceOptions{Dimensions: 2})
+	if err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"ошибки целостности", len(report.IntegrityErrors), 0},
+		{"битые векторы", len(report.MalformedVectors), 1},
+		{"векторы неверной размерности", len(report.WrongDimensionVectors), 1},
+		{"хеши без блоков", len(report.HashesWithoutBlocks), 1},
+		{"блоки без хешей", len(report.BlocksWithoutHashes), 1},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %d, ожидалось %d", tt.name, tt.got, tt.want)
+		}
+	}
+	if report.Repaired || report.SizeBefore == 0 || report.SizeAfter == 0 {
+		t.Errorf("неожиданный отчёт без исправления: %+v", report)
+	}
+
+	if report, err = db.Maintain(MaintenanceOptions{Dimensions: 2, Repair: true}); err != nil {
+		t.Fatalf("Maintain с исправлением: %v", err)
+	}
+	if !report.Repaired {
+		t.Error("отчёт не отмечен как исправленный")
+	}
+
+	// После исправления проблем нет, а битые векторы ждут повторной генерации
+	if report, err = db.Maintain(MaintenanceOptions{Dimensions: 2}); err != nil {
+		t.Fatalf("повторный Maintain: %v", err)
+	}
+	if report.Problems() != 0 {
+		t.Errorf("после исправления осталось проблем: %d (%+v)", report.Problems(), report)
+	}
+	blocks := pendingBlocks(t, db, 100)
+	if len(blocks) != 2 {
+		t.Errorf("блоков без эмбедингов %d, ожидалось 2", len(blocks))
+	}
+	if hash, _ := db.GetFileHash("deleted.py"); hash != "" {
+		t.Errorf("хеш удалённого файла не очищен: %q", hash)
+	}
+}
+
+func TestDeduplicatedVectors(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "repo"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	// Одно и то же тело в трёх файлах: копия с другим отступом и CRLF тоже совпадает
+	original := testBlock("/src/a.py")
+	original.RawText = "def handler():\n    return 1\n"
+	vendored := testBlock("/src/vendor/a.py")
+	vendored.RawText = original.RawText
+	vendored.RealPath = "/shared/vendor/a.py"
+	indented := testBlock("/src/b.py")
+	indented.RawText = "    def handler():\r\n        return 1  \r\n"
+
+	if err := db.SaveEmbedding(original, []float64{1, 2}, "a"); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	for _, block := range []*models.CodeBlock{vendored, indented} {
+		vector, err := db.GetVector(block)
+		if err != nil || len(vector) != 2 {
+			t.Fatalf("вектор для копии %s не найден: %v, %v", block.FilePath, vector, err)
+		}
+		if err := db.SaveBlockWithoutEmbedding(block, "copy"); err != nil {
+			t.Fatalf("SaveBlockWithoutEmbedding: %v", err)
+		}
+	}
+
+	var vectors int
+	db.db.QueryRow("SELECT COUNT(*) FROM vectors").Scan(&vectors)
+	if vectors != 1 {
+		t.Errorf("в таблице vectors %d строк, ожидалась 1", vectors)
+	}
+
+	// Все вхождения получают общий вектор
+	count := 0
+	db.ForEachEmbedding(func(block *models.CodeBlock, embedding []float64) error {
+		if len(embedding) != 2 {
+			t.Errorf("блок %s получил вектор %v", block.FilePath, embedding)
+		}
+		count++
+		return nil
+	})
+	if count != 3 {
+		t.Errorf("с эмбедингами %d блоков, ожидалось 3", count)
+	}
+	if blocks := pendingBlocks(t, db, 100); len(blocks) != 0 {
+		t.Errorf("блоков без эмбедингов %d, ожидалось 0", len(blocks))
+	}
+
+	stats, err := db.GetStatistics()
+	if err != nil {
+		t.Fatalf("GetStatistics: %v", err)
+	}
+	if stats["unique_vectors"] != 1 || stats["deduplicated_blocks"] != 2 {
+		t.Errorf("статистика дедупликации: %v уникальных, %v сэкономлено", stats["unique_vectors"], stats["deduplicated_blocks"])
+	}
+
+	groups, err := db.FindDuplicates(10)
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Blocks) != 3 || groups[0].BodyHash != original.BodyHash() {
+		t.Errorf("FindDuplicates = %+v, ожидалась одна группа из 3 мест", groups)
+	}
+
+	// Для файла за символической ссылкой сохраняется и путь ссылки, и реальный путь
+	occurrences, err := db.FindOccurrences(original.BodyHash())
+	if err != nil {
+		t.Fatalf("FindOccurrences: %v", err)
+	}
+	for _, block := range occurrences {
+		want := ""
+		if block.FilePath == vendored.FilePath {
+			want = vendored.RealPath
+		}
+		if block.RealPath != want {
+			t.Errorf("%s: RealPath = %q, ожидалось %q", block.FilePath, block.RealPath, want)
+		}
+	}
+
+	// Вектор живёт, пока на него ссылается хотя бы один блок
+	for _, path := range []string{"/src/a.py", "/src/vendor/a.py"} {
+		db.DeleteFileBlocks(path)
+	}
+	db.CollectGarbage()
+	if vector, _ := db.GetVector(original); vector == nil {
+		t.Error("общий вектор удалён, хотя b.py на него ссылается")
+	}
+	db.DeleteFileBlocks("/src/b.py")
+	db.CollectGarbage()
+	if vector, _ := db.GetVector(original); vector != nil {
+		t.Error("вектор без ссылок не удалён сборкой мусора")
+	}
+}
+
+func TestForEachBlockWithoutEmbeddings(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "kb.sqlite3"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UseProject(models.Project{Name: "repo"}); err != nil {
+		t.Fatalf("UseProject: %v", err)
+	}
+
+	// Семь разных блоков, у третьего эмбединг уже есть
+	for i := 0; i < 7; i++ {
+		block := testBlock(fmt.Sprintf("/src/file%d.py", i))
+		block.RawText = fmt.Sprintf("def handler(): return %d", i)
+		if i == 2 {
+			db.SaveEmbedding(block, []float64{1}, "done")
+			continue
+		}
+		db.SaveBlockWithoutEmbedding(block, "pending")
+	}
+
+	if count, err := db.CountBlocksWithoutEmbeddings(); err != nil || count != 6 {
+		t.Errorf("CountBlocksWithoutEmbeddings = %d (%v), ожидалось 6", count, err)
+	}
+
+	tests := []struct {
+		name     string
+		pageSize int
+		pages    int
+	}{
+		{"страницы меньше очереди", 4, 2},
+		{"очередь делится нацело", 3, 2},
+		{"одна страница", 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, total := 0, 0
+			err := db.ForEachBlockWithoutEmbeddings(tt.pageSize, func(page []*models.CodeBlock) error {
+				pages++
+				total += len(page)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ForEachBlockWithoutEmbeddings: %v", err)
+			}
+			if pages != tt.pages || total != 6 {
+				t.Errorf("страниц %d, блоков %d; ожидалось %d страниц и 6 блоков", pages, total, tt.pages)
+			}
+		})
+	}
+
+	// Эмбединги, сохранённые во время обхода, не сбивают курсор
+	var seen []string
+	err = db.ForEachBlockWithoutEmbeddings(2, func(page []*models.CodeBlock) error {
+		for _, block := range page {
+			seen = append(seen, block.FilePath)
+			if err := db.UpdateEmbedding(block, []float64{1}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("обход с обновлением: %v", err)
+	}
+	if len(seen) != 6 || seen[0] != "/src/file0.py" || seen[5] != "/src/file6.py" {
+		t.Errorf("обход с обновлением вернул %v", seen)
+	}
+	if count, _ := db.CountBlocksWithoutEmbeddings(); count != 0 {
+		t.Errorf("после обхода осталось %d блоков без эмбедингов", count)
+	}
+}
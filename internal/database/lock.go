@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLocked возвращается lockFile, когда файл уже заблокирован другим владельцем
+var errLocked = errors.New("файл заблокирован")
+
+// RunInProgressError возвращается, когда базу уже изменяет другой процесс
+type RunInProgressError struct {
+	PID      int
+	LockPath string
+}
+
+// Error возвращает текст ошибки
+func (e *RunInProgressError) Error() string {
+	if e.PID <= 0 {
+		return fmt.Sprintf("индексация уже выполняется другим процессом (блокировка %s)", e.LockPath)
+	}
+	return fmt.Sprintf("индексация уже выполняется процессом PID %d (блокировка %s)", e.PID, e.LockPath)
+}
+
+// RunLock рекомендательная блокировка записи в базу: блокировка ОС (flock, LockFileEx)
+// на файле <DB_PATH>.lock. PID владельца в файле нужен только для сообщения об ошибке.
+type RunLock struct {
+	path string
+	file *os.File
+}
+
+// LockPath возвращает путь файла блокировки для базы
+func LockPath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// AcquireRunLock захватывает блокировку записи для базы.
+// Блокировку ОС снимает сама система при завершении процесса, поэтому файл,
+// оставшийся от упавшего запуска, не мешает следующему.
+func AcquireRunLock(dbPath string) (*RunLock, error) {
+	path := LockPath(dbPath)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла блокировки %s: %w", path, err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLocked) {
+			// PID может быть ещё не записан владельцем — тогда ошибка без PID
+			pid, _ := readLockPID(path)
+			return nil, &RunInProgressError{PID: pid, LockPath: path}
+		}
+		return nil, fmt.Errorf("ошибка захвата блокировки %s: %w", path, err)
+	}
+
+	if err := writeLockPID(file); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, fmt.Errorf("ошибка записи файла блокировки %s: %w", path, err)
+	}
+
+	return &RunLock{path: path, file: file}, nil
+}
+
+// Release снимает блокировку. Файл не удаляется: иначе процесс, успевший открыть
+// его до удаления, и процесс, создавший новый, могли бы оба считать себя владельцами.
+func (l *RunLock) Release() error {
+	// Пустой файл — признак того, что блокировка свободна
+	truncErr := l.file.Truncate(0)
+	unlockErr := unlockFile(l.file)
+	closeErr := l.file.Close()
+	if err := errors.Join(truncErr, unlockErr, closeErr); err != nil {
+		return fmt.Errorf("ошибка снятия блокировки %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// writeLockPID записывает PID текущего процесса в захваченный файл блокировки
+func writeLockPID(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+// readLockPID читает PID владельца из файла блокировки
+func readLockPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("некорректный PID в файле блокировки %s", path)
+	}
+	return pid, nil
+}
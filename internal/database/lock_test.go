@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "kb.sqlite3")
+
+	lock, err := AcquireRunLock(dbPath)
+	if err != nil {
+		t.Fatalf("AcquireRunLock: %v", err)
+	}
+
+	// Второй писатель получает понятную ошибку с PID владельца
+	_, err = AcquireRunLock(dbPath)
+	var inProgress *RunInProgressError
+	if !errors.As(err, &inProgress) {
+		t.Fatalf("ожидалась RunInProgressError, получено: %v", err)
+	}
+	if inProgress.PID != os.Getpid() {
+		t.Errorf("PID владельца %d, ожидался %d", inProgress.PID, os.Getpid())
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	// Файл с PID завершившегося процесса без блокировки ОС не мешает захвату
+	if err := os.WriteFile(LockPath(dbPath), []byte("999999999\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	lock, err = AcquireRunLock(dbPath)
+	if err != nil {
+		t.Fatalf("устаревшая блокировка не снята: %v", err)
+	}
+	if pid, err := readLockPID(LockPath(dbPath)); err != nil || pid != os.Getpid() {
+		t.Errorf("PID в файле блокировки %d (%v), ожидался %d", pid, err, os.Getpid())
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	// После Release PID владельца из файла убран
+	if pid, err := readLockPID(LockPath(dbPath)); err == nil {
+		t.Errorf("в файле блокировки после Release остался PID %d", pid)
+	}
+}
+
+func TestWALReadDuringWrite(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "kb.sqlite3")
+
+	writer, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer writer.Close()
+
+	var mode string
+	if err := writer.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q (%v), ожидался wal", mode, err)
+	}
+
+	writer.SaveEmbedding(testBlock("/src/a.py"), []float64{1}, "a")
+
+	// Незавершённая транзакция записи не мешает читателю из другого подключения
+	tx, err := writer.db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE embeddings SET raw_text = 'changed'"); err != nil {
+		t.Fatalf("UPDATE: %v", err)
+	}
+
+	reader, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("NewDatabase для читателя: %v", err)
+	}
+	defer reader.Close()
+
+	stats, err := reader.GetStatistics()
+	if err != nil {
+		t.Fatalf("чтение во время записи: %v", err)
+	}
+	if stats["total_blocks"] != 1 {
+		t.Errorf("читатель видит %v блоков, ожидался 1", stats["total_blocks"])
+	}
+}
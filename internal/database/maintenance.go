@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// MaintenanceOptions параметры обслуживания базы данных
+type MaintenanceOptions struct {
+	// Dimensions ожидаемая размерность эмбедингов
+	Dimensions int
+
+	// Repair исправляет найденные проблемы: битые векторы удаляются для повторной генерации,
+	// хеши без блоков и блоки без хешей удаляются, чтобы файлы переиндексировались
+	Repair bool
+}
+
+// FileRef файл проекта, найденный при проверке
+type FileRef struct {
+	Project string
+	Path    string
+}
+
+// MaintenanceReport результат обслуживания базы данных
+type MaintenanceReport struct {
+	SizeBefore int64
+	SizeAfter  int64
+
+	// IntegrityErrors сообщения проверки целостности (пусто, если всё в порядке)
+	IntegrityErrors []string
+
+	// MalformedVectors хеши тел с нечитаемым вектором
+	MalformedVectors []string
+
+	// WrongDimensionVectors хеши тел с вектором неверной размерности
+	WrongDimensionVectors []string
+
+	// HashesWithoutBlocks записи file_hashes, для которых нет блоков в текущем индексе
+	HashesWithoutBlocks []FileRef
+
+	// BlocksWithoutHashes файлы с блоками в текущем индексе, для которых нет записи file_hashes
+	BlocksWithoutHashes []FileRef
+
+	// Repaired признак того, что найденные проблемы исправлены
+	Repaired bool
+}
+
+// Problems возвращает общее количество найденных проблем
+func (r *MaintenanceReport) Problems() int {
+	return len(r.IntegrityErrors) + len(r.MalformedVectors) + len(r.WrongDimensionVectors) +
+		len(r.HashesWithoutBlocks) + len(r.BlocksWithoutHashes)
+}
+
+// repairedProjects возвращает проекты с исправленными файлами без повторов.
+// Исправленные файлы не попадут в git diff, поэтому такие проекты при следующем запуске проверяются полностью.
+func (r *MaintenanceReport) repairedProjects() []string {
+	seen := make(map[string]bool)
+	var projects []string
+	for _, ref := range append(append([]FileRef(nil), r.HashesWithoutBlocks...), r.BlocksWithoutHashes...) {
+		if !seen[ref.Project] {
+			seen[ref.Project] = true
+			projects = append(projects, ref.Project)
+		}
+	}
+	return projects
+}
+
+// checkVectors обходит строки "body_hash, vector" и раскладывает битые векторы по отчёту
+func checkVectors(rows *sql.Rows, dimensions int, report *MaintenanceReport) error {
+	for rows.Next() {
+		var bodyHash string
+		var embeddingText string
+		if err := rows.Scan(&bodyHash, &embeddingText); err != nil {
+			return fmt.Errorf("ошибка сканирования эмбединга: %w", err)
+		}
+
+		var embedding []float64
+		if err := json.Unmarshal([]byte(embeddingText), &embedding); err != nil || !finiteVector(embedding) {
+			report.MalformedVectors = append(report.MalformedVectors, bodyHash)
+			continue
+		}
+		if dimensions > 0 && len(embedding) != dimensions {
+			report.WrongDimensionVectors = append(report.WrongDimensionVectors, bodyHash)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении эмбедингов: %w", err)
+	}
+	return nil
+}
+
+// finiteVector проверяет, что вектор не пуст и не содержит NaN и бесконечностей
+func finiteVector(embedding []float64) bool {
+	if len(embedding) == 0 {
+		return false
+	}
+	for _, value := range embedding {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanFileRefs читает строки "project, path"
+func scanFileRefs(rows *sql.Rows) ([]FileRef, error) {
+	defer rows.Close()
+
+	var refs []FileRef
+	for rows.Next() {
+		var ref FileRef
+		if err := rows.Scan(&ref.Project, &ref.Path); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования файла: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
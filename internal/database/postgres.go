@@ -0,0 +1,1126 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gokb-embedder/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// DefaultEmbeddingDimensions размерность эмбедингов text-embedding-3-small
+const DefaultEmbeddingDimensions = 1536
+
+// PostgresDatabase хранилище на PostgreSQL с расширением pgvector
+type PostgresDatabase struct {
+	db         *sql.DB
+	dimensions int
+
+	// project имя текущего проекта, которым ограничены все запросы
+	project string
+
+	// snapshot идентификатор выбранного для чтения снимка (0 - текущий индекс)
+	snapshot int64
+}
+
+var _ Storage = (*PostgresDatabase)(nil)
+
+// NewPostgresDatabase создаёт новое подключение к PostgreSQL
+func NewPostgresDatabase(dsn string, dimensions int) (*PostgresDatabase, error) {
+	if dimensions <= 0 {
+		dimensions = DefaultEmbeddingDimensions
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы данных PostgreSQL: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка подключения к PostgreSQL: %w", err)
+	}
+
+	database := &PostgresDatabase{db: db, dimensions: dimensions}
+	if err := database.initTables(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка инициализации таблиц: %w", err)
+	}
+
+	return database, nil
+}
+
+// Close закрывает подключение к базе данных
+func (p *PostgresDatabase) Close() error {
+	return p.db.Close()
+}
+
+// initTables создаёт расширение vector, таблицы и индексы
+func (p *PostgresDatabase) initTables() error {
+	statements := []struct {
+		name  string
+		query string
+	}{
+		{"расширения vector", `CREATE EXTENSION IF NOT EXISTS vector`},
+		{"таблицы embeddings", fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS embeddings (
+			id BIGSERIAL PRIMARY KEY,
+			project TEXT NOT NULL DEFAULT '',
+			embedding vector(%d),
+			file_path TEXT NOT NULL,
+			relative_path TEXT NOT NULL,
+			real_path TEXT NOT NULL DEFAULT '',
+			block_type TEXT NOT NULL,
+			class_name TEXT NOT NULL DEFAULT '',
+			method_name TEXT NOT NULL DEFAULT '',
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			ordinal INTEGER NOT NULL DEFAULT 0,
+			commit_messages TEXT,
+			raw_text TEXT NOT NULL,
+			embedding_text TEXT NOT NULL,
+			content_hash TEXT NOT NULL DEFAULT '',
+			body_hash TEXT NOT NULL DEFAULT '',
+			live BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMPTZ DEFAULT now()
+		)`, p.dimensions)},
+		{"таблицы vectors", fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS vectors (
+			body_hash TEXT PRIMARY KEY,
+			vector vector(%d) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now()
+		)`, p.dimensions)},
+		{"таблицы file_hashes", `
+		CREATE TABLE IF NOT EXISTS file_hashes (
+			project TEXT NOT NULL DEFAULT '',
+			file_path TEXT NOT NULL,
+			file_hash TEXT NOT NULL,
+			size BIGINT NOT NULL DEFAULT 0,
+			mtime BIGINT NOT NULL DEFAULT 0,
+			inode BIGINT NOT NULL DEFAULT 0,
+			updated_at TIMESTAMPTZ DEFAULT now(),
+			PRIMARY KEY (project, file_path)
+		)`},
+		{"таблицы projects", `
+		CREATE TABLE IF NOT EXISTS projects (
+			name TEXT PRIMARY KEY,
+			root TEXT NOT NULL,
+			remote_url TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ DEFAULT now()
+		)`},
+		{"таблицы snapshots", `
+		CREATE TABLE IF NOT EXISTS snapshots (
+			id BIGSERIAL PRIMARY KEY,
+			project TEXT NOT NULL,
+			label TEXT NOT NULL,
+			commit_sha TEXT NOT NULL DEFAULT '',
+			branch TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ DEFAULT now(),
+			UNIQUE (project, label)
+		)`},
+		{"таблицы index_states", `
+		CREATE TABLE IF NOT EXISTS index_states (
+			project TEXT NOT NULL,
+			root TEXT NOT NULL DEFAULT '',
+			commit_sha TEXT NOT NULL,
+			dirty_paths TEXT NOT NULL DEFAULT '[]',
+			settings TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ DEFAULT now(),
+			PRIMARY KEY (project, root)
+		)`},
+		{"таблицы snapshot_blocks", `
+		CREATE TABLE IF NOT EXISTS snapshot_blocks (
+			snapshot_id BIGINT NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+			block_id BIGINT NOT NULL,
+			PRIMARY KEY (snapshot_id, block_id)
+		)`},
+		// Миграция таблиц, созданных до поддержки нескольких проектов
+		{"колонки embeddings.project", `ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS project TEXT NOT NULL DEFAULT ''`},
+		{"колонки file_hashes.project", `ALTER TABLE file_hashes ADD COLUMN IF NOT EXISTS project TEXT NOT NULL DEFAULT ''`},
+		{"первичного ключа file_hashes", `
+		DO $$
+		BEGIN
+			IF (SELECT COUNT(*) FROM information_schema.key_column_usage
+				WHERE table_name = 'file_hashes' AND constraint_name = 'file_hashes_pkey') = 1 THEN
+				ALTER TABLE file_hashes DROP CONSTRAINT file_hashes_pkey;
+				ALTER TABLE file_hashes ADD PRIMARY KEY (project, file_path);
+			END IF;
+		END $$`},
+		// Миграция таблиц, созданных до поддержки снимков
+		{"колонки embeddings.content_hash", `ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT ''`},
+		{"колонки embeddings.live", `ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS live BOOLEAN NOT NULL DEFAULT TRUE`},
+		{"колонки embeddings.real_path", `ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS real_path TEXT NOT NULL DEFAULT ''`},
+		{"индекса по file_path", `CREATE INDEX IF NOT EXISTS embeddings_project_file_path_idx
+			ON embeddings (project, file_path)`},
+		// Миграция таблиц, созданных до общих векторов: поиск идёт по vectors
+		{"колонки embeddings.body_hash", `ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS body_hash TEXT NOT NULL DEFAULT ''`},
+		{"старого HNSW индекса", `DROP INDEX IF EXISTS embeddings_embedding_hnsw_idx`},
+		{"HNSW индекса", `CREATE INDEX IF NOT EXISTS vectors_vector_hnsw_idx
+			ON vectors USING hnsw (vector vector_cosine_ops)`},
+		{"индекса по body_hash", `CREATE INDEX IF NOT EXISTS embeddings_body_hash_idx
+			ON embeddings (body_hash)`},
+		{"индекса snapshot_blocks", `CREATE INDEX IF NOT EXISTS snapshot_blocks_block_id_idx
+			ON snapshot_blocks (block_id)`},
+		// Миграция таблиц, созданных до быстрой проверки изменений по stat
+		{"колонки file_hashes.size", `ALTER TABLE file_hashes ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0`},
+		{"колонки file_hashes.mtime", `ALTER TABLE file_hashes ADD COLUMN IF NOT EXISTS mtime BIGINT NOT NULL DEFAULT 0`},
+		{"колонки file_hashes.inode", `ALTER TABLE file_hashes ADD COLUMN IF NOT EXISTS inode BIGINT NOT NULL DEFAULT 0`},
+	}
+
+	for _, stmt := range statements {
+		if _, err := p.db.Exec(stmt.query); err != nil {
+			return fmt.Errorf("ошибка создания %s: %w", stmt.name, err)
+		}
+	}
+
+	if err := p.migrateOrdinals(); err != nil {
+		return err
+	}
+
+	return p.migrateVectors()
+}
+
+// migrateOrdinals добавляет колонку ordinal и нумерует одноимённые блоки файлов, сохранённые до её появления
+func (p *PostgresDatabase) migrateOrdinals() error {
+	var exists bool
+	err := p.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'embeddings' AND column_name = 'ordinal')`).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки колонки embeddings.ordinal: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := p.db.Exec(`ALTER TABLE embeddings ADD COLUMN ordinal INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("ошибка создания колонки embeddings.ordinal: %w", err)
+	}
+	if _, err := p.db.Exec(backfillOrdinalsSQL); err != nil {
+		return fmt.Errorf("ошибка нумерации блоков: %w", err)
+	}
+	return nil
+}
+
+// migrateVectors переносит эмбединги, хранившиеся в строках embeddings, в общую таблицу vectors.
+// Блоки с одинаковым нормализованным телом после миграции ссылаются на один вектор.
+func (p *PostgresDatabase) migrateVectors() error {
+	rows, err := p.db.Query("SELECT id, raw_text, embedding::text FROM embeddings WHERE body_hash = ''")
+	if err != nil {
+		return fmt.Errorf("ошибка миграции векторов: %w", err)
+	}
+	legacy, err := scanLegacyVectors(rows)
+	if err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка миграции векторов: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, row := range legacy {
+		if _, err := tx.Exec("UPDATE embeddings SET body_hash = $1, embedding = NULL WHERE id = $2",
+			row.bodyHash, row.id); err != nil {
+			return fmt.Errorf("ошибка миграции векторов: %w", err)
+		}
+		if row.vector == "" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO vectors (body_hash, vector) VALUES ($1, $2::vector)
+			ON CONFLICT (body_hash) DO NOTHING`, row.bodyHash, row.vector); err != nil {
+			return fmt.Errorf("ошибка миграции векторов: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseProject регистрирует проект и ограничивает им все последующие запросы.
+// Записи, сохранённые до появления проектов, переходят к первому зарегистрированному проекту.
+func (p *PostgresDatabase) UseProject(project models.Project) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+	defer tx.Rollback()
+
+	var projectCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM projects").Scan(&projectCount); err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO projects (name, root, remote_url, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (name) DO UPDATE
+		SET root = EXCLUDED.root, remote_url = EXCLUDED.remote_url, updated_at = EXCLUDED.updated_at`,
+		project.Name, project.Root, project.RemoteURL)
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	if projectCount == 0 {
+		for _, table := range []string{"embeddings", "file_hashes"} {
+			query := fmt.Sprintf("UPDATE %s SET project = $1 WHERE project = ''", table)
+			if _, err := tx.Exec(query, project.Name); err != nil {
+				return fmt.Errorf("ошибка переноса записей в проект %s: %w", project.Name, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка регистрации проекта: %w", err)
+	}
+
+	p.project = project.Name
+	p.snapshot = 0
+	return nil
+}
+
+// ListProjects возвращает все проекты в базе данных
+func (p *PostgresDatabase) ListProjects() ([]models.Project, error) {
+	rows, err := p.db.Query("SELECT name, root, remote_url FROM projects ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка проектов: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var project models.Project
+		if err := rows.Scan(&project.Name, &project.Root, &project.RemoteURL); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования проекта: %w", err)
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, rows.Err()
+}
+
+// SaveEmbedding сохраняет блок и общий вектор его тела
+func (p *PostgresDatabase) SaveEmbedding(block *models.CodeBlock, embedding []float64, embeddingText string) error {
+	if err := p.saveVector(block.BodyHash(), embedding); err != nil {
+		return err
+	}
+
+	return p.insertBlock(block, embeddingText)
+}
+
+// SaveBlockWithoutEmbedding сохраняет блок кода без эмбединга
+func (p *PostgresDatabase) SaveBlockWithoutEmbedding(block *models.CodeBlock, embeddingText string) error {
+	return p.insertBlock(block, embeddingText)
+}
+
+// saveVector сохраняет вектор тела блока (существующий вектор заменяется)
+func (p *PostgresDatabase) saveVector(bodyHash string, embedding []float64) error {
+	vector, err := p.formatVector(embedding)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`INSERT INTO vectors (body_hash, vector) VALUES ($1, $2::vector)
+		ON CONFLICT (body_hash) DO UPDATE SET vector = EXCLUDED.vector`, bodyHash, vector)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения вектора: %w", err)
+	}
+	return nil
+}
+
+// insertBlock вставляет блок текущего проекта; вектор хранится отдельно в таблице vectors
+func (p *PostgresDatabase) insertBlock(block *models.CodeBlock, embeddingText string) error {
+	commitMessagesJSON, err := marshalCommitMessages(block.CommitMessages)
+	if err != nil {
+		return err
+	}
+
+	className, methodName := blockNames(block)
+
+	query := `
+	INSERT INTO embeddings
+	(project, file_path, relative_path, real_path, block_type, class_name, method_name,
+	 start_line, end_line, ordinal, commit_messages, raw_text, embedding_text, content_hash, body_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+
+	_, err = p.db.Exec(query,
+		p.project,
+		block.FilePath,
+		block.GetRelativePath(),
+		block.RealPath,
+		block.BlockType,
+		className,
+		methodName,
+		block.StartLine,
+		block.EndLine,
+		block.Ordinal,
+		commitMessagesJSON,
+		block.RawText,
+		embeddingText,
+		block.ContentHash(),
+		block.BodyHash(),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка вставки блока: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateEmbedding обновляет общий вектор тела существующего блока
+func (p *PostgresDatabase) UpdateEmbedding(block *models.CodeBlock, embedding []float64) error {
+	className, methodName := blockNames(block)
+
+	var bodyHash string
+	err := p.db.QueryRow(`
+		SELECT body_hash FROM embeddings
+		WHERE project = $1 AND live AND file_path = $2 AND class_name = $3 AND method_name = $4
+		AND start_line = $5 AND end_line = $6 AND block_type = $7
+		LIMIT 1`,
+		p.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+	).Scan(&bodyHash)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("блок не найден для обновления")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка обновления эмбединга: %w", err)
+	}
+
+	return p.saveVector(bodyHash, embedding)
+}
+
+// BlockExists проверяет, существует ли блок с такими параметрами
+func (p *PostgresDatabase) BlockExists(block *models.CodeBlock) (bool, error) {
+	className, methodName := blockNames(block)
+
+	var exists bool
+	err := p.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM embeddings
+			WHERE project = $1 AND live AND file_path = $2 AND class_name = $3 AND method_name = $4
+			AND start_line = $5 AND end_line = $6 AND block_type = $7
+		)`,
+		p.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки существования блока: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetVector возвращает общий вектор тела блока (nil, если его ещё нет)
+func (p *PostgresDatabase) GetVector(block *models.CodeBlock) ([]float64, error) {
+	var vectorText string
+	err := p.db.QueryRow("SELECT vector::text FROM vectors WHERE body_hash = $1", block.BodyHash()).Scan(&vectorText)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения вектора: %w", err)
+	}
+
+	var embedding []float64
+	if err := json.Unmarshal([]byte(vectorText), &embedding); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации вектора блока %s: %w", block, err)
+	}
+	return embedding, nil
+}
+
+// FindOccurrences возвращает все блоки текущего индекса с данным хешем тела
+func (p *PostgresDatabase) FindOccurrences(bodyHash string) ([]*models.CodeBlock, error) {
+	scope, arg := p.readScope()
+	rows, err := p.db.Query(`
+		SELECT `+blockColumns+`
+		FROM embeddings
+		WHERE `+scope+` AND body_hash = $2
+		ORDER BY file_path, start_line`, arg, bodyHash)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска вхождений: %w", err)
+	}
+	return scanBlocks(rows)
+}
+
+// FindDuplicates возвращает группы одинаковых тел текущего индекса, самые частые первыми
+func (p *PostgresDatabase) FindDuplicates(limit int) ([]DuplicateGroup, error) {
+	scope, arg := p.readScope()
+	rows, err := p.db.Query(`
+		SELECT body_hash FROM embeddings
+		WHERE `+scope+` AND body_hash != ''
+		GROUP BY body_hash HAVING COUNT(*) > 1
+		ORDER BY COUNT(*) DESC, body_hash
+		LIMIT $2`, arg, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+	hashes, err := scanStrings(rows)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска дубликатов: %w", err)
+	}
+
+	groups := make([]DuplicateGroup, 0, len(hashes))
+	for _, hash := range hashes {
+		blocks, err := p.FindOccurrences(hash)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, DuplicateGroup{BodyHash: hash, Blocks: blocks})
+	}
+	return groups, nil
+}
+
+// CountBlocksWithoutEmbeddings возвращает количество блоков текущего индекса без вектора
+func (p *PostgresDatabase) CountBlocksWithoutEmbeddings() (int, error) {
+	var count int
+	err := p.db.QueryRow(`SELECT COUNT(*) FROM embeddings
+		WHERE project = $1 AND live AND NOT `+hasVectorSQL, p.project).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества блоков без эмбедингов: %w", err)
+	}
+	return count, nil
+}
+
+// ForEachBlockWithoutEmbeddings обходит блоки без вектора страницами в порядке ID (keyset-пагинация)
+func (p *PostgresDatabase) ForEachBlockWithoutEmbeddings(pageSize int, fn func(page []*models.CodeBlock) error) error {
+	var lastID int64
+	for {
+		rows, err := p.db.Query(`
+			SELECT `+blockColumns+`, id
+			FROM embeddings
+			WHERE project = $1 AND live AND id > $2 AND NOT `+hasVectorSQL+`
+			ORDER BY id
+			LIMIT $3`, p.project, lastID, pageSize)
+		if err != nil {
+			return fmt.Errorf("ошибка получения блоков без эмбедингов: %w", err)
+		}
+
+		page, pageLastID, err := scanBlockPage(rows)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		lastID = pageLastID
+	}
+}
+
+// ForEachEmbedding вызывает fn для каждого блока с эмбедингом.
+// Блоки с одинаковым телом получают один и тот же общий вектор.
+func (p *PostgresDatabase) ForEachEmbedding(fn func(block *models.CodeBlock, embedding []float64) error) error {
+	scope, arg := p.readScope()
+	rows, err := p.db.Query(`
+		SELECT `+blockColumns+`, v.vector::text
+		FROM embeddings
+		JOIN vectors v ON v.body_hash = embeddings.body_hash
+		WHERE `+scope+`
+		ORDER BY file_path, start_line`, arg)
+	if err != nil {
+		return fmt.Errorf("ошибка получения блоков с эмбедингами: %w", err)
+	}
+	defer rows.Close()
+
+	return forEachEmbeddingRow(rows, fn)
+}
+
+// GetFileHash возвращает хеш файла из базы данных
+func (p *PostgresDatabase) GetFileHash(filePath string) (string, error) {
+	var hash string
+	err := p.db.QueryRow("SELECT file_hash FROM file_hashes WHERE project = $1 AND file_path = $2",
+		p.project, filePath).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения хеша файла: %w", err)
+	}
+	return hash, nil
+}
+
+// GetFileHashes возвращает хеши всех файлов текущего проекта по путям
+func (p *PostgresDatabase) GetFileHashes() (map[string]string, error) {
+	rows, err := p.db.Query("SELECT file_path, file_hash FROM file_hashes WHERE project = $1", p.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения хешей файлов: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFileHashes(rows)
+}
+
+// UpdateFileHash обновляет хеш файла в базе данных
+func (p *PostgresDatabase) UpdateFileHash(filePath, hash string) error {
+	return p.UpdateFileState(models.FileState{Path: filePath, Hash: hash})
+}
+
+// GetFileStates возвращает хеши и данные stat всех файлов текущего проекта по путям
+func (p *PostgresDatabase) GetFileStates() (map[string]models.FileState, error) {
+	rows, err := p.db.Query("SELECT "+fileStateColumns+" FROM file_hashes WHERE project = $1", p.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения состояний файлов: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFileStates(rows)
+}
+
+// UpdateFileState сохраняет хеш и данные stat файла
+func (p *PostgresDatabase) UpdateFileState(state models.FileState) error {
+	_, err := p.db.Exec(`
+		INSERT INTO file_hashes (project, file_path, file_hash, size, mtime, inode, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, now())
+		ON CONFLICT (project, file_path) DO UPDATE
+		SET file_hash = EXCLUDED.file_hash, size = EXCLUDED.size, mtime = EXCLUDED.mtime,
+			inode = EXCLUDED.inode, updated_at = EXCLUDED.updated_at`,
+		p.project, state.Path, state.Hash, state.Size, state.ModTime, int64(state.Inode),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления хеша файла: %w", err)
+	}
+	return nil
+}
+
+// DeleteFileHash удаляет сохранённый хеш файла
+func (p *PostgresDatabase) DeleteFileHash(filePath string) error {
+	_, err := p.db.Exec("DELETE FROM file_hashes WHERE project = $1 AND file_path = $2", p.project, filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления хеша файла: %w", err)
+	}
+	return nil
+}
+
+// GetIndexState возвращает состояние индексации корня текущего проекта
+func (p *PostgresDatabase) GetIndexState(root string) (models.IndexState, error) {
+	row := p.db.QueryRow("SELECT commit_sha, dirty_paths, settings FROM index_states WHERE project = $1 AND root = $2",
+		p.project, root)
+	return scanIndexState(row, root)
+}
+
+// SaveIndexState сохраняет состояние индексации корня текущего проекта
+func (p *PostgresDatabase) SaveIndexState(state models.IndexState) error {
+	dirtyPaths, err := marshalDirtyPaths(state.DirtyPaths)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+		INSERT INTO index_states (project, root, commit_sha, dirty_paths, settings, updated_at)
+		VALUES ($1, $2, $3, $4, $5, now())
+		ON CONFLICT (project, root) DO UPDATE
+		SET commit_sha = EXCLUDED.commit_sha, dirty_paths = EXCLUDED.dirty_paths,
+			settings = EXCLUDED.settings, updated_at = EXCLUDED.updated_at`,
+		p.project, state.Root, state.CommitSHA, dirtyPaths, state.Settings)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния индексации: %w", err)
+	}
+	return nil
+}
+
+// DeleteFileBlocks удаляет блоки файла из текущего индекса.
+// Блоки, входящие в снимки, остаются в базе и только исключаются из текущего индекса.
+func (p *PostgresDatabase) DeleteFileBlocks(filePath string) error {
+	_, err := p.db.Exec(`DELETE FROM embeddings e
+		WHERE e.project = $1 AND e.file_path = $2 AND e.live
+		AND NOT EXISTS (SELECT 1 FROM snapshot_blocks sb WHERE sb.block_id = e.id)`, p.project, filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков файла: %w", err)
+	}
+
+	_, err = p.db.Exec("UPDATE embeddings SET live = FALSE WHERE project = $1 AND file_path = $2 AND live",
+		p.project, filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков файла: %w", err)
+	}
+	return nil
+}
+
+// GetFileBlocks возвращает блоки файла из текущего индекса в порядке строк
+func (p *PostgresDatabase) GetFileBlocks(filePath string) ([]StoredBlock, error) {
+	rows, err := p.db.Query(`
+		SELECT `+blockColumns+`, id
+		FROM embeddings
+		WHERE project = $1 AND live AND file_path = $2
+		ORDER BY start_line, id`, p.project, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения блоков файла: %w", err)
+	}
+	return scanStoredBlocks(rows)
+}
+
+// MoveBlock обновляет путь, положение, текст и сообщения коммитов сохранённого блока.
+// body_hash не меняется, поэтому блок сохраняет свой вектор.
+func (p *PostgresDatabase) MoveBlock(id int64, block *models.CodeBlock, embeddingText string) error {
+	var inSnapshot bool
+	err := p.db.QueryRow("SELECT EXISTS (SELECT 1 FROM snapshot_blocks WHERE block_id = $1)", id).Scan(&inSnapshot)
+	if err != nil {
+		return fmt.Errorf("ошибка переноса блока: %w", err)
+	}
+
+	// Снимок хранит прежнее положение блока: строка исключается из текущего индекса, вместо неё вставляется копия
+	if inSnapshot {
+		if _, err := p.db.Exec("UPDATE embeddings SET live = FALSE WHERE id = $1", id); err != nil {
+			return fmt.Errorf("ошибка переноса блока: %w", err)
+		}
+		if err := p.insertBlock(block, embeddingText); err != nil {
+			return fmt.Errorf("ошибка переноса блока: %w", err)
+		}
+		return nil
+	}
+
+	commitMessagesJSON, err := marshalCommitMessages(block.CommitMessages)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+		UPDATE embeddings
+		SET file_path = $1, relative_path = $2, real_path = $3, start_line = $4, end_line = $5, ordinal = $6,
+			raw_text = $7, embedding_text = $8, commit_messages = $9, content_hash = $10
+		WHERE id = $11 AND project = $12`,
+		block.FilePath, block.GetRelativePath(), block.RealPath, block.StartLine, block.EndLine, block.Ordinal,
+		block.RawText, embeddingText, commitMessagesJSON, block.ContentHash(),
+		id, p.project)
+	if err != nil {
+		return fmt.Errorf("ошибка переноса блока: %w", err)
+	}
+	return nil
+}
+
+// DeleteBlocks удаляет блоки из текущего индекса по ID.
+// Блоки, входящие в снимки, остаются в базе и только исключаются из текущего индекса.
+func (p *PostgresDatabase) DeleteBlocks(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := p.db.Exec(`DELETE FROM embeddings e
+		WHERE e.project = $1 AND e.id = ANY($2)
+		AND NOT EXISTS (SELECT 1 FROM snapshot_blocks sb WHERE sb.block_id = e.id)`, p.project, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков: %w", err)
+	}
+
+	_, err = p.db.Exec("UPDATE embeddings SET live = FALSE WHERE project = $1 AND id = ANY($2)",
+		p.project, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка удаления блоков: %w", err)
+	}
+	return nil
+}
+
+// GetAllFilePaths возвращает все пути файлов из базы данных
+func (p *PostgresDatabase) GetAllFilePaths() ([]string, error) {
+	rows, err := p.db.Query("SELECT DISTINCT file_path FROM embeddings WHERE project = $1 AND live", p.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения путей файлов: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования пути файла: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// GetStatistics возвращает статистику базы данных
+func (p *PostgresDatabase) GetStatistics() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+	stats["project"] = p.project
+
+	scope, arg := p.readScope()
+
+	var totalBlocks, blocksWithEmbeddings, uniqueVectors, fileCount int
+	err := p.db.QueryRow(`
+		SELECT COUNT(*), COUNT(v.body_hash), COUNT(DISTINCT v.body_hash), COUNT(DISTINCT file_path)
+		FROM embeddings
+		LEFT JOIN vectors v ON v.body_hash = embeddings.body_hash
+		WHERE `+scope, arg).Scan(&totalBlocks, &blocksWithEmbeddings, &uniqueVectors, &fileCount)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики блоков: %w", err)
+	}
+	stats["total_blocks"] = totalBlocks
+	stats["blocks_with_embeddings"] = blocksWithEmbeddings
+	stats["blocks_without_embeddings"] = totalBlocks - blocksWithEmbeddings
+	// Блоки с одинаковым телом разделяют один вектор
+	stats["unique_vectors"] = uniqueVectors
+	stats["deduplicated_blocks"] = blocksWithEmbeddings - uniqueVectors
+	stats["file_count"] = fileCount
+
+	// Статистика по типам блоков
+	rows, err := p.db.Query("SELECT block_type, COUNT(*) FROM embeddings WHERE "+scope+" GROUP BY block_type", arg)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики по типам блоков: %w", err)
+	}
+	defer rows.Close()
+
+	blockTypeStats := make(map[string]int)
+	for rows.Next() {
+		var blockType string
+		var count int
+		if err := rows.Scan(&blockType, &count); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования статистики типов блоков: %w", err)
+		}
+		blockTypeStats[blockType] = count
+	}
+	stats["block_types"] = blockTypeStats
+
+	return stats, rows.Err()
+}
+
+// ExportToCSV экспортирует данные текущего проекта (или выбранного снимка) в CSV файл
+func (p *PostgresDatabase) ExportToCSV(outputPath string) error {
+	scope, arg := p.readScope()
+	rows, err := p.db.Query(`
+	SELECT
+		id,
+		file_path,
+		relative_path,
+		block_type,
+		class_name,
+		method_name,
+		start_line,
+		end_line,
+		commit_messages,
+		raw_text,
+		embedding_text,
+		created_at::text,
+		CASE WHEN `+hasVectorSQL+` THEN 'true' ELSE 'false' END AS has_embedding
+	FROM embeddings
+	WHERE `+scope+`
+	ORDER BY file_path, start_line`, arg)
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	return writeBlocksCSV(rows, outputPath)
+}
+
+// ReuseBlock возвращает в текущий индекс блок из снимков с тем же положением и тем же текстом
+func (p *PostgresDatabase) ReuseBlock(block *models.CodeBlock) (bool, error) {
+	className, methodName := blockNames(block)
+
+	result, err := p.db.Exec(`
+		UPDATE embeddings SET live = TRUE
+		WHERE id = (
+			SELECT id FROM embeddings
+			WHERE project = $1 AND NOT live AND file_path = $2 AND class_name = $3 AND method_name = $4
+			AND start_line = $5 AND end_line = $6 AND block_type = $7 AND content_hash = $8
+			ORDER BY id DESC LIMIT 1
+		)`,
+		p.project, block.FilePath, className, methodName, block.StartLine, block.EndLine, block.BlockType,
+		block.ContentHash(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("ошибка повторного использования блока: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновлённых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CreateSnapshot сохраняет текущий индекс проекта как снимок.
+// Блоки не копируются: снимок ссылается на те же строки embeddings.
+func (p *PostgresDatabase) CreateSnapshot(snapshot models.Snapshot) (models.Snapshot, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Снимок с той же меткой заменяется, его блоки удаляются каскадно
+	if _, err := tx.Exec("DELETE FROM snapshots WHERE project = $1 AND label = $2", p.project, snapshot.Label); err != nil {
+		return snapshot, fmt.Errorf("ошибка замены снимка %s: %w", snapshot.Label, err)
+	}
+
+	var snapshotID int64
+	err = tx.QueryRow(`INSERT INTO snapshots (project, label, commit_sha, branch)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		p.project, snapshot.Label, snapshot.CommitSHA, snapshot.Branch).Scan(&snapshotID, &snapshot.CreatedAt)
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка %s: %w", snapshot.Label, err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO snapshot_blocks (snapshot_id, block_id)
+		SELECT $1, id FROM embeddings WHERE project = $2 AND live`, snapshotID, p.project)
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка сохранения блоков снимка %s: %w", snapshot.Label, err)
+	}
+	blocks, err := result.RowsAffected()
+	if err != nil {
+		return snapshot, fmt.Errorf("ошибка сохранения блоков снимка %s: %w", snapshot.Label, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return snapshot, fmt.Errorf("ошибка создания снимка %s: %w", snapshot.Label, err)
+	}
+
+	snapshot.Blocks = int(blocks)
+	return snapshot, nil
+}
+
+// ListSnapshots возвращает снимки текущего проекта, новые первыми
+func (p *PostgresDatabase) ListSnapshots() ([]models.Snapshot, error) {
+	rows, err := p.db.Query(`
+		SELECT s.label, s.commit_sha, s.branch, s.created_at,
+			(SELECT COUNT(*) FROM snapshot_blocks sb WHERE sb.snapshot_id = s.id)
+		FROM snapshots s
+		WHERE s.project = $1
+		ORDER BY s.id DESC`, p.project)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка снимков: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []models.Snapshot
+	for rows.Next() {
+		var snapshot models.Snapshot
+		if err := rows.Scan(&snapshot.Label, &snapshot.CommitSHA, &snapshot.Branch,
+			&snapshot.CreatedAt, &snapshot.Blocks); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования снимка: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// UseSnapshot выбирает снимок для чтения по метке или префиксу SHA коммита
+func (p *PostgresDatabase) UseSnapshot(selector string) error {
+	if selector == "" {
+		p.snapshot = 0
+		return nil
+	}
+
+	var snapshotID int64
+	err := p.db.QueryRow(`
+		SELECT id FROM snapshots
+		WHERE project = $1 AND (label = $2 OR commit_sha LIKE $2 || '%')
+		ORDER BY label = $2 DESC, id DESC
+		LIMIT 1`, p.project, selector).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("снимок %s не найден в проекте %s", selector, p.project)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка поиска снимка %s: %w", selector, err)
+	}
+
+	p.snapshot = snapshotID
+	return nil
+}
+
+// DeleteSnapshot удаляет снимок по метке. Блоки освобождаются при сборке мусора.
+func (p *PostgresDatabase) DeleteSnapshot(label string) error {
+	var snapshotID int64
+	err := p.db.QueryRow("DELETE FROM snapshots WHERE project = $1 AND label = $2 RETURNING id",
+		p.project, label).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("снимок %s не найден в проекте %s", label, p.project)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка удаления снимка %s: %w", label, err)
+	}
+
+	if p.snapshot == snapshotID {
+		p.snapshot = 0
+	}
+	return nil
+}
+
+// CollectGarbage удаляет блоки проекта, которые не входят ни в текущий индекс, ни в один снимок,
+// и векторы, на которые больше не ссылается ни один блок
+func (p *PostgresDatabase) CollectGarbage() (int64, error) {
+	result, err := p.db.Exec(`DELETE FROM embeddings e
+		WHERE e.project = $1 AND NOT e.live
+		AND NOT EXISTS (SELECT 1 FROM snapshot_blocks sb WHERE sb.block_id = e.id)`, p.project)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
+	}
+
+	_, err = p.db.Exec(`DELETE FROM vectors v
+		WHERE NOT EXISTS (SELECT 1 FROM embeddings e WHERE e.body_hash = v.body_hash)`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сборки мусора: %w", err)
+	}
+
+	return removed, nil
+}
+
+// Maintain обслуживает базу PostgreSQL: проверка векторов и хешей, VACUUM ANALYZE.
+// Проверку целостности страниц PostgreSQL выполняет сам, отдельный integrity_check не нужен.
+func (p *PostgresDatabase) Maintain(options MaintenanceOptions) (*MaintenanceReport, error) {
+	report := &MaintenanceReport{}
+
+	size, err := p.size()
+	if err != nil {
+		return nil, err
+	}
+	report.SizeBefore = size
+
+	if options.Dimensions <= 0 {
+		options.Dimensions = p.dimensions
+	}
+
+	rows, err := p.db.Query("SELECT body_hash, vector::text FROM vectors")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения эмбедингов: %w", err)
+	}
+	err = checkVectors(rows, options.Dimensions, report)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.Query(`
+		SELECT h.project, h.file_path FROM file_hashes h
+		WHERE NOT EXISTS (
+			SELECT 1 FROM embeddings e
+			WHERE e.project = h.project AND e.relative_path = h.file_path AND e.live
+		)
+		ORDER BY h.project, h.file_path`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска хешей без блоков: %w", err)
+	}
+	if report.HashesWithoutBlocks, err = scanFileRefs(rows); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.Query(`
+		SELECT DISTINCT e.project, e.relative_path FROM embeddings e
+		WHERE e.live AND NOT EXISTS (
+			SELECT 1 FROM file_hashes h
+			WHERE h.project = e.project AND h.file_path = e.relative_path
+		)
+		ORDER BY e.project, e.relative_path`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска блоков без хешей: %w", err)
+	}
+	if report.BlocksWithoutHashes, err = scanFileRefs(rows); err != nil {
+		return nil, err
+	}
+
+	if options.Repair {
+		if err := p.repair(report); err != nil {
+			return nil, err
+		}
+		report.Repaired = true
+	}
+
+	if _, err := p.db.Exec("VACUUM ANALYZE"); err != nil {
+		return nil, fmt.Errorf("ошибка выполнения VACUUM ANALYZE: %w", err)
+	}
+
+	if report.SizeAfter, err = p.size(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// repair исправляет проблемы из отчёта в одной транзакции
+func (p *PostgresDatabase) repair(report *MaintenanceReport) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка исправления базы: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, hashes := range [][]string{report.MalformedVectors, report.WrongDimensionVectors} {
+		for _, hash := range hashes {
+			if _, err := tx.Exec("DELETE FROM vectors WHERE body_hash = $1", hash); err != nil {
+				return fmt.Errorf("ошибка удаления вектора %s: %w", hash, err)
+			}
+		}
+	}
+
+	for _, ref := range report.HashesWithoutBlocks {
+		if _, err := tx.Exec("DELETE FROM file_hashes WHERE project = $1 AND file_path = $2", ref.Project, ref.Path); err != nil {
+			return fmt.Errorf("ошибка удаления хеша %s: %w", ref.Path, err)
+		}
+	}
+
+	for _, ref := range report.BlocksWithoutHashes {
+		statements := []string{
+			`DELETE FROM embeddings e WHERE e.project = $1 AND e.relative_path = $2 AND e.live
+				AND NOT EXISTS (SELECT 1 FROM snapshot_blocks sb WHERE sb.block_id = e.id)`,
+			"UPDATE embeddings SET live = FALSE WHERE project = $1 AND relative_path = $2 AND live",
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt, ref.Project, ref.Path); err != nil {
+				return fmt.Errorf("ошибка удаления блоков %s: %w", ref.Path, err)
+			}
+		}
+	}
+
+	// Следующий запуск проверяет такие проекты полностью, а не по git diff
+	for _, project := range report.repairedProjects() {
+		if _, err := tx.Exec("DELETE FROM index_states WHERE project = $1", project); err != nil {
+			return fmt.Errorf("ошибка сброса состояния индексации %s: %w", project, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка исправления базы: %w", err)
+	}
+	return nil
+}
+
+// size возвращает размер текущей базы в байтах
+func (p *PostgresDatabase) size() (int64, error) {
+	var size int64
+	if err := p.db.QueryRow("SELECT pg_database_size(current_database())").Scan(&size); err != nil {
+		return 0, fmt.Errorf("ошибка получения размера базы: %w", err)
+	}
+	return size, nil
+}
+
+// readScope возвращает условие выборки блоков для чтения: выбранный снимок или текущий индекс проекта
+func (p *PostgresDatabase) readScope() (string, interface{}) {
+	if p.snapshot != 0 {
+		return "id IN (SELECT block_id FROM snapshot_blocks WHERE snapshot_id = $1)", p.snapshot
+	}
+	return "project = $1 AND live", p.project
+}
+
+// formatVector преобразует эмбединг в текстовый формат pgvector: [1,2,3]
+func (p *PostgresDatabase) formatVector(embedding []float64) (string, error) {
+	if len(embedding) != p.dimensions {
+		return "", fmt.Errorf("размерность эмбединга %d не совпадает с размерностью колонки %d",
+			len(embedding), p.dimensions)
+	}
+
+	parts := make([]string, len(embedding))
+	for i, value := range embedding {
+		parts[i] = strconv.FormatFloat(value, 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]", nil
+}
@@ -0,0 +1,529 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gokb-embedder/internal/models"
+)
+
+// Storage интерфейс хранилища блоков и эмбедингов
+type Storage interface {
+	// Close закрывает подключение к хранилищу
+	Close() error
+
+	// SaveEmbedding сохраняет блок вместе с эмбедингом
+	SaveEmbedding(block *models.CodeBlock, embedding []float64, embeddingText string) error
+
+	// SaveBlockWithoutEmbedding сохраняет блок без эмбединга
+	SaveBlockWithoutEmbedding(block *models.CodeBlock, embeddingText string) error
+
+	// UpdateEmbedding обновляет эмбединг существующего блока
+	UpdateEmbedding(block *models.CodeBlock, embedding []float64) error
+
+	// BlockExists проверяет, существует ли блок
+	BlockExists(block *models.CodeBlock) (bool, error)
+
+	// GetVector возвращает уже сохранённый эмбединг тела блока (по BodyHash) или nil
+	GetVector(block *models.CodeBlock) ([]float64, error)
+
+	// FindOccurrences возвращает все места текущего индекса, где встречается тело с данным хешем
+	FindOccurrences(bodyHash string) ([]*models.CodeBlock, error)
+
+	// FindDuplicates возвращает до limit групп одинаковых тел, самые частые первыми
+	FindDuplicates(limit int) ([]DuplicateGroup, error)
+
+	// CountBlocksWithoutEmbeddings возвращает количество блоков без эмбедингов
+	CountBlocksWithoutEmbeddings() (int, error)
+
+	// ForEachBlockWithoutEmbeddings обходит блоки без эмбедингов страницами по pageSize в порядке ID.
+	// Каждая страница читается отдельным запросом, поэтому память не растёт с размером очереди,
+	// а fn может сохранять эмбединги между страницами.
+	ForEachBlockWithoutEmbeddings(pageSize int, fn func(page []*models.CodeBlock) error) error
+
+	// GetFileHash возвращает сохранённый хеш файла
+	GetFileHash(filePath string) (string, error)
+
+	// GetFileHashes возвращает сохранённые хеши всех файлов проекта одним запросом
+	GetFileHashes() (map[string]string, error)
+
+	// UpdateFileHash обновляет хеш файла; сохранённые данные stat сбрасываются
+	UpdateFileHash(filePath, hash string) error
+
+	// GetFileStates возвращает хеши и данные stat всех файлов проекта одним запросом
+	GetFileStates() (map[string]models.FileState, error)
+
+	// UpdateFileState сохраняет хеш и данные stat файла
+	UpdateFileState(state models.FileState) error
+
+	// DeleteFileHash удаляет сохранённый хеш файла
+	DeleteFileHash(filePath string) error
+
+	// DeleteFileBlocks удаляет все блоки файла
+	DeleteFileBlocks(filePath string) error
+
+	// GetIndexState возвращает состояние индексации корня (пустое, если корень ещё не индексировался)
+	GetIndexState(root string) (models.IndexState, error)
+
+	// SaveIndexState сохраняет состояние индексации корня
+	SaveIndexState(state models.IndexState) error
+
+	// GetFileBlocks возвращает блоки файла из текущего индекса вместе с их ID
+	GetFileBlocks(filePath string) ([]StoredBlock, error)
+
+	// MoveBlock переносит сохранённый блок на новое место в файле или в другой файл, не трогая его вектор.
+	// Блок, входящий в снимок, не меняется: в текущий индекс вместо него добавляется копия.
+	MoveBlock(id int64, block *models.CodeBlock, embeddingText string) error
+
+	// DeleteBlocks удаляет блоки из текущего индекса по ID (блоки из снимков только исключаются)
+	DeleteBlocks(ids []int64) error
+
+	// UseProject регистрирует проект и ограничивает им все последующие запросы
+	UseProject(project models.Project) error
+
+	// ListProjects возвращает все проекты хранилища
+	ListProjects() ([]models.Project, error)
+
+	// ReuseBlock возвращает в текущий индекс блок из снимков, если его положение и текст не изменились
+	ReuseBlock(block *models.CodeBlock) (bool, error)
+
+	// CreateSnapshot сохраняет текущий индекс проекта как снимок (снимок с той же меткой заменяется)
+	CreateSnapshot(snapshot models.Snapshot) (models.Snapshot, error)
+
+	// ListSnapshots возвращает снимки текущего проекта, новые первыми
+	ListSnapshots() ([]models.Snapshot, error)
+
+	// UseSnapshot ограничивает чтение (экспорт, статистика) снимком по метке или SHA коммита.
+	// Пустой селектор возвращает к текущему индексу.
+	UseSnapshot(selector string) error
+
+	// DeleteSnapshot удаляет снимок по метке
+	DeleteSnapshot(label string) error
+
+	// CollectGarbage удаляет блоки, которые не входят ни в текущий индекс, ни в один снимок
+	CollectGarbage() (int64, error)
+
+	// Maintain проверяет целостность базы, битые векторы и рассинхронизацию file_hashes с блоками,
+	// при необходимости исправляет найденное и сжимает базу
+	Maintain(options MaintenanceOptions) (*MaintenanceReport, error)
+
+	// ForEachEmbedding вызывает fn для каждого блока с эмбедингом
+	ForEachEmbedding(fn func(block *models.CodeBlock, embedding []float64) error) error
+
+	// GetAllFilePaths возвращает пути всех файлов с блоками
+	GetAllFilePaths() ([]string, error)
+
+	// GetStatistics возвращает статистику хранилища
+	GetStatistics() (map[string]interface{}, error)
+
+	// ExportToCSV экспортирует блоки в CSV файл
+	ExportToCSV(outputPath string) error
+}
+
+// Open открывает хранилище: PostgreSQL, если задан DSN, иначе SQLite
+func Open(dbPath, postgresDSN string, dimensions int) (Storage, error) {
+	if postgresDSN != "" {
+		return NewPostgresDatabase(postgresDSN, dimensions)
+	}
+	return NewDatabase(dbPath)
+}
+
+// DuplicateGroup блоки текущего индекса с одинаковым нормализованным телом
+type DuplicateGroup struct {
+	BodyHash string
+	Blocks   []*models.CodeBlock
+}
+
+// blockColumns колонки таблицы embeddings, из которых собирается models.CodeBlock
+const blockColumns = `project, file_path, relative_path, real_path, block_type, class_name, method_name,
+	start_line, end_line, ordinal, commit_messages, raw_text`
+
+// backfillOrdinalsSQL нумерует блоки с одинаковым путём символа внутри файла в порядке строк.
+// Заполняет колонку ordinal в базах, созданных до её появления.
+const backfillOrdinalsSQL = `
+	UPDATE embeddings SET ordinal = o.n
+	FROM (
+		SELECT id, ROW_NUMBER() OVER (
+			PARTITION BY project, file_path, live, block_type, COALESCE(class_name, ''), COALESCE(method_name, '')
+			ORDER BY start_line, id) - 1 AS n
+		FROM embeddings
+	) AS o
+	WHERE o.id = embeddings.id AND o.n > 0`
+
+// hasVectorSQL условие "у блока есть общий вектор" для запросов к embeddings
+const hasVectorSQL = `EXISTS (SELECT 1 FROM vectors v WHERE v.body_hash = embeddings.body_hash)`
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBlock читает блок из строки запроса по колонкам blockColumns.
+// Дополнительные колонки после blockColumns сканируются в extra.
+func scanBlock(row rowScanner, extra ...interface{}) (*models.CodeBlock, error) {
+	var startLine, endLine, ordinal int
+	var project, filePath, relativePath, realPath, blockType, rawText string
+	var className, methodName, commitMessages sql.NullString
+
+	dest := []interface{}{&project, &filePath, &relativePath, &realPath, &blockType, &className, &methodName,
+		&startLine, &endLine, &ordinal, &commitMessages, &rawText}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, fmt.Errorf("ошибка сканирования блока: %w", err)
+	}
+
+	// Десериализуем сообщения коммитов
+	var commitMsgs []string
+	if commitMessages.String != "" {
+		if err := json.Unmarshal([]byte(commitMessages.String), &commitMsgs); err != nil {
+			return nil, fmt.Errorf("ошибка десериализации сообщений коммитов: %w", err)
+		}
+	}
+
+	block := &models.CodeBlock{
+		Project:        project,
+		FilePath:       filePath,
+		RelativePath:   relativePath,
+		RealPath:       realPath,
+		BlockType:      blockType,
+		StartLine:      startLine,
+		EndLine:        endLine,
+		Ordinal:        ordinal,
+		RawText:        rawText,
+		CommitMessages: commitMsgs,
+	}
+
+	// Устанавливаем опциональные поля
+	if className.String != "" {
+		block.ClassName = &className.String
+	}
+	if methodName.String != "" {
+		block.MethodName = &methodName.String
+	}
+
+	return block, nil
+}
+
+// forEachEmbeddingRow обходит строки запроса "blockColumns, embedding" и вызывает fn.
+// Эмбединг в обоих хранилищах читается как текст вида [1,2,3].
+func forEachEmbeddingRow(rows *sql.Rows, fn func(block *models.CodeBlock, embedding []float64) error) error {
+	for rows.Next() {
+		var embeddingText string
+		block, err := scanBlock(rows, &embeddingText)
+		if err != nil {
+			return err
+		}
+
+		var embedding []float64
+		if err := json.Unmarshal([]byte(embeddingText), &embedding); err != nil {
+			return fmt.Errorf("ошибка десериализации эмбединга блока %s: %w", block, err)
+		}
+
+		if err := fn(block, embedding); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении блоков: %w", err)
+	}
+
+	return nil
+}
+
+// scanBlocks читает все строки запроса по колонкам blockColumns
+func scanBlocks(rows *sql.Rows) ([]*models.CodeBlock, error) {
+	defer rows.Close()
+
+	var blocks []*models.CodeBlock
+	for rows.Next() {
+		block, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении блоков: %w", err)
+	}
+	return blocks, nil
+}
+
+// scanStrings читает строки запроса из одной текстовой колонки
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// scanFileHashes читает строки "file_path, file_hash" в карту
+func scanFileHashes(rows *sql.Rows) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var filePath, hash string
+		if err := rows.Scan(&filePath, &hash); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования хеша файла: %w", err)
+		}
+		hashes[filePath] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// fileStateColumns колонки таблицы file_hashes, из которых собирается models.FileState
+const fileStateColumns = `file_path, file_hash, size, mtime, inode`
+
+// scanFileStates читает строки запроса по колонкам fileStateColumns в карту по путям.
+// inode хранится в знаковой колонке и переводится обратно в uint64.
+func scanFileStates(rows *sql.Rows) (map[string]models.FileState, error) {
+	states := make(map[string]models.FileState)
+	for rows.Next() {
+		var state models.FileState
+		var inode int64
+		if err := rows.Scan(&state.Path, &state.Hash, &state.Size, &state.ModTime, &inode); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования состояния файла: %w", err)
+		}
+		state.Inode = uint64(inode)
+		states[state.Path] = state
+	}
+	return states, rows.Err()
+}
+
+// scanIndexState читает строку "commit_sha, dirty_paths, settings" таблицы index_states
+func scanIndexState(row rowScanner, root string) (models.IndexState, error) {
+	state := models.IndexState{Root: root}
+
+	var dirtyPaths string
+	err := row.Scan(&state.CommitSHA, &dirtyPaths, &state.Settings)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("ошибка получения состояния индексации: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(dirtyPaths), &state.DirtyPaths); err != nil {
+		return state, fmt.Errorf("ошибка десериализации состояния индексации: %w", err)
+	}
+	return state, nil
+}
+
+// marshalDirtyPaths сериализует незакоммиченные пути состояния индексации в JSON
+func marshalDirtyPaths(paths []string) (string, error) {
+	if paths == nil {
+		paths = []string{}
+	}
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации состояния индексации: %w", err)
+	}
+	return string(data), nil
+}
+
+// scanStoredBlocks читает строки запроса "blockColumns, id"
+func scanStoredBlocks(rows *sql.Rows) ([]StoredBlock, error) {
+	defer rows.Close()
+
+	var blocks []StoredBlock
+	for rows.Next() {
+		var id int64
+		block, err := scanBlock(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, StoredBlock{ID: id, CodeBlock: block})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении блоков: %w", err)
+	}
+	return blocks, nil
+}
+
+// scanBlockPage читает страницу строк "blockColumns, id" и возвращает ID последнего блока
+func scanBlockPage(rows *sql.Rows) ([]*models.CodeBlock, int64, error) {
+	defer rows.Close()
+
+	var page []*models.CodeBlock
+	var lastID int64
+	for rows.Next() {
+		block, err := scanBlock(rows, &lastID)
+		if err != nil {
+			return nil, 0, err
+		}
+		page = append(page, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка при чтении блоков: %w", err)
+	}
+	return page, lastID, nil
+}
+
+// legacyVector строка embeddings, сохранённая до появления общей таблицы vectors
+type legacyVector struct {
+	id       int64
+	bodyHash string
+	vector   string
+}
+
+// scanLegacyVectors читает строки "id, raw_text, embedding" и вычисляет хеш тела каждого блока
+func scanLegacyVectors(rows *sql.Rows) ([]legacyVector, error) {
+	defer rows.Close()
+
+	var legacy []legacyVector
+	for rows.Next() {
+		var id int64
+		var rawText string
+		var vector sql.NullString
+		if err := rows.Scan(&id, &rawText, &vector); err != nil {
+			return nil, fmt.Errorf("ошибка миграции векторов: %w", err)
+		}
+		block := models.CodeBlock{RawText: rawText}
+		legacy = append(legacy, legacyVector{id: id, bodyHash: block.BodyHash(), vector: vector.String})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка миграции векторов: %w", err)
+	}
+	return legacy, nil
+}
+
+// csvHeaders заголовки CSV файла экспорта
+var csvHeaders = []string{
+	"ID",
+	"File Path",
+	"Relative Path",
+	"Block Type",
+	"Class Name",
+	"Method Name",
+	"Start Line",
+	"End Line",
+	"Commit Messages",
+	"Raw Text",
+	"Embedding Text",
+	"Created At",
+	"Has Embedding",
+}
+
+// blockNames возвращает имя класса и метода блока (пустые строки вместо nil)
+func blockNames(block *models.CodeBlock) (string, string) {
+	className := ""
+	if block.ClassName != nil {
+		className = *block.ClassName
+	}
+
+	methodName := ""
+	if block.MethodName != nil {
+		methodName = *block.MethodName
+	}
+
+	return className, methodName
+}
+
+// marshalCommitMessages сериализует сообщения коммитов в JSON (nil, если их нет)
+func marshalCommitMessages(messages []string) (*string, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	commitJSON, err := json.Marshal(messages)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации сообщений коммитов: %w", err)
+	}
+	commitStr := string(commitJSON)
+	return &commitStr, nil
+}
+
+// writeBlocksCSV записывает строки запроса экспорта в CSV файл.
+// Порядок колонок запроса должен совпадать с csvHeaders.
+func writeBlocksCSV(rows *sql.Rows, outputPath string) error {
+	// Создаём CSV файл
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("ошибка создания CSV файла: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write(csvHeaders); err != nil {
+		return fmt.Errorf("ошибка записи заголовков CSV: %w", err)
+	}
+
+	// Записываем данные
+	for rows.Next() {
+		var (
+			id             int64
+			filePath       string
+			relativePath   string
+			blockType      string
+			className      sql.NullString
+			methodName     sql.NullString
+			startLine      int
+			endLine        int
+			commitMessages sql.NullString
+			rawText        string
+			embeddingText  string
+			createdAt      string
+			hasEmbedding   string
+		)
+
+		if err := rows.Scan(
+			&id,
+			&filePath,
+			&relativePath,
+			&blockType,
+			&className,
+			&methodName,
+			&startLine,
+			&endLine,
+			&commitMessages,
+			&rawText,
+			&embeddingText,
+			&createdAt,
+			&hasEmbedding,
+		); err != nil {
+			return fmt.Errorf("ошибка сканирования строки: %w", err)
+		}
+
+		// Подготавливаем данные для CSV
+		row := []string{
+			fmt.Sprintf("%d", id),
+			filePath,
+			relativePath,
+			blockType,
+			className.String,
+			methodName.String,
+			fmt.Sprintf("%d", startLine),
+			fmt.Sprintf("%d", endLine),
+			commitMessages.String,
+			rawText,
+			embeddingText,
+			createdAt,
+			hasEmbedding,
+		}
+
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("ошибка записи строки CSV: %w", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении строк: %w", err)
+	}
+
+	return nil
+}
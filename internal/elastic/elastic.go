@@ -0,0 +1,336 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gokb-embedder/internal/models"
+)
+
+// Поддерживаемые варианты поискового движка
+const (
+	FlavorOpenSearch    = "opensearch"
+	FlavorElasticsearch = "elasticsearch"
+)
+
+// DefaultChunkSize количество документов в одном запросе _bulk
+const DefaultChunkSize = 500
+
+// maxAttempts количество попыток отправки одного чанка
+const maxAttempts = 4
+
+// Exporter формирует маппинг индекса и NDJSON для _bulk
+type Exporter struct {
+	index     string
+	flavor    string
+	dimension int
+}
+
+// NewExporter создаёт новый экспортёр для индекса
+func NewExporter(index, flavor string, dimension int) (*Exporter, error) {
+	flavor = strings.ToLower(flavor)
+	if flavor != FlavorOpenSearch && flavor != FlavorElasticsearch {
+		return nil, fmt.Errorf("неизвестный поисковый движок %q (ожидается %s или %s)",
+			flavor, FlavorOpenSearch, FlavorElasticsearch)
+	}
+	if dimension <= 0 {
+		return nil, fmt.Errorf("некорректная размерность эмбедингов: %d", dimension)
+	}
+
+	return &Exporter{
+		index:     index,
+		flavor:    flavor,
+		dimension: dimension,
+	}, nil
+}
+
+// Mapping возвращает тело запроса создания индекса с маппингом полей
+func (e *Exporter) Mapping() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+	properties := map[string]interface{}{
+		"project":         keyword,
+		"path":            keyword,
+		"file_path":       keyword,
+		"block_type":      keyword,
+		"class":           keyword,
+		"method":          keyword,
+		"start_line":      map[string]interface{}{"type": "integer"},
+		"end_line":        map[string]interface{}{"type": "integer"},
+		"commit_messages": map[string]interface{}{"type": "text"},
+		"raw_text":        map[string]interface{}{"type": "text"},
+		"body_hash":       keyword,
+		"real_path":       keyword,
+	}
+
+	body := map[string]interface{}{}
+	if e.flavor == FlavorOpenSearch {
+		properties["embedding"] = map[string]interface{}{
+			"type":      "knn_vector",
+			"dimension": e.dimension,
+			"method": map[string]interface{}{
+				"name":       "hnsw",
+				"space_type": "cosinesimil",
+				"engine":     "lucene",
+			},
+		}
+		body["settings"] = map[string]interface{}{
+			"index": map[string]interface{}{"knn": true},
+		}
+	} else {
+		properties["embedding"] = map[string]interface{}{
+			"type":       "dense_vector",
+			"dims":       e.dimension,
+			"index":      true,
+			"similarity": "cosine",
+		}
+	}
+
+	body["mappings"] = map[string]interface{}{"properties": properties}
+	return body
+}
+
+// WriteDocument записывает пару строк _bulk (действие и документ) для блока
+func (e *Exporter) WriteDocument(w io.Writer, block *models.CodeBlock, embedding []float64) error {
+	if len(embedding) != e.dimension {
+		return fmt.Errorf("размерность эмбединга блока %s равна %d, ожидалась %d", block, len(embedding), e.dimension)
+	}
+
+	action := map[string]interface{}{
+		"index": map[string]interface{}{
+			"_index": e.index,
+			"_id":    block.StableID(),
+		},
+	}
+
+	doc := map[string]interface{}{
+		"project":    block.Project,
+		"path":       block.GetRelativePath(),
+		"file_path":  block.FilePath,
+		"block_type": block.BlockType,
+		"start_line": block.StartLine,
+		"end_line":   block.EndLine,
+		"raw_text":   block.RawText,
+		"body_hash":  block.BodyHash(),
+		"embedding":  embedding,
+	}
+	if block.ClassName != nil {
+		doc["class"] = *block.ClassName
+	}
+	if block.MethodName != nil {
+		doc["method"] = *block.MethodName
+	}
+	if len(block.CommitMessages) > 0 {
+		doc["commit_messages"] = block.CommitMessages
+	}
+	if block.RealPath != "" {
+		doc["real_path"] = block.RealPath
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(action); err != nil {
+		return fmt.Errorf("ошибка записи действия _bulk: %w", err)
+	}
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("ошибка записи документа _bulk: %w", err)
+	}
+	return nil
+}
+
+// Client отправляет данные в OpenSearch/Elasticsearch
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewClient создаёт новый клиент поискового движка
+func NewClient(baseURL, username, password string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		client:     &http.Client{Timeout: 2 * time.Minute},
+		retryDelay: time.Second,
+	}
+}
+
+// CreateIndex создаёт индекс с маппингом, если его ещё нет
+func (c *Client) CreateIndex(ctx context.Context, index string, mapping map[string]interface{}) error {
+	status, _, err := c.do(ctx, http.MethodHead, "/"+url.PathEscape(index), "", nil)
+	if err == nil && status == http.StatusOK {
+		return nil
+	}
+
+	body, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации маппинга: %w", err)
+	}
+
+	status, respBody, err := c.do(ctx, http.MethodPut, "/"+url.PathEscape(index), "application/json", body)
+	if err != nil {
+		return fmt.Errorf("ошибка создания индекса %s: %w", index, err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("ошибка создания индекса %s: HTTP %d - %s", index, status, string(respBody))
+	}
+	return nil
+}
+
+// Bulk отправляет NDJSON в _bulk с повторными попытками при временных ошибках
+func (c *Client) Bulk(ctx context.Context, ndjson []byte) error {
+	var lastErr error
+	delay := c.retryDelay
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		status, respBody, err := c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", ndjson)
+		switch {
+		case err != nil:
+			lastErr = err
+		case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+			lastErr = fmt.Errorf("HTTP %d - %s", status, string(respBody))
+		case status != http.StatusOK:
+			return fmt.Errorf("ошибка _bulk: HTTP %d - %s", status, string(respBody))
+		default:
+			return checkBulkResponse(respBody)
+		}
+
+		if attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	return fmt.Errorf("ошибка _bulk после %d попыток: %w", maxAttempts, lastErr)
+}
+
+// checkBulkResponse проверяет ответ _bulk на ошибки отдельных документов
+func checkBulkResponse(body []byte) error {
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("ошибка парсинга ответа _bulk: %w", err)
+	}
+	if !response.Errors {
+		return nil
+	}
+
+	failed := 0
+	firstError := ""
+	for _, item := range response.Items {
+		for _, result := range item {
+			if result.Status >= http.StatusMultipleChoices {
+				failed++
+				if firstError == "" {
+					firstError = fmt.Sprintf("%s: %s", result.ID, string(result.Error))
+				}
+			}
+		}
+	}
+	return fmt.Errorf("_bulk: не удалось записать %d документов, первая ошибка %s", failed, firstError)
+}
+
+// do выполняет запрос и возвращает статус и тело ответа
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("ошибка чтения ответа: %w", err)
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+// BulkWriter накапливает документы и отправляет их чанками
+type BulkWriter struct {
+	client    *Client
+	exporter  *Exporter
+	chunkSize int
+	buffer    bytes.Buffer
+	buffered  int
+	sent      int
+}
+
+// NewBulkWriter создаёт новый писатель чанков _bulk
+func NewBulkWriter(client *Client, exporter *Exporter, chunkSize int) *BulkWriter {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &BulkWriter{
+		client:    client,
+		exporter:  exporter,
+		chunkSize: chunkSize,
+	}
+}
+
+// Add добавляет документ и отправляет чанк, когда он заполнен
+func (b *BulkWriter) Add(ctx context.Context, block *models.CodeBlock, embedding []float64) error {
+	if err := b.exporter.WriteDocument(&b.buffer, block, embedding); err != nil {
+		return err
+	}
+	b.buffered++
+	if b.buffered >= b.chunkSize {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush отправляет накопленные документы
+func (b *BulkWriter) Flush(ctx context.Context) error {
+	if b.buffered == 0 {
+		return nil
+	}
+	if err := b.client.Bulk(ctx, b.buffer.Bytes()); err != nil {
+		return err
+	}
+	b.sent += b.buffered
+	b.buffered = 0
+	b.buffer.Reset()
+	return nil
+}
+
+// Sent возвращает количество отправленных документов
+func (b *BulkWriter) Sent() int {
+	return b.sent
+}
@@ -0,0 +1,192 @@
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gokb-embedder/internal/models"
+)
+
+func testBlock(startLine int) *models.CodeBlock {
+	className := "Service"
+	methodName := "handle"
+	block := models.NewCodeBlock("/repo/app/service.py", "method", &className, &methodName,
+		startLine, startLine+5, "def handle(self): pass")
+	block.SetRelativePath("app/service.py")
+	return block
+}
+
+func TestMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		flavor    string
+		fieldType string
+		dimKey    string
+	}{
+		{"opensearch", FlavorOpenSearch, "knn_vector", "dimension"},
+		{"elasticsearch", FlavorElasticsearch, "dense_vector", "dims"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, err := NewExporter("kb", tt.flavor, 3)
+			if err != nil {
+				t.Fatalf("NewExporter: %v", err)
+			}
+
+			properties := exporter.Mapping()["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+			embedding := properties["embedding"].(map[string]interface{})
+			if embedding["type"] != tt.fieldType {
+				t.Errorf("тип поля embedding = %v, ожидалось %s", embedding["type"], tt.fieldType)
+			}
+			if embedding[tt.dimKey] != 3 {
+				t.Errorf("%s = %v, ожидалось 3", tt.dimKey, embedding[tt.dimKey])
+			}
+
+			for _, field := range []string{"path", "block_type", "class", "method", "body_hash"} {
+				if properties[field].(map[string]interface{})["type"] != "keyword" {
+					t.Errorf("поле %s должно быть keyword", field)
+				}
+			}
+		})
+	}
+
+	if _, err := NewExporter("kb", "solr", 3); err == nil {
+		t.Error("ожидалась ошибка для неизвестного движка")
+	}
+}
+
+func TestWriteDocument(t *testing.T) {
+	exporter, _ := NewExporter("kb", FlavorElasticsearch, 3)
+
+	var buf bytes.Buffer
+	block := testBlock(1)
+	if err := exporter.WriteDocument(&buf, block, []float64{1, 2, 3}); err != nil {
+		t.Fatalf("WriteDocument: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("ожидалось 2 строки NDJSON, получено %d", len(lines))
+	}
+
+	var action map[string]map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &action); err != nil {
+		t.Fatalf("строка действия не JSON: %v", err)
+	}
+	if action["index"]["_index"] != "kb" || action["index"]["_id"] != block.StableID() {
+		t.Errorf("неожиданное действие: %v", action)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatalf("строка документа не JSON: %v", err)
+	}
+	if doc["path"] != "app/service.py" || doc["class"] != "Service" || doc["method"] != "handle" {
+		t.Errorf("неожиданный документ: %v", doc)
+	}
+
+	if err := exporter.WriteDocument(&buf, block, []float64{1, 2}); err == nil {
+		t.Error("ожидалась ошибка для эмбединга неверной размерности")
+	}
+}
+
+// fakeSearch имитация OpenSearch: первый запрос _bulk отвечает 503
+type fakeSearch struct {
+	mu        sync.Mutex
+	indices   map[string]bool
+	bulkCalls int
+	documents int
+}
+
+func (f *fakeSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/_bulk" && r.Method == http.MethodPost:
+		f.bulkCalls++
+		if f.bulkCalls == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			http.Error(w, "bad content type", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		lines := 0
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			lines++
+		}
+		f.documents += lines / 2
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	case r.Method == http.MethodHead:
+		if !f.indices[strings.Trim(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		f.indices[strings.Trim(r.URL.Path, "/")] = true
+		w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestBulkWriterWithRetry(t *testing.T) {
+	fake := &fakeSearch{indices: make(map[string]bool)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	exporter, _ := NewExporter("kb", FlavorOpenSearch, 3)
+	client := NewClient(server.URL, "", "")
+	client.retryDelay = 0
+
+	if err := client.CreateIndex(ctx, "kb", exporter.Mapping()); err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+	if !fake.indices["kb"] {
+		t.Fatal("индекс не создан")
+	}
+
+	bulk := NewBulkWriter(client, exporter, 2)
+	for i := 0; i < 5; i++ {
+		if err := bulk.Add(ctx, testBlock(i*10+1), []float64{0.1, 0.2, 0.3}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := bulk.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if bulk.Sent() != 5 || fake.documents != 5 {
+		t.Errorf("отправлено %d, получено сервером %d документов; ожидалось 5", bulk.Sent(), fake.documents)
+	}
+	// 3 чанка + 1 повтор после 503
+	if fake.bulkCalls != 4 {
+		t.Errorf("запросов _bulk: %d, ожидалось 4", fake.bulkCalls)
+	}
+}
+
+func TestCheckBulkResponse(t *testing.T) {
+	body := []byte(`{"errors":true,"items":[
+		{"index":{"_id":"a","status":201}},
+		{"index":{"_id":"b","status":400,"error":{"type":"mapper_parsing_exception"}}}
+	]}`)
+
+	err := checkBulkResponse(body)
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("ожидалась ошибка с причиной, получено: %v", err)
+	}
+}
@@ -7,6 +7,25 @@ import (
 	"strings"
 )
 
+// Статусы изменений файлов (копии приводятся к StatusAdded, смена типа и конфликты — к StatusModified)
+const (
+	StatusAdded    = "A"
+	StatusModified = "M"
+	StatusDeleted  = "D"
+	StatusRenamed  = "R"
+)
+
+// FileChange изменение файла между коммитами или в рабочей копии
+type FileChange struct {
+	Status string
+
+	// Path путь относительно корня сервиса
+	Path string
+
+	// OldPath прежний путь переименованного файла
+	OldPath string
+}
+
 // GitService предоставляет методы для работы с Git репозиторием
 type GitService struct {
 	root string
@@ -64,6 +83,181 @@ func (gs *GitService) GetLastCommitMessages(filePath string, n int) ([]string, e
 	return messages, nil
 }
 
+// GetRemoteURL возвращает URL удалённого репозитория origin (пустая строка, если его нет)
+func (gs *GitService) GetRemoteURL() string {
+	cmd := exec.Command("git", "remote", "get-url", "origin")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// GetHeadCommit возвращает полный SHA коммита HEAD
+func (gs *GitService) GetHeadCommit() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ошибка выполнения git rev-parse: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GitDir возвращает абсолютный путь к директории .git репозитория (для рабочих деревьев worktree — их собственной)
+func (gs *GitService) GitDir() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--absolute-git-dir")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ошибка выполнения git rev-parse: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetCurrentBranch возвращает имя текущей ветки (пустая строка для detached HEAD)
+func (gs *GitService) GetCurrentBranch() string {
+	cmd := exec.Command("git", "symbolic-ref", "--short", "-q", "HEAD")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// ListFiles возвращает файлы репозитория так, как их видит git: отслеживаемые (даже если они
+// подпадают под .gitignore) и неотслеживаемые без игнорируемых. Пути относительны корня сервиса.
+func (gs *GitService) ListFiles() ([]string, error) {
+	// -z отключает экранирование путей с пробелами и не-ASCII символами
+	cmd := exec.Command("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения git ls-files: %w", err)
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, path := range strings.Split(string(output), "\x00") {
+		// Файл с конфликтом слияния выводится для каждой стадии индекса
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		files = append(files, filepath.FromSlash(path))
+	}
+
+	return files, nil
+}
+
+// IsAncestor проверяет, что коммит существует и является предком HEAD.
+// false означает, что история переписана (rebase, force push) или коммит недоступен.
+func (gs *GitService) IsAncestor(commit string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", commit, "HEAD")
+	cmd.Dir = gs.root
+
+	return cmd.Run() == nil
+}
+
+// DiffSince возвращает изменения файлов корня сервиса между коммитом и HEAD с учётом переименований
+func (gs *GitService) DiffSince(commit string) ([]FileChange, error) {
+	return gs.diffNameStatus(commit, "HEAD")
+}
+
+// WorkingTreeChanges возвращает незакоммиченные изменения корня сервиса относительно HEAD
+// (в индексе и в рабочей копии) и неотслеживаемые файлы без игнорируемых
+func (gs *GitService) WorkingTreeChanges() ([]FileChange, error) {
+	changes, err := gs.diffNameStatus("HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", "ls-files", "-z", "--others", "--exclude-standard")
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения git ls-files: %w", err)
+	}
+
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			changes = append(changes, FileChange{Status: StatusAdded, Path: filepath.FromSlash(path)})
+		}
+	}
+
+	return changes, nil
+}
+
+// diffNameStatus выполняет git diff --name-status для корня сервиса.
+// --relative ограничивает вывод корнем и делает пути относительными ему.
+func (gs *GitService) diffNameStatus(revisions ...string) ([]FileChange, error) {
+	args := append([]string{"diff", "--name-status", "-z", "-M", "--relative"}, revisions...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = gs.root
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения git diff: %w", err)
+	}
+
+	return parseNameStatus(string(output)), nil
+}
+
+// parseNameStatus разбирает вывод git diff --name-status -z: статус и путь,
+// а для переименований и копий (R100, C75) — статус, прежний и новый путь. Оборванная запись отбрасывается.
+func parseNameStatus(output string) []FileChange {
+	fields := strings.Split(output, "\x00")
+
+	var changes []FileChange
+	for i := 0; i+1 < len(fields); {
+		status := fields[i]
+		if status == "" {
+			break
+		}
+
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) || fields[i+1] == "" || fields[i+2] == "" {
+				return changes
+			}
+			oldPath, path := filepath.FromSlash(fields[i+1]), filepath.FromSlash(fields[i+2])
+			if status[0] == 'R' {
+				changes = append(changes, FileChange{Status: StatusRenamed, Path: path, OldPath: oldPath})
+			} else {
+				changes = append(changes, FileChange{Status: StatusAdded, Path: path})
+			}
+			i += 3
+		default:
+			if fields[i+1] == "" {
+				return changes
+			}
+			change := FileChange{Status: StatusModified, Path: filepath.FromSlash(fields[i+1])}
+			switch status[0] {
+			case 'A':
+				change.Status = StatusAdded
+			case 'D':
+				change.Status = StatusDeleted
+			}
+			changes = append(changes, change)
+			i += 2
+		}
+	}
+
+	return changes
+}
+
 // IsGitRepository проверяет, является ли директория Git репозиторием
 func IsGitRepository(path string) bool {
 	cmd := exec.Command("git", "rev-parse", "--git-dir")
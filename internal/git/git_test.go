@@ -0,0 +1,78 @@
+package git
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []FileChange
+	}{
+		{
+			name:   "пустой вывод",
+			output: "",
+			want:   nil,
+		},
+		{
+			name:   "добавление, удаление и изменение",
+			output: "A\x00new.py\x00D\x00old.py\x00M\x00src/app.py\x00",
+			want: []FileChange{
+				{Status: StatusAdded, Path: "new.py"},
+				{Status: StatusDeleted, Path: "old.py"},
+				{Status: StatusModified, Path: filepath.FromSlash("src/app.py")},
+			},
+		},
+		{
+			name:   "переименование",
+			output: "R100\x00src/a.py\x00lib/a.py\x00",
+			want: []FileChange{
+				{Status: StatusRenamed, Path: filepath.FromSlash("lib/a.py"), OldPath: filepath.FromSlash("src/a.py")},
+			},
+		},
+		{
+			name:   "копия приводится к добавлению",
+			output: "C75\x00a.py\x00b.py\x00M\x00c.py\x00",
+			want: []FileChange{
+				{Status: StatusAdded, Path: "b.py"},
+				{Status: StatusModified, Path: "c.py"},
+			},
+		},
+		{
+			name:   "смена типа приводится к изменению",
+			output: "T\x00link.py\x00",
+			want:   []FileChange{{Status: StatusModified, Path: "link.py"}},
+		},
+		{
+			name:   "имя с пробелом и переводом строки",
+			output: "M\x00my file\nname.py\x00",
+			want:   []FileChange{{Status: StatusModified, Path: "my file\nname.py"}},
+		},
+		{
+			name:   "оборванное переименование",
+			output: "M\x00a.py\x00R100\x00b.py\x00",
+			want:   []FileChange{{Status: StatusModified, Path: "a.py"}},
+		},
+		{
+			name:   "оборванная запись без пути",
+			output: "A\x00a.py\x00D\x00",
+			want:   []FileChange{{Status: StatusAdded, Path: "a.py"}},
+		},
+		{
+			name:   "вывод без завершающего нуля",
+			output: "D\x00a.py",
+			want:   []FileChange{{Status: StatusDeleted, Path: "a.py"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNameStatus(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNameStatus(%q) = %+v, ожидалось %+v", tt.output, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,26 @@
 package models
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
 )
 
 // CodeBlock представляет блок кода с метаинформацией
 type CodeBlock struct {
-	FilePath       string   `json:"file_path"`     // Абсолютный путь к файлу
-	RelativePath   string   `json:"relative_path"` // Относительный путь от корня проекта
+	Project        string   `json:"project,omitempty"`   // Имя проекта, которому принадлежит блок
+	FilePath       string   `json:"file_path"`           // Абсолютный путь к файлу
+	RelativePath   string   `json:"relative_path"`       // Относительный путь от корня проекта
+	RealPath       string   `json:"real_path,omitempty"` // Реальный путь, если файл найден через символическую ссылку
 	BlockType      string   `json:"block_type"`
 	ClassName      *string  `json:"class_name,omitempty"`
 	MethodName     *string  `json:"method_name,omitempty"`
 	StartLine      int      `json:"start_line"`
 	EndLine        int      `json:"end_line"`
+	Ordinal        int      `json:"ordinal,omitempty"` // Номер среди блоков файла с тем же путём символа (0 — первый)
 	RawText        string   `json:"raw_text"`
 	CommitMessages []string `json:"commit_messages,omitempty"`
 }
@@ -84,6 +90,109 @@ func (cb *CodeBlock) SetRelativePath(relativePath string) {
 	cb.RelativePath = relativePath
 }
 
+// SymbolPath возвращает путь символа блока внутри файла: тип блока, класс и метод.
+// Путь не зависит от положения блока, поэтому по нему блок находится после правки файла.
+func (cb *CodeBlock) SymbolPath() string {
+	path := cb.BlockType + ":"
+	if cb.ClassName != nil {
+		path += *cb.ClassName
+	}
+	if cb.MethodName != nil {
+		path += "." + *cb.MethodName
+	}
+	return path
+}
+
+// AssignOrdinals нумерует блоки файла с одинаковым путём символа в порядке следования
+func AssignOrdinals(blocks []*CodeBlock) {
+	seen := make(map[string]int)
+	for _, block := range blocks {
+		symbol := block.SymbolPath()
+		block.Ordinal = seen[symbol]
+		seen[symbol]++
+	}
+}
+
+// StableID возвращает стабильный идентификатор блока в формате UUID.
+// Идентификатор вычисляется из проекта, относительного пути, пути символа и номера
+// среди одноимённых блоков, но не из строк: сдвиг блока при правке файла его не меняет.
+func (cb *CodeBlock) StableID() string {
+	className := ""
+	if cb.ClassName != nil {
+		className = *cb.ClassName
+	}
+
+	methodName := ""
+	if cb.MethodName != nil {
+		methodName = *cb.MethodName
+	}
+
+	key := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d",
+		cb.GetRelativePath(), cb.BlockType, className, methodName, cb.Ordinal)
+	if cb.Project != "" {
+		key = cb.Project + "\x00" + key
+	}
+	sum := sha1.Sum([]byte(key))
+
+	// Оформляем как UUID версии 5 (RFC 4122)
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ContentHash возвращает SHA-1 текста блока в hex.
+// Вместе с StableID позволяет понять, что блок не изменился между снимками индекса.
+func (cb *CodeBlock) ContentHash() string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(cb.RawText)))
+}
+
+// BodyHash возвращает SHA-256 нормализованного текста блока в hex.
+// Одинаковые тела (вендоринг, сгенерированный код, копипаста) дают один хеш
+// и разделяют один эмбединг, где бы они ни находились.
+func (cb *CodeBlock) BodyHash() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(NormalizeBody(cb.RawText))))
+}
+
+// NormalizeBody приводит текст блока к каноническому виду: переводы строк LF,
+// без хвостовых пробелов, без общего отступа и пустых строк по краям
+func NormalizeBody(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	// Убираем пустые строки в начале и в конце
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Убираем общий отступ непустых строк
+	indent := -1
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 || width < indent {
+			indent = width
+		}
+	}
+	if indent > 0 {
+		for i, line := range lines {
+			if len(line) >= indent {
+				lines[i] = line[indent:]
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // String возвращает строковое представление блока
 func (cb *CodeBlock) String() string {
 	className := ""
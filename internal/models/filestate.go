@@ -0,0 +1,16 @@
+package models
+
+// FileState сохранённое состояние файла: хеш содержимого и данные stat для проверки изменений без чтения
+type FileState struct {
+	Path    string `json:"path"`  // Путь файла в индексе
+	Hash    string `json:"hash"`  // SHA-256 содержимого (в базах до перехода на SHA-256 — MD5)
+	Size    int64  `json:"size"`  // Размер в байтах
+	ModTime int64  `json:"mtime"` // Время изменения в наносекундах Unix (0 — неизвестно)
+	Inode   uint64 `json:"inode"` // Номер inode (0 там, где он недоступен)
+}
+
+// SameStat проверяет, что данные stat совпадают с сохранёнными и содержимое можно не перечитывать.
+// Состояние без времени изменения никогда не совпадает: такой файл всегда хешируется заново.
+func (s FileState) SameStat(other FileState) bool {
+	return s.ModTime != 0 && s.ModTime == other.ModTime && s.Size == other.Size && s.Inode == other.Inode
+}
@@ -0,0 +1,10 @@
+package models
+
+// IndexState состояние индексации корня: коммит, на котором корень проиндексирован последний раз,
+// и файлы, которые в тот момент отличались от этого коммита
+type IndexState struct {
+	Root       string   `json:"root"`                  // Имя корня индексации (пустое для единственного корня)
+	CommitSHA  string   `json:"commit_sha"`            // SHA коммита HEAD на момент индексации
+	DirtyPaths []string `json:"dirty_paths,omitempty"` // Незакоммиченные и неотслеживаемые файлы на момент индексации
+	Settings   string   `json:"settings"`              // Отпечаток настроек сканирования: при изменении нужна полная проверка
+}
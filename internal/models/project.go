@@ -0,0 +1,8 @@
+package models
+
+// Project описывает репозиторий (проект), блоки которого хранятся в общей базе
+type Project struct {
+	Name      string `json:"name"`       // Уникальное имя проекта
+	Root      string `json:"root"`       // Абсолютный путь к корню проекта
+	RemoteURL string `json:"remote_url"` // URL удалённого репозитория (если есть)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Snapshot описывает снимок индекса проекта на определённом коммите или ветке
+type Snapshot struct {
+	Label     string    `json:"label"`      // Метка снимка (SHA коммита, ветка, тег или произвольное имя)
+	CommitSHA string    `json:"commit_sha"` // SHA коммита HEAD в момент создания снимка
+	Branch    string    `json:"branch"`     // Текущая ветка в момент создания снимка
+	CreatedAt time.Time `json:"created_at"` // Время создания снимка
+	Blocks    int       `json:"blocks"`     // Количество блоков в снимке
+}
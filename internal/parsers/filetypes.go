@@ -0,0 +1,168 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// FileTypes правила определения языка файлов, которые нельзя распознать по расширению:
+// точное имя файла, шаблон имени и интерпретатор из строки shebang.
+// Язык — имя парсера (GetName), которым разбирается файл.
+type FileTypes struct {
+	// filenames язык по точному имени файла
+	filenames map[string]string
+
+	// patterns шаблоны имени файла (синтаксис path.Match) в порядке добавления
+	patterns []fileTypePattern
+
+	// shebangs язык по имени интерпретатора из первой строки "#!"
+	shebangs map[string]string
+}
+
+// fileTypePattern шаблон имени файла и его язык
+type fileTypePattern struct {
+	pattern  string
+	language string
+}
+
+// NewFileTypes создаёт пустой набор правил
+func NewFileTypes() *FileTypes {
+	return &FileTypes{
+		filenames: make(map[string]string),
+		shebangs:  make(map[string]string),
+	}
+}
+
+// DefaultFileTypes создаёт набор правил для распространённых файлов без расширения
+func DefaultFileTypes() *FileTypes {
+	ft := NewFileTypes()
+	for _, rule := range []string{
+		"Dockerfile", "Containerfile", "Makefile", "GNUmakefile", "Jenkinsfile", "Vagrantfile", "Procfile",
+		".env.example", ".env.sample", ".env.template", ".env.dist",
+		"Dockerfile.*", "*.dockerfile", "Makefile.*", "*.mk", "Jenkinsfile.*",
+		"#!sh", "#!bash", "#!zsh", "#!ksh", "#!dash",
+	} {
+		ft.Add(rule, "text")
+	}
+	ft.Add("#!python", "python")
+	ft.Add("#!node", "javascript")
+	ft.Add("#!nodejs", "javascript")
+	ft.Add("#!php", "php")
+	return ft
+}
+
+// Add добавляет правило: "#!интерпретатор" для shebang, шаблон с *, ? или [ для имени файла,
+// иначе точное имя файла. Правило с тем же ключом заменяет прежнее.
+func (ft *FileTypes) Add(rule, language string) error {
+	rule = strings.TrimSpace(rule)
+	language = strings.TrimSpace(language)
+	if rule == "" || language == "" {
+		return fmt.Errorf("правило типа файла %q: шаблон и язык обязательны", rule)
+	}
+
+	switch {
+	case strings.HasPrefix(rule, "#!"):
+		ft.shebangs[strings.TrimSpace(rule[2:])] = language
+	case strings.ContainsAny(rule, "*?["):
+		if _, err := path.Match(rule, ""); err != nil {
+			return fmt.Errorf("правило типа файла %q: %w", rule, err)
+		}
+		for i := range ft.patterns {
+			if ft.patterns[i].pattern == rule {
+				ft.patterns[i].language = language
+				return nil
+			}
+		}
+		ft.patterns = append(ft.patterns, fileTypePattern{pattern: rule, language: language})
+	default:
+		ft.filenames[rule] = language
+	}
+	return nil
+}
+
+// Retain оставляет только правила для перечисленных языков
+func (ft *FileTypes) Retain(languages map[string]bool) {
+	for name, language := range ft.filenames {
+		if !languages[language] {
+			delete(ft.filenames, name)
+		}
+	}
+	patterns := ft.patterns[:0]
+	for _, pattern := range ft.patterns {
+		if languages[pattern.language] {
+			patterns = append(patterns, pattern)
+		}
+	}
+	ft.patterns = patterns
+	for interpreter, language := range ft.shebangs {
+		if !languages[language] {
+			delete(ft.shebangs, interpreter)
+		}
+	}
+}
+
+// Languages возвращает языки, на которые ссылаются правила
+func (ft *FileTypes) Languages() map[string]bool {
+	languages := make(map[string]bool)
+	for _, language := range ft.filenames {
+		languages[language] = true
+	}
+	for _, pattern := range ft.patterns {
+		languages[pattern.language] = true
+	}
+	for _, language := range ft.shebangs {
+		languages[language] = true
+	}
+	return languages
+}
+
+// MatchName возвращает язык по точному имени файла или шаблону имени (пустая строка, если правила нет)
+func (ft *FileTypes) MatchName(name string) string {
+	if language, ok := ft.filenames[name]; ok {
+		return language
+	}
+	for _, pattern := range ft.patterns {
+		if ok, _ := path.Match(pattern.pattern, name); ok {
+			return pattern.language
+		}
+	}
+	return ""
+}
+
+// MatchShebang возвращает язык по строке "#!" в начале содержимого (пустая строка, если правила нет).
+// Поддерживаются "#!/usr/bin/python3", "#!/usr/bin/env python3" и "#!/usr/bin/env -S node --flag";
+// версия интерпретатора (python3.11) отбрасывается, если точного правила нет.
+func (ft *FileTypes) MatchShebang(content []byte) string {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return ""
+	}
+	line := content[2:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+	if interpreter == "" {
+		return ""
+	}
+
+	if language, ok := ft.shebangs[interpreter]; ok {
+		return language
+	}
+	return ft.shebangs[strings.TrimRight(interpreter, "0123456789.")]
+}
@@ -0,0 +1,120 @@
+package parsers
+
+import "testing"
+
+func TestFileTypesMatch(t *testing.T) {
+	ft := DefaultFileTypes()
+	if err := ft.Add("Justfile", "text"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := ft.Add("#!ruby", "text"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	names := []struct {
+		name string
+		want string
+	}{
+		{"Dockerfile", "text"},
+		{"Dockerfile.prod", "text"},
+		{"api.dockerfile", "text"},
+		{"Makefile", "text"},
+		{"rules.mk", "text"},
+		{".env.example", "text"},
+		{"Justfile", "text"},
+		{"LICENSE", ""},
+		{"main.py", ""},
+	}
+	for _, tt := range names {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ft.MatchName(tt.name); got != tt.want {
+				t.Errorf("MatchName(%q) = %q, ожидалось %q", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	shebangs := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"прямой путь", "#!/bin/bash\necho ok\n", "text"},
+		{"env", "#!/usr/bin/env python3\nprint(1)\n", "python"},
+		{"версия интерпретатора", "#!/usr/bin/python3.11\n", "python"},
+		{"env с флагами", "#!/usr/bin/env -S node --no-warnings\n", "javascript"},
+		{"env с переменной", "#!/usr/bin/env LANG=C php\n", "php"},
+		{"пользовательское правило", "#!/usr/bin/env ruby\n", "text"},
+		{"неизвестный интерпретатор", "#!/usr/bin/env perl\n", ""},
+		{"без shebang", "echo ok\n", ""},
+		{"пустой shebang", "#!\n", ""},
+	}
+	for _, tt := range shebangs {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ft.MatchShebang([]byte(tt.content)); got != tt.want {
+				t.Errorf("MatchShebang(%q) = %q, ожидалось %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTypesAddErrors(t *testing.T) {
+	ft := NewFileTypes()
+	for _, tt := range []struct{ rule, language string }{
+		{"", "text"},
+		{"Dockerfile", ""},
+		{"[a-", "text"},
+	} {
+		if err := ft.Add(tt.rule, tt.language); err == nil {
+			t.Errorf("Add(%q, %q): ожидалась ошибка", tt.rule, tt.language)
+		}
+	}
+}
+
+func TestFileTypesRetain(t *testing.T) {
+	ft := DefaultFileTypes()
+	ft.Retain(map[string]bool{"python": true})
+
+	if languages := ft.Languages(); len(languages) != 1 || !languages["python"] {
+		t.Errorf("Languages = %v, ожидался только python", languages)
+	}
+	if got := ft.MatchName("Dockerfile"); got != "" {
+		t.Errorf("MatchName(Dockerfile) = %q, правило text должно быть удалено", got)
+	}
+	if got := ft.MatchShebang([]byte("#!/bin/bash\n")); got != "" {
+		t.Errorf("MatchShebang(bash) = %q, правило text должно быть удалено", got)
+	}
+	if got := ft.MatchShebang([]byte("#!/usr/bin/env python3\n")); got != "python" {
+		t.Errorf("MatchShebang(python3) = %q, ожидалось python", got)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	registry := NewParserRegistry()
+	registry.Register(NewPythonParser())
+	registry.Register(NewTextParser(1600))
+
+	tests := []struct {
+		path    string
+		content string
+		want    string
+	}{
+		{"src/app.py", "", "python"},
+		{"docs/README.md", "", "text"},
+		{"deploy/Dockerfile", "FROM alpine\n", "text"},
+		{"deploy/Dockerfile.dev", "FROM alpine\n", "text"},
+		{"bin/manage", "#!/usr/bin/env python3\n", "python"},
+		{"bin/run", "#!/bin/sh\n", "text"},
+		{"LICENSE", "MIT License\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			language := registry.DetectLanguage(tt.path, []byte(tt.content))
+			if language != tt.want {
+				t.Fatalf("DetectLanguage(%q) = %q, ожидалось %q", tt.path, language, tt.want)
+			}
+			if _, found := registry.GetParser(language); found != (tt.want != "") {
+				t.Errorf("GetParser(%q) found = %v", language, found)
+			}
+		})
+	}
+}
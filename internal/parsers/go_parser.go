@@ -0,0 +1,153 @@
+package parsers
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+
+	"gokb-embedder/internal/models"
+)
+
+// GoParser парсер для Go файлов на основе go/ast
+type GoParser struct{}
+
+// NewGoParser создаёт новый парсер Go файлов
+func NewGoParser() *GoParser {
+	return &GoParser{}
+}
+
+// GetName возвращает имя парсера
+func (gp *GoParser) GetName() string {
+	return "go"
+}
+
+// CanParse проверяет, может ли парсер обработать файл с данным расширением
+func (gp *GoParser) CanParse(fileExtension string) bool {
+	return fileExtension == ".go"
+}
+
+// ParseFile парсит Go файл и возвращает блоки кода
+func (gp *GoParser) ParseFile(filePath string) ([]*models.CodeBlock, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла %s: %w", filePath, err)
+	}
+
+	return gp.ParseContent(filePath, content)
+}
+
+// ParseContent парсит уже прочитанное содержимое Go файла. Блоки идут в порядке объявлений:
+// документация пакета, функции, методы (ClassName — тип получателя), структуры, интерфейсы,
+// остальные типы и группы const/var. Документирующий комментарий входит в блок своего объявления.
+func (gp *GoParser) ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка парсинга Go файла %s: %w", filePath, err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	newBlock := func(blockType string, className, methodName *string, from, to token.Pos) *models.CodeBlock {
+		startLine := fset.Position(from).Line
+		endLine := fset.Position(to).Line
+		text := strings.Join(lines[startLine-1:endLine], "\n")
+		return models.NewCodeBlock(filePath, blockType, className, methodName, startLine, endLine, text)
+	}
+
+	var blocks []*models.CodeBlock
+
+	// Документация пакета: комментарий перед package вместе с самой строкой package
+	if file.Doc != nil {
+		packageName := file.Name.Name
+		blocks = append(blocks, newBlock("package", &packageName, nil, file.Doc.Pos(), file.Name.End()))
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			blockType := "function"
+			var className *string
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				blockType = "method"
+				if name := receiverType(decl.Recv.List[0].Type); name != "" {
+					className = &name
+				}
+			}
+			funcName := decl.Name.Name
+			blocks = append(blocks, newBlock(blockType, className, &funcName, docPos(decl.Doc, decl.Pos()), decl.End()))
+
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.TYPE:
+				// Каждый тип группы — отдельный блок; комментарий одиночного объявления висит на GenDecl
+				for _, spec := range decl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					doc := typeSpec.Doc
+					from, to := typeSpec.Pos(), typeSpec.End()
+					if !decl.Lparen.IsValid() {
+						doc = decl.Doc
+						from = decl.Pos()
+					}
+					typeName := typeSpec.Name.Name
+					blocks = append(blocks, newBlock(typeKind(typeSpec), &typeName, nil, docPos(doc, from), to))
+				}
+
+			case token.CONST, token.VAR:
+				// Группа const/var — один блок, названный по первому имени
+				if len(decl.Specs) == 0 {
+					continue
+				}
+				valueSpec := decl.Specs[0].(*ast.ValueSpec)
+				name := valueSpec.Names[0].Name
+				blocks = append(blocks, newBlock(decl.Tok.String(), nil, &name, docPos(decl.Doc, decl.Pos()), decl.End()))
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+// docPos возвращает начало объявления с учётом документирующего комментария
+func docPos(doc *ast.CommentGroup, pos token.Pos) token.Pos {
+	if doc != nil {
+		return doc.Pos()
+	}
+	return pos
+}
+
+// receiverType возвращает имя типа получателя метода без указателя и параметров типа
+func receiverType(expr ast.Expr) string {
+	for {
+		switch x := expr.(type) {
+		case *ast.StarExpr:
+			expr = x.X
+		case *ast.ParenExpr:
+			expr = x.X
+		case *ast.IndexExpr:
+			expr = x.X
+		case *ast.IndexListExpr:
+			expr = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// typeKind возвращает тип блока для объявления типа: struct, interface или type
+func typeKind(spec *ast.TypeSpec) string {
+	if spec.Assign.IsValid() {
+		return "type"
+	}
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return "type"
+}
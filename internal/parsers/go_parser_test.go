@@ -0,0 +1,67 @@
+package parsers
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gokb-embedder/internal/models"
+)
+
+var update = flag.Bool("update", false, "перезаписать golden файлы")
+
+// TestGoParserGolden сверяет блоки файлов testdata/go/*.go с golden файлами рядом.
+// После намеренного изменения вывода: go test ./internal/parsers -run Golden -update
+func TestGoParserGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "go", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("нет входных файлов в testdata/go")
+	}
+
+	gp := NewGoParser()
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			blocks, err := gp.ParseFile(input)
+			if err != nil {
+				t.Fatalf("ParseFile: %v", err)
+			}
+			got := formatBlocks(blocks)
+
+			golden := strings.TrimSuffix(input, ".go") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("golden файл: %v (запустите с -update)", err)
+			}
+			if got != string(want) {
+				t.Errorf("блоки %s не совпадают с %s:\n%s", input, golden, got)
+			}
+		})
+	}
+}
+
+func TestGoParserSyntaxError(t *testing.T) {
+	_, err := NewGoParser().ParseContent("broken.go", []byte("package broken\n\nfunc (\n"))
+	if err == nil {
+		t.Fatal("ожидалась ошибка парсинга")
+	}
+}
+
+// formatBlocks выводит блоки в формате golden файлов: заголовок с типом, символом и строками, затем текст
+func formatBlocks(blocks []*models.CodeBlock) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		fmt.Fprintf(&b, "--- %s %d-%d\n%s\n", block.SymbolPath(), block.StartLine, block.EndLine, block.RawText)
+	}
+	return b.String()
+}
@@ -34,6 +34,11 @@ func (jp *JavaScriptParser) ParseFile(filePath string) ([]*models.CodeBlock, err
 		return nil, fmt.Errorf("ошибка чтения файла %s: %w", filePath, err)
 	}
 
+	return jp.ParseContent(filePath, content)
+}
+
+// ParseContent парсит уже прочитанное содержимое JavaScript файла
+func (jp *JavaScriptParser) ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error) {
 	// Парсим JavaScript код
 	return jp.parseJavaScriptContent(string(content), filePath)
 }
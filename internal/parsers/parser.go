@@ -1,6 +1,8 @@
 package parsers
 
 import (
+	"path/filepath"
+
 	"gokb-embedder/internal/models"
 )
 
@@ -9,6 +11,9 @@ type Parser interface {
 	// ParseFile парсит файл и возвращает блоки кода
 	ParseFile(filePath string) ([]*models.CodeBlock, error)
 
+	// ParseContent парсит уже прочитанное содержимое файла (без повторного чтения с диска)
+	ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error)
+
 	// CanParse проверяет, может ли парсер обработать файл с данным расширением
 	CanParse(fileExtension string) bool
 
@@ -16,31 +21,56 @@ type Parser interface {
 	GetName() string
 }
 
-// ParserRegistry реестр всех доступных парсеров
+// ParserRegistry реестр всех доступных парсеров; парсеры хранятся по языку (имени парсера)
 type ParserRegistry struct {
-	parsers map[string]Parser
+	parsers   map[string]Parser
+	fileTypes *FileTypes
 }
 
-// NewParserRegistry создаёт новый реестр парсеров
+// NewParserRegistry создаёт новый реестр парсеров с правилами типов файлов по умолчанию
 func NewParserRegistry() *ParserRegistry {
 	return &ParserRegistry{
-		parsers: make(map[string]Parser),
+		parsers:   make(map[string]Parser),
+		fileTypes: DefaultFileTypes(),
 	}
 }
 
+// SetFileTypes задаёт правила определения языка по имени файла и shebang
+func (pr *ParserRegistry) SetFileTypes(fileTypes *FileTypes) {
+	pr.fileTypes = fileTypes
+}
+
 // Register регистрирует парсер в реестре
 func (pr *ParserRegistry) Register(parser Parser) {
 	pr.parsers[parser.GetName()] = parser
 }
 
-// GetParser возвращает парсер для указанного расширения файла
-func (pr *ParserRegistry) GetParser(fileExtension string) (Parser, bool) {
-	for _, parser := range pr.parsers {
-		if parser.CanParse(fileExtension) {
-			return parser, true
+// DetectLanguage определяет язык файла: по точному имени, по расширению (CanParse
+// зарегистрированных парсеров), по шаблону имени и по shebang. Пустая строка — язык не определён.
+func (pr *ParserRegistry) DetectLanguage(filePath string, content []byte) string {
+	name := filepath.Base(filePath)
+	if language, ok := pr.fileTypes.filenames[name]; ok {
+		return language
+	}
+
+	if ext := filepath.Ext(name); ext != "" {
+		for language, parser := range pr.parsers {
+			if parser.CanParse(ext) {
+				return language
+			}
 		}
 	}
-	return nil, false
+
+	if language := pr.fileTypes.MatchName(name); language != "" {
+		return language
+	}
+	return pr.fileTypes.MatchShebang(content)
+}
+
+// GetParser возвращает парсер для языка, определённого DetectLanguage
+func (pr *ParserRegistry) GetParser(language string) (Parser, bool) {
+	parser, ok := pr.parsers[language]
+	return parser, ok
 }
 
 // GetAllParsers возвращает все зарегистрированные парсеры
@@ -34,6 +34,11 @@ func (pp *PHPParser) ParseFile(filePath string) ([]*models.CodeBlock, error) {
 		return nil, fmt.Errorf("ошибка чтения файла %s: %w", filePath, err)
 	}
 
+	return pp.ParseContent(filePath, content)
+}
+
+// ParseContent парсит уже прочитанное содержимое PHP файла
+func (pp *PHPParser) ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error) {
 	// Парсим PHP код
 	return pp.parsePHPContent(string(content), filePath)
 }
@@ -33,6 +33,11 @@ func (pp *PythonParser) ParseFile(filePath string) ([]*models.CodeBlock, error)
 		return nil, fmt.Errorf("ошибка чтения файла %s: %w", filePath, err)
 	}
 
+	return pp.ParseContent(filePath, content)
+}
+
+// ParseContent парсит уже прочитанное содержимое Python файла
+func (pp *PythonParser) ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error) {
 	// Парсим Python код (упрощённая версия)
 	return pp.parsePythonContent(string(content), filePath)
 }
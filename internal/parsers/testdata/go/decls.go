@@ -0,0 +1,70 @@
+// Package store хранит записи в памяти.
+//
+// Пример для golden теста парсера Go.
+package store
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotFound запись не найдена
+var ErrNotFound = errors.New("not found")
+
+// Уровни доступа
+const (
+	LevelRead Level = iota
+	LevelWrite
+	LevelAdmin
+)
+
+// Level уровень доступа
+type Level int
+
+// Store потокобезопасное хранилище записей
+type Store struct {
+	mu      sync.Mutex
+	records map[string]Record // записи по ключу
+}
+
+type (
+	// Record запись хранилища
+	Record struct {
+		Key   string
+		Value []byte
+	}
+
+	// Reader читает записи
+	Reader interface {
+		Get(key string) (Record, error)
+	}
+
+	// Handler обработчик записи
+	Handler func(Record) error
+
+	// Alias псевдоним записи
+	Alias = Record
+)
+
+// New создаёт пустое хранилище
+func New() *Store {
+	return &Store{records: make(map[string]Record)}
+}
+
+// Get возвращает запись по ключу
+func (s *Store) Get(key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (l Level) String() string {
+	return [...]string{"read", "write", "admin"}[l]
+}
+
+var _ Reader = (*Store)(nil)
@@ -0,0 +1,43 @@
+package generics
+
+// Number числовые типы
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// List связный список
+type List[T any] struct {
+	head *node[T]
+	size int
+}
+
+type node[T any] struct {
+	value T
+	next  *node[T]
+}
+
+// Push добавляет элемент в начало списка
+func (l *List[T]) Push(value T) {
+	l.head = &node[T]{value: value, next: l.head}
+	l.size++
+}
+
+// Pair пара ключ-значение
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Swap меняет ключ и значение местами
+func (p Pair[K, V]) Swap() Pair[V, K] {
+	return Pair[V, K]{Key: p.Value, Value: p.Key}
+}
+
+// Sum складывает числа
+func Sum[T Number](values ...T) T {
+	var total T
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
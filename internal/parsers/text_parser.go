@@ -45,6 +45,11 @@ func (tp *TextParser) ParseFile(filePath string) ([]*models.CodeBlock, error) {
 		return nil, fmt.Errorf("ошибка чтения файла %s: %w", filePath, err)
 	}
 
+	return tp.ParseContent(filePath, content)
+}
+
+// ParseContent разбивает на блоки уже прочитанное содержимое текстового файла
+func (tp *TextParser) ParseContent(filePath string, content []byte) ([]*models.CodeBlock, error) {
 	return tp.splitTextByTokens(string(content), filePath)
 }
 
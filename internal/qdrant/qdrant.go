@@ -0,0 +1,278 @@
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gokb-embedder/internal/models"
+)
+
+// DefaultBatchSize количество точек в одном запросе upsert
+const DefaultBatchSize = 64
+
+// Client предоставляет методы для работы с REST API Qdrant
+type Client struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// Point точка коллекции Qdrant
+type Point struct {
+	ID      string                 `json:"id"`
+	Vector  []float64              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// NewClient создаёт новый клиент Qdrant
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{},
+	}
+}
+
+// NewPoint создаёт точку из блока: идентификатор стабилен, метаданные блока идут в payload
+func NewPoint(block *models.CodeBlock, embedding []float64) Point {
+	payload := map[string]interface{}{
+		"project":       block.Project,
+		"file_path":     block.FilePath,
+		"relative_path": block.GetRelativePath(),
+		"block_type":    block.BlockType,
+		"start_line":    block.StartLine,
+		"end_line":      block.EndLine,
+		"raw_text":      block.RawText,
+		"body_hash":     block.BodyHash(),
+	}
+	if block.ClassName != nil {
+		payload["class_name"] = *block.ClassName
+	}
+	if block.MethodName != nil {
+		payload["method_name"] = *block.MethodName
+	}
+	if len(block.CommitMessages) > 0 {
+		payload["commit_messages"] = block.CommitMessages
+	}
+	if block.RealPath != "" {
+		payload["real_path"] = block.RealPath
+	}
+
+	return Point{
+		ID:      block.StableID(),
+		Vector:  embedding,
+		Payload: payload,
+	}
+}
+
+// EnsureCollection создаёт коллекцию, если её нет, и проверяет размерность существующей
+func (c *Client) EnsureCollection(ctx context.Context, collection string, dimension int, distance string) error {
+	var info struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors struct {
+						Size     int    `json:"size"`
+						Distance string `json:"distance"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+
+	status, err := c.do(ctx, http.MethodGet, c.collectionPath(collection), nil, &info)
+	if err != nil && status != http.StatusNotFound {
+		return fmt.Errorf("ошибка получения коллекции %s: %w", collection, err)
+	}
+
+	if status == http.StatusNotFound {
+		body := map[string]interface{}{
+			"vectors": map[string]interface{}{
+				"size":     dimension,
+				"distance": distance,
+			},
+		}
+		if _, err := c.do(ctx, http.MethodPut, c.collectionPath(collection), body, nil); err != nil {
+			return fmt.Errorf("ошибка создания коллекции %s: %w", collection, err)
+		}
+		return nil
+	}
+
+	vectors := info.Result.Config.Params.Vectors
+	if vectors.Size != dimension {
+		return fmt.Errorf("коллекция %s имеет размерность %d, ожидалась %d", collection, vectors.Size, dimension)
+	}
+	if !strings.EqualFold(vectors.Distance, distance) {
+		return fmt.Errorf("коллекция %s использует метрику %s, ожидалась %s", collection, vectors.Distance, distance)
+	}
+
+	return nil
+}
+
+// UpsertPoints добавляет или обновляет точки коллекции
+func (c *Client) UpsertPoints(ctx context.Context, collection string, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	body := map[string]interface{}{"points": points}
+	if _, err := c.do(ctx, http.MethodPut, c.collectionPath(collection)+"/points?wait=true", body, nil); err != nil {
+		return fmt.Errorf("ошибка upsert точек в %s: %w", collection, err)
+	}
+	return nil
+}
+
+// DeleteByFilePath удаляет все точки файла проекта по фильтру project и file_path
+func (c *Client) DeleteByFilePath(ctx context.Context, collection, project, filePath string) error {
+	must := []interface{}{
+		map[string]interface{}{
+			"key":   "file_path",
+			"match": map[string]interface{}{"value": filePath},
+		},
+	}
+	if project != "" {
+		must = append(must, map[string]interface{}{
+			"key":   "project",
+			"match": map[string]interface{}{"value": project},
+		})
+	}
+
+	body := map[string]interface{}{
+		"filter": map[string]interface{}{"must": must},
+	}
+	if _, err := c.do(ctx, http.MethodPost, c.collectionPath(collection)+"/points/delete?wait=true", body, nil); err != nil {
+		return fmt.Errorf("ошибка удаления точек файла %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// DeletePoints удаляет точки коллекции по идентификаторам
+func (c *Client) DeletePoints(ctx context.Context, collection string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	body := map[string]interface{}{"points": ids}
+	if _, err := c.do(ctx, http.MethodPost, c.collectionPath(collection)+"/points/delete?wait=true", body, nil); err != nil {
+		return fmt.Errorf("ошибка удаления точек из %s: %w", collection, err)
+	}
+	return nil
+}
+
+// collectionPath возвращает путь коллекции в API
+func (c *Client) collectionPath(collection string) string {
+	return "/collections/" + url.PathEscape(collection)
+}
+
+// do выполняет запрос к API и возвращает HTTP статус ответа
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка сериализации запроса: %w", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("api-key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("ошибка чтения ответа: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("ошибка API: %s - %s", resp.Status, string(respBody))
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return resp.StatusCode, fmt.Errorf("ошибка парсинга ответа: %w", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sink накапливает точки и отправляет их в коллекцию пачками
+type Sink struct {
+	client     *Client
+	collection string
+	batchSize  int
+	pending    []Point
+	upserted   int
+}
+
+// NewSink создаёт новый приёмник точек для коллекции
+func NewSink(client *Client, collection string, batchSize int) *Sink {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Sink{
+		client:     client,
+		collection: collection,
+		batchSize:  batchSize,
+	}
+}
+
+// Add добавляет блок в очередь и отправляет пачку, когда она заполнена
+func (s *Sink) Add(ctx context.Context, block *models.CodeBlock, embedding []float64) error {
+	s.pending = append(s.pending, NewPoint(block, embedding))
+	if len(s.pending) >= s.batchSize {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush отправляет накопленные точки
+func (s *Sink) Flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if err := s.client.UpsertPoints(ctx, s.collection, s.pending); err != nil {
+		return err
+	}
+	s.upserted += len(s.pending)
+	s.pending = s.pending[:0]
+	return nil
+}
+
+// DeleteFile удаляет точки файла проекта из коллекции
+func (s *Sink) DeleteFile(ctx context.Context, project, filePath string) error {
+	return s.client.DeleteByFilePath(ctx, s.collection, project, filePath)
+}
+
+// Delete удаляет точки блоков из коллекции по их стабильным идентификаторам
+func (s *Sink) Delete(ctx context.Context, blocks []*models.CodeBlock) error {
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.StableID()
+	}
+	return s.client.DeletePoints(ctx, s.collection, ids)
+}
+
+// Upserted возвращает количество отправленных точек
+func (s *Sink) Upserted() int {
+	return s.upserted
+}
@@ -0,0 +1,230 @@
+package qdrant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gokb-embedder/internal/models"
+)
+
+// fakeQdrant минимальная имитация REST API Qdrant
+type fakeQdrant struct {
+	mu          sync.Mutex
+	collections map[string]int
+	points      map[string]Point
+}
+
+func newFakeQdrant() *fakeQdrant {
+	return &fakeQdrant{
+		collections: make(map[string]int),
+		points:      make(map[string]Point),
+	}
+}
+
+func (f *fakeQdrant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "collections" {
+		http.NotFound(w, r)
+		return
+	}
+	name := parts[1]
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		size, ok := f.collections[name]
+		if !ok {
+			http.Error(w, `{"status":{"error":"Not found"}}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{
+				"config": map[string]interface{}{
+					"params": map[string]interface{}{
+						"vectors": map[string]interface{}{"size": size, "distance": "Cosine"},
+					},
+				},
+			},
+		})
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		var body struct {
+			Vectors struct {
+				Size int `json:"size"`
+			} `json:"vectors"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.collections[name] = body.Vectors.Size
+		w.Write([]byte(`{"result":true}`))
+	case len(parts) == 3 && parts[2] == "points" && r.Method == http.MethodPut:
+		var body struct {
+			Points []Point `json:"points"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, p := range body.Points {
+			if len(p.Vector) != f.collections[name] {
+				http.Error(w, `{"status":{"error":"Wrong vector dimension"}}`, http.StatusBadRequest)
+				return
+			}
+			f.points[p.ID] = p
+		}
+		w.Write([]byte(`{"result":{"status":"completed"}}`))
+	case len(parts) == 4 && parts[3] == "delete" && r.Method == http.MethodPost:
+		var body struct {
+			Points []string `json:"points"`
+			Filter struct {
+				Must []struct {
+					Key   string `json:"key"`
+					Match struct {
+						Value string `json:"value"`
+					} `json:"match"`
+				} `json:"must"`
+			} `json:"filter"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.Points) > 0 {
+			for _, id := range body.Points {
+				delete(f.points, id)
+			}
+			w.Write([]byte(`{"result":{"status":"completed"}}`))
+			return
+		}
+		for id, p := range f.points {
+			matched := true
+			for _, cond := range body.Filter.Must {
+				if p.Payload[cond.Key] != cond.Match.Value {
+					matched = false
+				}
+			}
+			if matched {
+				delete(f.points, id)
+			}
+		}
+		w.Write([]byte(`{"result":{"status":"completed"}}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func testBlock(filePath string, startLine int) *models.CodeBlock {
+	method := fmt.Sprintf("handler%d", startLine)
+	block := models.NewCodeBlock(filePath, "function", nil, &method, startLine, startLine+3, "def handler(): pass")
+	block.Project = "repo"
+	block.SetRelativePath(strings.TrimPrefix(filePath, "/repo/"))
+	return block
+}
+
+func TestSinkSync(t *testing.T) {
+	fake := newFakeQdrant()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient(server.URL, "")
+
+	if err := client.EnsureCollection(ctx, "kb", 3, "Cosine"); err != nil {
+		t.Fatalf("EnsureCollection: %v", err)
+	}
+	if fake.collections["kb"] != 3 {
+		t.Fatalf("коллекция создана с размерностью %d, ожидалось 3", fake.collections["kb"])
+	}
+
+	// Повторный вызов не пересоздаёт коллекцию, но проверяет размерность
+	if err := client.EnsureCollection(ctx, "kb", 3, "Cosine"); err != nil {
+		t.Fatalf("повторный EnsureCollection: %v", err)
+	}
+	if err := client.EnsureCollection(ctx, "kb", 4, "Cosine"); err == nil {
+		t.Error("ожидалась ошибка несовпадения размерности")
+	}
+
+	sink := NewSink(client, "kb", 2)
+	blocks := []*models.CodeBlock{
+		testBlock("/repo/a.py", 1),
+		testBlock("/repo/a.py", 10),
+		testBlock("/repo/b.py", 1),
+	}
+	for _, block := range blocks {
+		if err := sink.Add(ctx, block, []float64{0.1, 0.2, 0.3}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if sink.Upserted() != 3 || len(fake.points) != 3 {
+		t.Fatalf("отправлено %d, в коллекции %d точек; ожидалось 3", sink.Upserted(), len(fake.points))
+	}
+
+	// Повторная синхронизация тех же блоков не создаёт дубликатов
+	for _, block := range blocks {
+		sink.Add(ctx, block, []float64{0.3, 0.2, 0.1})
+	}
+	sink.Flush(ctx)
+	if len(fake.points) != 3 {
+		t.Errorf("после повторной синхронизации %d точек, ожидалось 3", len(fake.points))
+	}
+
+	point := fake.points[blocks[2].StableID()]
+	if point.Payload["relative_path"] != "b.py" || point.Payload["method_name"] != "handler1" ||
+		point.Payload["body_hash"] != blocks[2].BodyHash() {
+		t.Errorf("неожиданный payload: %v", point.Payload)
+	}
+
+	// Файл другого проекта с тем же путём не затрагивается
+	if err := sink.DeleteFile(ctx, "other", "/repo/a.py"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if len(fake.points) != 3 {
+		t.Errorf("удаление в другом проекте затронуло точки: осталось %d", len(fake.points))
+	}
+
+	// Удаление по идентификаторам затрагивает только перечисленные блоки
+	if err := sink.Delete(ctx, blocks[1:2]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.points[blocks[1].StableID()]; ok || len(fake.points) != 2 {
+		t.Errorf("после удаления блока осталось %d точек, ожидалось 2 без удалённого", len(fake.points))
+	}
+
+	if err := sink.DeleteFile(ctx, "repo", "/repo/a.py"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if len(fake.points) != 1 {
+		t.Errorf("после удаления файла осталось %d точек, ожидалась 1", len(fake.points))
+	}
+}
+
+func TestNewPointStableID(t *testing.T) {
+	first := NewPoint(testBlock("/repo/a.py", 1), nil)
+	if len(first.ID) != 36 || first.ID[14] != '5' {
+		t.Errorf("идентификатор %s не похож на UUID v5", first.ID)
+	}
+
+	// Сдвиг блока по строкам и правка тела не меняют идентификатор
+	shifted := testBlock("/repo/a.py", 1)
+	shifted.StartLine, shifted.EndLine = 40, 48
+	shifted.RawText = "def handler(): return 1"
+	if id := NewPoint(shifted, nil).ID; id != first.ID {
+		t.Errorf("идентификатор сдвинутого блока %s, ожидался %s", id, first.ID)
+	}
+
+	// Другой символ, другой файл и следующий одноимённый блок дают другие идентификаторы
+	second := testBlock("/repo/a.py", 1)
+	second.Ordinal = 1
+	for name, block := range map[string]*models.CodeBlock{
+		"другой символ": testBlock("/repo/a.py", 2),
+		"другой файл":   testBlock("/repo/b.py", 1),
+		"второй блок":   second,
+	} {
+		if id := NewPoint(block, nil).ID; id == first.ID {
+			t.Errorf("%s: идентификатор совпадает с исходным %s", name, id)
+		}
+	}
+}
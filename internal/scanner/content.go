@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// Причины пропуска файлов по содержимому
+const (
+	SkipTooLarge  = "размер больше MAX_FILE_SIZE"
+	SkipBinary    = "бинарный файл"
+	SkipMinified  = "минифицированный файл"
+	SkipGenerated = "сгенерированный файл"
+)
+
+const (
+	// binaryProbeSize сколько байт от начала файла проверяется на NUL (как в git)
+	binaryProbeSize = 8000
+
+	// generatedProbeSize в каком объёме начала файла ищутся маркеры генерации
+	generatedProbeSize = 2048
+
+	// contentProbeSize сколько байт от начала файла проверяется на UTF-8 и минификацию
+	contentProbeSize = 64 * 1024
+
+	// minifiedLineLength средняя длина строки, начиная с которой файл считается минифицированным
+	minifiedLineLength = 300
+
+	// minifiedMinSize файлы меньше этого размера не проверяются на минификацию
+	minifiedMinSize = 1024
+
+	// shebangProbeSize сколько байт читается из файла без расширения для поиска строки "#!"
+	shebangProbeSize = 256
+)
+
+// generatedMarkers маркеры сгенерированных файлов в начале файла
+var generatedMarkers = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`),
+	regexp.MustCompile(`@generated\b`),
+	regexp.MustCompile(`(?i)\bauto-?generated\b.*\bdo not (edit|modify)\b`),
+}
+
+// ClassifyContent возвращает причину пропуска файла по содержимому или пустую строку.
+// Проверяется только начало файла (contentProbeSize): NUL-байты, UTF-8 и число строк
+// собираются за один проход, маркеры генерации ищутся в первых generatedProbeSize байтах.
+func ClassifyContent(data []byte) string {
+	probe := data
+	if len(probe) > contentProbeSize {
+		probe = probe[:contentProbeSize]
+	}
+	// Символ, разрезанный границей пробы, не считается невалидным UTF-8
+	truncated := len(data) >= contentProbeSize
+
+	lines := 1
+	for i := 0; i < len(probe); {
+		c := probe[i]
+		if c < utf8.RuneSelf {
+			if c == 0 && i < binaryProbeSize {
+				return SkipBinary
+			}
+			if c == '\n' {
+				lines++
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(probe[i:])
+		if r == utf8.RuneError && size == 1 {
+			if truncated && !utf8.FullRune(probe[i:]) {
+				break
+			}
+			return SkipBinary
+		}
+		i += size
+	}
+
+	head := probe
+	if len(head) > generatedProbeSize {
+		head = head[:generatedProbeSize]
+	}
+	for _, marker := range generatedMarkers {
+		if marker.Match(head) {
+			return SkipGenerated
+		}
+	}
+
+	if len(probe) >= minifiedMinSize && len(probe)/lines > minifiedLineLength {
+		return SkipMinified
+	}
+
+	return ""
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gokb-embedder/internal/parsers"
+)
+
+func TestClassifyContent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"обычный код", "def handler():\n    return 1\n", ""},
+		{"NUL-байт", "PNG\x00\x01\x02", SkipBinary},
+		{"невалидный UTF-8", "abc\xff\xfe", SkipBinary},
+		{"маркер go generate", "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n", SkipGenerated},
+		{"маркер @generated", "/**\n * @generated SignedSource<<abc>>\n */\nmodule.exports = {};\n", SkipGenerated},
+		{"маркер auto-generated", "# This file is auto-generated, do not edit.\nkey: value\n", SkipGenerated},
+		{"минифицированный бандл", strings.Repeat("var a=1;", 400) + "\n", SkipMinified},
+		{"длинный, но обычный файл", strings.Repeat("const value = compute(a, b);\n", 200), ""},
+		{"слово generated в тексте", "# Generated reports live in reports/\n", ""},
+		{"невалидный UTF-8 за пределами пробы", strings.Repeat("x = 1\n", contentProbeSize/6+1) + "\xff", ""},
+		{"символ на границе пробы", strings.Repeat("x = 1\n", (contentProbeSize-1)/6) + strings.Repeat("a", (contentProbeSize-1)%6) + "я\n", ""},
+		{"длинные строки за пределами пробы", strings.Repeat("x = 1\n", contentProbeSize/6+1) + strings.Repeat("var a=1;", 400), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyContent([]byte(tt.data)); got != tt.want {
+				t.Errorf("ClassifyContent = %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFilesSkipsLargeFiles(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		"src/app.js":       "export const a = 1;\n",
+		"dist/bundle.js":   strings.Repeat("var a=1;", 400),
+		"src/api.pb.js":    "// Code generated by protoc. DO NOT EDIT.\nexport {};\n",
+		"fixtures/big.yml": strings.Repeat("key: value\n", 200),
+	})
+
+	s := NewScanner(root, []string{".js", ".yml"})
+	s.LoadGitignore()
+	s.SetMaxFileSize(1000)
+
+	// Содержимое проверяет пайплайн на прочитанных байтах: сканер отсекает только большие файлы
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+	got := make([]string, len(files))
+	for i, file := range files {
+		got[i] = filepath.ToSlash(file)
+	}
+	sort.Strings(got)
+	if want := "src/api.pb.js,src/app.js"; strings.Join(got, ",") != want {
+		t.Errorf("ScanFiles = %v, ожидалось %s", got, want)
+	}
+
+	skipped := s.Skipped()
+	if len(skipped) != 1 || skipped[SkipTooLarge] != 2 {
+		t.Errorf("Skipped = %v, ожидалось %s: 2", skipped, SkipTooLarge)
+	}
+}
+
+func TestScanFilesDetectsFileTypes(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		"app.py":             "print(1)\n",
+		"Dockerfile":         "FROM alpine\n",
+		"deploy/Makefile":    "all:\n\techo ok\n",
+		"bin/manage":         "#!/usr/bin/env python3\nprint(1)\n",
+		"bin/notes":          "plain text\n",
+		"LICENSE":            "MIT License\n",
+		"scripts/helper.rb":  "#!/usr/bin/env python3\n",
+		"docker/api.compose": "services: {}\n",
+	})
+
+	s := NewScanner(root, []string{".py"})
+	s.LoadGitignore()
+	s.SetFileTypes(parsers.DefaultFileTypes())
+
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+	got := make([]string, len(files))
+	for i, file := range files {
+		got[i] = filepath.ToSlash(file)
+	}
+	sort.Strings(got)
+
+	want := []string{"Dockerfile", "app.py", "bin/manage", "deploy/Makefile"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ScanFiles = %v, ожидалось %v", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID возвращает пару устройство/inode файла
+func fileID(info fs.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package scanner
+
+import "io/fs"
+
+// fileID на Windows недоступен через os.FileInfo: директории различаются по реальному пути
+func fileID(info fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
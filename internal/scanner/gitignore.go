@@ -0,0 +1,372 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule одно правило gitignore
+type ignoreRule struct {
+	// source файл, из которого прочитано правило (для статистики исключений)
+	source string
+
+	// base директория файла правил относительно корня ("" для корня и глобальных правил)
+	base string
+
+	// pattern исходный текст правила (для отладки)
+	pattern string
+
+	// re скомпилированный шаблон: для правил без слеша сопоставляется с именем,
+	// для остальных — с путём относительно base
+	re *regexp.Regexp
+
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// GitIgnore проверяет пути по правилам gitignore с приоритетами git:
+// core.excludesFile < .git/info/exclude < .gitignore корня < .gitignore вложенных директорий.
+// Внутри одного уровня побеждает последнее совпавшее правило.
+type GitIgnore struct {
+	root string
+
+	// fileName имя файлов правил в директориях (.gitignore, .gokbignore)
+	fileName string
+
+	// global правила core.excludesFile и .git/info/exclude в порядке возрастания приоритета
+	global []ignoreRule
+
+	// perDir правила из файлов fileName по директориям относительно корня (загружаются лениво)
+	perDir map[string][]ignoreRule
+}
+
+// NewGitIgnore создаёт матчер для репозитория и загружает глобальные правила
+func NewGitIgnore(root string) *GitIgnore {
+	g := NewIgnoreFileMatcher(root, ".gitignore")
+
+	if excludesFile := globalExcludesFile(root); excludesFile != "" {
+		g.global = append(g.global, readIgnoreFile(excludesFile, "core.excludesFile", "")...)
+	}
+	g.global = append(g.global, readIgnoreFile(infoExcludeFile(root), ".git/info/exclude", "")...)
+
+	return g
+}
+
+// NewIgnoreFileMatcher создаёт матчер только по файлам правил fileName в директориях проекта
+// (синтаксис gitignore, без глобальных правил git)
+func NewIgnoreFileMatcher(root, fileName string) *GitIgnore {
+	return &GitIgnore{
+		root:     root,
+		fileName: fileName,
+		perDir:   make(map[string][]ignoreRule),
+	}
+}
+
+// RuleCount возвращает количество загруженных правил (вложенные .gitignore учитываются после обращения к ним)
+func (g *GitIgnore) RuleCount() int {
+	count := len(g.global)
+	for _, rules := range g.perDir {
+		count += len(rules)
+	}
+	return count
+}
+
+// Ignored проверяет, игнорируется ли путь (относительно корня, с разделителями "/").
+// Как и в git, файл внутри игнорируемой директории нельзя вернуть отрицанием.
+func (g *GitIgnore) Ignored(relPath string, isDir bool) bool {
+	ignored, _ := g.Match(relPath, isDir)
+	return ignored
+}
+
+// Match как Ignored, но дополнительно возвращает сработавшее правило в виде "файл: шаблон"
+func (g *GitIgnore) Match(relPath string, isDir bool) (bool, string) {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	if relPath == "" || relPath == "." {
+		return false, ""
+	}
+
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule := g.match(strings.Join(parts[:i], "/"), true); rule != nil {
+			return true, rule.String()
+		}
+	}
+
+	if rule := g.match(relPath, isDir); rule != nil {
+		return true, rule.String()
+	}
+	return false, ""
+}
+
+// match применяет правила к одному пути без проверки родительских директорий.
+// Возвращает игнорирующее правило или nil, если путь не игнорируется.
+func (g *GitIgnore) match(relPath string, isDir bool) *ignoreRule {
+	var decided *ignoreRule
+	apply := func(rules []ignoreRule) {
+		for i := range rules {
+			if rules[i].matches(relPath, isDir) {
+				decided = &rules[i]
+			}
+		}
+	}
+
+	apply(g.global)
+
+	// .gitignore от корня к директории файла: более глубокие файлы правил важнее
+	apply(g.dirRules(""))
+	dir := path.Dir(relPath)
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := 1; i <= len(parts); i++ {
+			apply(g.dirRules(strings.Join(parts[:i], "/")))
+		}
+	}
+
+	if decided == nil || decided.negate {
+		return nil
+	}
+	return decided
+}
+
+// dirRules возвращает правила файла fileName директории, загружая их при первом обращении
+func (g *GitIgnore) dirRules(dir string) []ignoreRule {
+	if rules, ok := g.perDir[dir]; ok {
+		return rules
+	}
+
+	source := path.Join(dir, g.fileName)
+	rules := readIgnoreFile(filepath.Join(g.root, filepath.FromSlash(source)), source, dir)
+	g.perDir[dir] = rules
+	return rules
+}
+
+// String возвращает правило в виде "файл: шаблон"
+func (r ignoreRule) String() string {
+	return r.source + ": " + r.pattern
+}
+
+// matches проверяет правило на пути относительно корня
+func (r ignoreRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+
+	if !r.anchored {
+		return r.re.MatchString(path.Base(relPath))
+	}
+	return r.re.MatchString(relPath)
+}
+
+// readIgnoreFile читает файл правил; отсутствующий файл даёт пустой список
+func readIgnoreFile(filePath, source, base string) []ignoreRule {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			rule.source = source
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// parseIgnoreRule разбирает строку gitignore (false для пустых строк и комментариев)
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base, pattern: line}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// Слеш в начале или середине привязывает правило к директории файла правил
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := regexp.Compile("^" + wildmatchToRegexp(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+
+	return rule, true
+}
+
+// trimTrailingSpaces убирает хвостовые пробелы, кроме экранированных обратным слешем
+func trimTrailingSpaces(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		backslashes := 0
+		for i := end - 2; i >= 0 && line[i] == '\\'; i-- {
+			backslashes++
+		}
+		if backslashes%2 == 1 {
+			break
+		}
+		end--
+	}
+	return line[:end]
+}
+
+// wildmatchToRegexp переводит шаблон gitignore в регулярное выражение:
+// "*" и "?" не пересекают "/", "**" между слешами соответствует любому числу директорий,
+// поддерживаются классы символов [a-z], [!a-z] и экранирование обратным слешем
+func wildmatchToRegexp(pattern string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') &&
+			(i+2 == len(pattern) || pattern[i+2] == '/'):
+			switch {
+			case i+2 == len(pattern):
+				// "**" в конце: всё содержимое
+				sb.WriteString(".*")
+			default:
+				// "**/" в начале или "/**/" в середине: ноль или больше директорий
+				sb.WriteString("(?:.*/)?")
+				i++
+			}
+			i++
+		case c == '*':
+			// Прочие последовательности звёздочек работают как одна "*"
+			for i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+			}
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			class, width := bracketClass(pattern[i:])
+			if width == 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			sb.WriteString(class)
+			i += width - 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// bracketClass переводит класс символов "[...]" в регулярное выражение.
+// Возвращает ширину класса в шаблоне или 0, если скобка не закрыта.
+func bracketClass(pattern string) (string, int) {
+	var sb strings.Builder
+	sb.WriteString("[")
+
+	i := 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		// Отрицание никогда не включает разделитель пути
+		sb.WriteString("^/")
+		i++
+	}
+
+	first := true
+	for i < len(pattern) {
+		c := pattern[i]
+		switch {
+		case c == ']' && !first:
+			sb.WriteString("]")
+			return sb.String(), i + 1
+		case c == '[' && strings.HasPrefix(pattern[i:], "[:"):
+			end := strings.Index(pattern[i+2:], ":]")
+			if end < 0 {
+				sb.WriteString(`\[`)
+				i++
+				break
+			}
+			sb.WriteString(pattern[i : i+2+end+2])
+			i += 2 + end + 2
+		case c == '\\' && i+1 < len(pattern):
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i+1])))
+			i += 2
+		case c == '-' && !first && i+1 < len(pattern) && pattern[i+1] != ']':
+			sb.WriteString("-")
+			i++
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+		}
+		first = false
+	}
+
+	return "", 0
+}
+
+// globalExcludesFile возвращает путь core.excludesFile или путь по умолчанию $XDG_CONFIG_HOME/git/ignore
+func globalExcludesFile(root string) string {
+	cmd := exec.Command("git", "config", "--path", "core.excludesFile")
+	cmd.Dir = root
+	if output, err := cmd.Output(); err == nil {
+		if excludesFile := strings.TrimSpace(string(output)); excludesFile != "" {
+			return excludesFile
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// infoExcludeFile возвращает путь .git/info/exclude (с учётом worktree и отдельного GIT_DIR)
+func infoExcludeFile(root string) string {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "info/exclude")
+	cmd.Dir = root
+	if output, err := cmd.Output(); err == nil {
+		excludePath := strings.TrimSpace(string(output))
+		if !filepath.IsAbs(excludePath) {
+			excludePath = filepath.Join(root, excludePath)
+		}
+		return excludePath
+	}
+
+	return filepath.Join(root, ".git", "info", "exclude")
+}
@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitCheckIgnore возвращает множество путей, которые git считает игнорируемыми
+func gitCheckIgnore(t *testing.T, root string, paths []string) map[string]bool {
+	t.Helper()
+
+	cmd := exec.Command("git", "check-ignore", "--stdin")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	output, err := cmd.Output()
+	if err != nil {
+		// Код 1 означает, что ни один путь не игнорируется
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Fatalf("git check-ignore: %v", err)
+		}
+	}
+
+	ignored := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			ignored[line] = true
+		}
+	}
+	return ignored
+}
+
+func TestGitIgnoreMatchesGitCheckIgnore(t *testing.T) {
+	root := newFixture(t, true, nil)
+
+	home := os.Getenv("HOME")
+	writeFixture(t, home, map[string]string{
+		".gitconfig":         "[core]\n\texcludesFile = " + filepath.ToSlash(filepath.Join(home, "global-ignore")) + "\n",
+		"global-ignore":      "*.swp\n*.orig\n",
+		".config/git/ignore": "*.never\n",
+	})
+
+	writeFixture(t, root, map[string]string{
+		".git/info/exclude": "*.bak\n",
+		".gitignore": strings.Join([]string{
+			"# комментарий",
+			"*.log",
+			"!important.log",
+			"/build/",
+			"docs/**/*.tmp",
+			"**/cache",
+			"secret[0-9].txt",
+			"draft[!a-c].md",
+			`\#hash.txt`,
+			"trailing.txt   ",
+			"vendor/",
+			"!vendor/keep.go",
+			"a/**/b",
+			"!keep.orig",
+			"gen/**",
+			"*.py[co]",
+		}, "\n") + "\n",
+		"sub/.gitignore":      "*.go\n!main.go\nlocal/\n/anchored.txt\n",
+		"sub/deep/.gitignore": "!*.go\n",
+	})
+
+	paths := []string{
+		"app.log",
+		"important.log",
+		"catalog.go",
+		"logs/app.go",
+		"build/out.go",
+		"src/build/x.go",
+		"docs/x.tmp",
+		"docs/a/b/c.tmp",
+		"docs/readme.md",
+		"cache/x.go",
+		"src/cache/y.go",
+		"secret1.txt",
+		"secretA.txt",
+		"draftd.md",
+		"drafta.md",
+		"#hash.txt",
+		"hash.txt",
+		"trailing.txt",
+		"vendor/keep.go",
+		"vendor/lib.go",
+		"a/b",
+		"a/x/y/b",
+		"ab",
+		"sub/util.go",
+		"sub/main.go",
+		"sub/local/x.py",
+		"sub/anchored.txt",
+		"sub/deep/anchored.txt",
+		"sub/deep/z.go",
+		"x.bak",
+		"x.swp",
+		"x.never",
+		"keep.orig",
+		"y.orig",
+		"gen/a/b.go",
+		"mod.pyc",
+		"mod.py",
+		"README.md",
+	}
+	files := make(map[string]string, len(paths))
+	for _, path := range paths {
+		files[path] = "x\n"
+	}
+	writeFixture(t, root, files)
+
+	expected := gitCheckIgnore(t, root, paths)
+	if len(expected) == 0 {
+		t.Fatal("git check-ignore не нашёл игнорируемых путей, фикстура не работает")
+	}
+
+	matcher := NewGitIgnore(root)
+	for _, path := range paths {
+		if got := matcher.Ignored(path, false); got != expected[path] {
+			t.Errorf("%s: Ignored = %v, git check-ignore = %v", path, got, expected[path])
+		}
+	}
+}
+
+func TestWildmatchToRegexp(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"звёздочка не пересекает слеш", "a/*.go", "a/b/c.go", false},
+		{"звёздочка внутри директории", "a/*.go", "a/c.go", true},
+		{"двойная звёздочка в начале", "**/c.go", "a/b/c.go", true},
+		{"двойная звёздочка без директорий", "a/**/c.go", "a/c.go", true},
+		{"двойная звёздочка в конце", "a/**", "a/b/c.go", true},
+		{"вопрос один символ", "?.go", "ab.go", false},
+		{"класс символов", "[a-c].go", "b.go", true},
+		{"отрицание класса", "[!a-c].go", "b.go", false},
+		{"отрицание класса не включает слеш", "a[!x]b", "a/b", false},
+		{"экранированная звёздочка", `\*.go`, "x.go", false},
+		{"незакрытая скобка буквально", "[ab", "[ab", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := parseIgnoreRule(tt.pattern, "")
+			if !ok {
+				t.Fatalf("правило %q не разобрано", tt.pattern)
+			}
+			if got := rule.re.MatchString(tt.path); got != tt.want {
+				t.Errorf("%q против %q = %v, ожидалось %v (regexp %s)", tt.pattern, tt.path, got, tt.want, rule.re)
+			}
+		})
+	}
+}
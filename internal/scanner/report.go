@@ -0,0 +1,171 @@
+package scanner
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// NoExtension ключ ScanReport.Extensions для файлов без расширения
+const NoExtension = "(без расширения)"
+
+// ScanReport итоги одного сканирования: найденные файлы, счётчики по причинам и время
+type ScanReport struct {
+	RootDir string `json:"root_dir"`
+
+	// Source фактический источник списка файлов: ModeGit, ModeWalk, SourceGitDiff или SourceWatch
+	Source string `json:"source"`
+
+	// Partial проверены только перечисленные пути (ScanPaths, ScanChanged), а не все файлы корня
+	Partial bool `json:"partial,omitempty"`
+
+	// Fallback причина, по которой вместо ModeGit использован обход (пустая, если замены не было)
+	Fallback      string `json:"fallback,omitempty"`
+	SymlinkPolicy string `json:"symlink_policy"`
+
+	// GitignoreRules количество правил .gitignore корня и глобальных (при обходе файловой системы)
+	GitignoreRules int `json:"gitignore_rules,omitempty"`
+
+	// Files найденные файлы, пути относительно корня
+	Files []string `json:"files"`
+
+	TotalFiles int `json:"total_files"`
+
+	// MatchedFiles файлы с подходящим расширением или распознанным типом (включая DetectedFiles)
+	MatchedFiles int `json:"matched_files"`
+
+	// DetectedFiles файлы, выбранные не по расширению, а по имени или shebang
+	DetectedFiles int `json:"detected_files"`
+	IgnoredFiles  int `json:"ignored_files"`
+	SkippedFiles  int `json:"skipped_files"`
+	PrunedDirs    int `json:"pruned_dirs"`
+
+	// Extensions количество найденных файлов по расширению
+	Extensions map[string]int `json:"extensions"`
+
+	// Exclusions количество файлов, исключённых каждым правилом
+	Exclusions map[string]int `json:"exclusions"`
+
+	// PrunedDirRules количество директорий, отсечённых каждым правилом
+	PrunedDirRules map[string]int `json:"pruned_dir_rules"`
+
+	// Skipped количество файлов, пропущенных по каждой причине: по размеру — при сканировании,
+	// по содержимому (бинарные, минифицированные, сгенерированные) — при проверке изменений через AddSkipped
+	Skipped map[string]int `json:"skipped"`
+
+	// Links количество символических ссылок по итогам обработки
+	Links map[string]int `json:"links"`
+
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+
+	// ListDuration время получения списка файлов (git ls-files); при обходе входит в Duration
+	ListDuration time.Duration `json:"list_duration"`
+
+	// ContentDuration время чтения начала файлов без расширения для проверки shebang
+	ContentDuration time.Duration `json:"content_duration"`
+}
+
+// newScanReport создаёт пустой отчёт сканирования корня
+func newScanReport(rootDir, symlinkPolicy string) *ScanReport {
+	return &ScanReport{
+		RootDir:        rootDir,
+		SymlinkPolicy:  symlinkPolicy,
+		Extensions:     make(map[string]int),
+		Exclusions:     make(map[string]int),
+		PrunedDirRules: make(map[string]int),
+		Skipped:        make(map[string]int),
+		Links:          make(map[string]int),
+		StartedAt:      time.Now(),
+	}
+}
+
+// addFile добавляет найденный файл в отчёт
+func (r *ScanReport) addFile(relPath string) {
+	r.Files = append(r.Files, relPath)
+	ext := filepath.Ext(relPath)
+	if ext == "" {
+		ext = NoExtension
+	}
+	r.Extensions[ext]++
+}
+
+// AddSkipped учитывает файл, пропущенный по причине reason после сканирования
+func (r *ScanReport) AddSkipped(reason string) {
+	r.Skipped[reason]++
+	r.SkippedFiles++
+}
+
+// LinkCount возвращает общее количество встреченных символических ссылок
+func (r *ScanReport) LinkCount() int {
+	return countAll(r.Links)
+}
+
+// SortedCounts возвращает ключи счётчиков по убыванию значения (при равенстве — по алфавиту)
+func SortedCounts(counts map[string]int) []string {
+	return sortedRules(counts)
+}
+
+// Типы событий сканирования
+const (
+	// EventStart начало сканирования корня (Path — корень)
+	EventStart = "start"
+
+	// EventSource выбран источник списка файлов (Reason — ModeGit или ModeWalk)
+	EventSource = "source"
+
+	// EventFile файл принят (Path — путь относительно корня)
+	EventFile = "file"
+
+	// EventExcluded файл исключён правилом (Reason — правило)
+	EventExcluded = "excluded"
+
+	// EventSkipped файл пропущен по размеру (Reason — причина)
+	EventSkipped = "skipped"
+
+	// EventPruned директория отсечена целиком (Reason — правило)
+	EventPruned = "pruned"
+
+	// EventLink обработана символическая ссылка (Reason — итог обработки)
+	EventLink = "link"
+
+	// EventDone сканирование завершено (Report — итоговый отчёт)
+	EventDone = "done"
+)
+
+// ScanEvent событие сканирования для отображения прогресса
+type ScanEvent struct {
+	Type   string
+	Path   string
+	Reason string
+
+	// Report текущий отчёт; счётчики в нём обновляются по ходу сканирования
+	Report *ScanReport
+}
+
+// EventHandler получает события сканирования; вызывается синхронно из горутины сканирования
+type EventHandler func(event ScanEvent)
+
+// SetEventHandler задаёт обработчик событий сканирования (nil — события не отправляются)
+func (s *Scanner) SetEventHandler(handler EventHandler) {
+	s.onEvent = handler
+}
+
+// emit отправляет событие обработчику, если он задан
+func (s *Scanner) emit(report *ScanReport, eventType, path, reason string) {
+	if s.onEvent != nil {
+		s.onEvent(ScanEvent{Type: eventType, Path: path, Reason: reason, Report: report})
+	}
+}
+
+// countLink учитывает итог обработки символической ссылки
+func (s *Scanner) countLink(report *ScanReport, relPath, result string) {
+	report.Links[result]++
+	s.emit(report, EventLink, relPath, result)
+}
+
+// countPruned учитывает директорию, отсечённую правилом
+func (s *Scanner) countPruned(report *ScanReport, relPath, rule string) {
+	report.PrunedDirRules[rule]++
+	report.PrunedDirs++
+	s.emit(report, EventPruned, relPath, rule)
+}
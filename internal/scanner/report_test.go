@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanReport(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		".gitignore":         "build/\n*.log.md\n",
+		"src/app.py":         "print(1)\n",
+		"src/util.py":        "print(2)\n",
+		"docs/guide.md":      "# Guide\n",
+		"docs/debug.log.md":  "log\n",
+		"build/out.py":       "print(3)\n",
+		"src/big.py":         strings.Repeat("x = 1\n", 50),
+		"src/data.py":        "\x00\x01\x02",
+		"src/readme.txt":     "not selected\n",
+		"vendor/lib/mod.yml": "key: value\n",
+	})
+
+	s := NewScanner(root, []string{".py", ".md"})
+	s.LoadGitignore()
+	s.SetMaxFileSize(100)
+
+	var events []ScanEvent
+	s.SetEventHandler(func(event ScanEvent) {
+		events = append(events, event)
+	})
+
+	report, err := s.Scan()
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	counts := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"TotalFiles", report.TotalFiles, 9},
+		{"MatchedFiles", report.MatchedFiles, 6},
+		{"IgnoredFiles", report.IgnoredFiles, 1},
+		{"SkippedFiles", report.SkippedFiles, 1},
+		{"PrunedDirs", report.PrunedDirs, 1},
+		{"Files", len(report.Files), 4},
+		{"Extensions[.py]", report.Extensions[".py"], 3},
+		{"Extensions[.md]", report.Extensions[".md"], 1},
+		{"Skipped[too large]", report.Skipped[SkipTooLarge], 1},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s = %d, ожидалось %d", c.name, c.got, c.want)
+		}
+	}
+	if report.Source != ModeWalk || report.Fallback != "" {
+		t.Errorf("Source = %q, Fallback = %q, ожидался обход без замены", report.Source, report.Fallback)
+	}
+	if report.Duration <= 0 {
+		t.Errorf("Duration = %s, ожидалось положительное время", report.Duration)
+	}
+	if s.Report() != report {
+		t.Errorf("Report() должен возвращать отчёт последнего сканирования")
+	}
+
+	byType := make(map[string]int)
+	for _, event := range events {
+		byType[event.Type]++
+	}
+	expected := map[string]int{
+		EventStart: 1, EventSource: 1, EventFile: 4, EventExcluded: 1,
+		EventSkipped: 1, EventPruned: 1, EventDone: 1,
+	}
+	for eventType, count := range expected {
+		if byType[eventType] != count {
+			t.Errorf("событий %s: %d, ожидалось %d", eventType, byType[eventType], count)
+		}
+	}
+	if last := events[len(events)-1]; last.Type != EventDone || last.Report != report {
+		t.Errorf("последнее событие %q, ожидалось %q с итоговым отчётом", last.Type, EventDone)
+	}
+
+	// Пропуски по содержимому добавляет проверка изменений, как это делает пайплайн
+	for _, path := range report.Files {
+		content, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if reason := ClassifyContent(content); reason != "" {
+			report.AddSkipped(reason)
+		}
+	}
+	if report.SkippedFiles != 2 || report.Skipped[SkipBinary] != 1 {
+		t.Errorf("SkippedFiles = %d, Skipped = %v; ожидались большой и бинарный файлы", report.SkippedFiles, report.Skipped)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var decoded struct {
+		SkippedFiles int            `json:"skipped_files"`
+		Skipped      map[string]int `json:"skipped"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	for _, reason := range []string{SkipTooLarge, SkipBinary} {
+		if decoded.Skipped[reason] != 1 {
+			t.Errorf("JSON отчёта не содержит причину %q: %s", reason, data)
+		}
+	}
+	if decoded.SkippedFiles != 2 {
+		t.Errorf("skipped_files = %d в JSON, ожидалось 2", decoded.SkippedFiles)
+	}
+}
@@ -1,18 +1,71 @@
 package scanner
 
 import (
-	"bufio"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"time"
+
+	"gokb-embedder/internal/git"
+	"gokb-embedder/internal/parsers"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// GokbIgnoreFile имя файла правил проекта с синтаксисом gitignore
+const GokbIgnoreFile = ".gokbignore"
+
+// Источники списка файлов для сканирования
+const (
+	// ModeWalk обход файловой системы с применением правил .gitignore
+	ModeWalk = "walk"
+
+	// ModeGit список файлов из git ls-files: отслеживаемые и неотслеживаемые без игнорируемых
+	ModeGit = "git"
+
+	// SourceGitDiff источник ScanPaths: файлы из git diff с последнего проиндексированного коммита
+	SourceGitDiff = "git diff"
+
+	// SourceWatch источник ScanChanged: файлы из событий файловой системы
+	SourceWatch = "watch"
 )
 
 // Scanner предоставляет методы для сканирования файлов
 type Scanner struct {
-	rootDir           string
-	fileExtensions    []string
-	gitignorePatterns []string
+	rootDir        string
+	fileExtensions []string
+	mode           string
+	fileTypes      *parsers.FileTypes
+	gitignore      *GitIgnore
+	gokbignore     *GitIgnore
+
+	// includeGlobs если заданы, индексируются только совпавшие с ними файлы
+	includeGlobs []string
+	excludeGlobs []string
+
+	// maxFileSize файлы больше этого размера в байтах пропускаются (0 — без ограничения)
+	maxFileSize int64
+
+	// symlinkPolicy политика обработки символических ссылок (SymlinksIgnore, SymlinksInsideRoot, SymlinksFollow)
+	symlinkPolicy string
+
+	// report отчёт последнего сканирования
+	report *ScanReport
+
+	// onEvent обработчик событий сканирования
+	onEvent EventHandler
+
+	// realPaths реальные пути файлов, найденных через символические ссылки, по относительному пути
+	realPaths map[string]string
+
+	// visited пройденные директории для разрыва циклов ссылок
+	visited map[fileKey]bool
+
+	// realRoot корень сканирования с разрешёнными ссылками
+	realRoot string
 }
 
 // NewScanner создаёт новый сканер файлов
@@ -20,168 +73,445 @@ func NewScanner(rootDir string, fileExtensions []string) *Scanner {
 	return &Scanner{
 		rootDir:        rootDir,
 		fileExtensions: fileExtensions,
+		mode:           ModeWalk,
+		symlinkPolicy:  SymlinksInsideRoot,
 	}
 }
 
-// LoadGitignore загружает правила из .gitignore файла
+// LoadGitignore загружает правила игнорирования: core.excludesFile, .git/info/exclude,
+// .gitignore и .gokbignore корня; файлы правил вложенных директорий читаются при обходе
 func (s *Scanner) LoadGitignore() error {
-	gitignorePath := filepath.Join(s.rootDir, ".gitignore")
+	s.gitignore = NewGitIgnore(s.rootDir)
+	s.gitignore.dirRules("")
 
-	file, err := os.Open(gitignorePath)
-	if err != nil {
-		// .gitignore может не существовать, это нормально
-		return nil
+	s.gokbignore = NewIgnoreFileMatcher(s.rootDir, GokbIgnoreFile)
+	s.gokbignore.dirRules("")
+	return nil
+}
+
+// SetGlobs задаёт doublestar-шаблоны путей относительно корня: include ограничивает сканирование
+// совпавшими файлами, exclude исключает файлы после всех остальных проверок
+func (s *Scanner) SetGlobs(include, exclude []string) error {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("некорректный шаблон %q", pattern)
+		}
 	}
-	defer file.Close()
 
-	var patterns []string
-	scanner := bufio.NewScanner(file)
+	s.includeGlobs = include
+	s.excludeGlobs = exclude
+	return nil
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			patterns = append(patterns, line)
-		}
+// SetMode задаёт источник списка файлов: ModeWalk или ModeGit (вне Git репозитория — обход)
+func (s *Scanner) SetMode(mode string) error {
+	switch mode {
+	case ModeWalk, ModeGit:
+		s.mode = mode
+		return nil
+	default:
+		return fmt.Errorf("неизвестный режим сканирования %q (ожидается %s или %s)", mode, ModeWalk, ModeGit)
 	}
+}
 
-	s.gitignorePatterns = patterns
-	return scanner.Err()
+// SetFileTypes задаёт правила, по которым выбираются файлы без подходящего расширения
+// (Dockerfile, Makefile, скрипты с shebang)
+func (s *Scanner) SetFileTypes(fileTypes *parsers.FileTypes) {
+	s.fileTypes = fileTypes
 }
 
-// ScanFiles сканирует файлы в директории
+// SetMaxFileSize задаёт максимальный размер файла в байтах (0 — без ограничения)
+func (s *Scanner) SetMaxFileSize(size int64) {
+	s.maxFileSize = size
+}
+
+// Report возвращает отчёт последнего сканирования (nil, если сканирования не было)
+func (s *Scanner) Report() *ScanReport {
+	return s.report
+}
+
+// Skipped возвращает количество файлов, пропущенных при последнем сканировании по каждой причине:
+// размер, бинарное содержимое, минификация, маркеры генерации
+func (s *Scanner) Skipped() map[string]int {
+	return s.report.Skipped
+}
+
+// Exclusions возвращает количество файлов, исключённых каждым правилом при последнем сканировании
+func (s *Scanner) Exclusions() map[string]int {
+	return s.report.Exclusions
+}
+
+// PrunedDirs возвращает количество директорий, отсечённых каждым правилом при последнем сканировании
+func (s *Scanner) PrunedDirs() map[string]int {
+	return s.report.PrunedDirRules
+}
+
+// ScanFiles сканирует файлы в директории и возвращает пути относительно корня.
+// Подробности сканирования доступны через Report.
 func (s *Scanner) ScanFiles() ([]string, error) {
+	report, err := s.Scan()
+	if err != nil {
+		return nil, err
+	}
+	return report.Files, nil
+}
+
+// Scan сканирует файлы в директории и возвращает отчёт.
+// В режиме ModeGit список файлов берётся из git ls-files, иначе (и вне Git репозитория) —
+// обходом файловой системы, при котором игнорируемые директории (и всегда .git) отсекаются целиком.
+func (s *Scanner) Scan() (*ScanReport, error) {
+	report := newScanReport(s.rootDir, s.symlinkPolicy)
+	s.report = report
+	if err := s.resetLinks(); err != nil {
+		return nil, err
+	}
+	s.emit(report, EventStart, s.rootDir, "")
+
 	var files []string
-	var totalFiles, matchedFiles, ignoredFiles int
+	var err error
+	switch {
+	case s.mode == ModeGit && git.IsGitRepository(s.rootDir):
+		report.Source = ModeGit
+		s.emit(report, EventSource, s.rootDir, report.Source)
+		files, err = s.listGitFiles(report)
+	default:
+		if s.mode == ModeGit {
+			report.Fallback = "не является Git репозиторием"
+		}
+		report.Source = ModeWalk
+		if s.gitignore != nil {
+			report.GitignoreRules = s.gitignore.RuleCount()
+		}
+		s.emit(report, EventSource, s.rootDir, report.Source)
+		files, err = s.walkFiles(report)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сканирования файлов: %w", err)
+	}
 
-	fmt.Printf("🔍 Сканирование в: %s\n", s.rootDir)
-	fmt.Printf("📝 Ищем расширения: %v\n", s.fileExtensions)
-	fmt.Printf("🚫 Gitignore паттернов: %d\n", len(s.gitignorePatterns))
+	for _, file := range files {
+		report.addFile(file)
+	}
+	report.Duration = time.Since(report.StartedAt)
+	s.emit(report, EventDone, s.rootDir, "")
+	return report, nil
+}
 
-	err := filepath.Walk(s.rootDir, func(path string, info os.FileInfo, err error) error {
+// walkFiles обходит файловую систему от корня, отсекая игнорируемые директории
+func (s *Scanner) walkFiles(report *ScanReport) ([]string, error) {
+	return s.walkTree(s.rootDir, "", report)
+}
+
+// walkTree обходит директорию dir, доступную под путём base относительно корня
+// ("" для самого корня, путь ссылки для директорий, найденных через символические ссылки)
+func (s *Scanner) walkTree(dir, base string, report *ScanReport) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Пропускаем директории
-		if info.IsDir() {
-			return nil
+		// Получаем относительный путь
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("ошибка получения относительного пути: %w", err)
+		}
+		if base != "" {
+			relPath = filepath.Join(base, relPath)
 		}
 
-		totalFiles++
-		ext := filepath.Ext(path)
-
-		// Проверяем расширение файла
-		if !contains(s.fileExtensions, ext) {
+		// Директории проверяются по правилам игнорирования и отсекаются целиком
+		if entry.IsDir() {
+			if path != dir {
+				if rule := s.dirExcludedBy(entry.Name(), relPath); rule != "" {
+					s.countPruned(report, relPath, rule)
+					return filepath.SkipDir
+				}
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return fmt.Errorf("ошибка получения информации о директории %s: %w", path, err)
+			}
+			// Корень ссылки уже отмечен в followLink, повторный проход означает цикл
+			if !s.visit(path, info) && path != dir {
+				s.countLink(report, relPath, LinkLoop)
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		matchedFiles++
-
-		// Проверяем .gitignore
-		if s.shouldIgnoreFile(path) {
-			ignoredFiles++
-			return nil
+		if entry.Type()&fs.ModeSymlink != 0 {
+			linked, err := s.followLink(path, relPath, true, report)
+			files = append(files, linked...)
+			return err
 		}
 
-		// Получаем относительный путь
-		relPath, err := filepath.Rel(s.rootDir, path)
+		accepted, err := s.acceptFile(path, relPath, entry.Info, true, report)
 		if err != nil {
-			return fmt.Errorf("ошибка получения относительного пути: %w", err)
+			return err
+		}
+		if accepted {
+			files = append(files, relPath)
+			// Файлы внутри директории, найденной через ссылку, запоминают реальный путь
+			if base != "" {
+				s.realPaths[relPath] = path
+			}
 		}
-
-		files = append(files, relPath)
 		return nil
 	})
 
+	return files, err
+}
+
+// listGitFiles берёт список файлов из git ls-files. Правила .gitignore уже применены git
+// к неотслеживаемым файлам, а отслеживаемые индексируются, даже если подпадают под них;
+// .gokbignore и шаблоны конфигурации проверяются как обычно.
+func (s *Scanner) listGitFiles(report *ScanReport) ([]string, error) {
+	gitService, err := git.NewGitService(s.rootDir)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка сканирования файлов: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("📊 Статистика сканирования:\n")
-	fmt.Printf("  - Всего файлов: %d\n", totalFiles)
-	fmt.Printf("  - Подходящих расширений: %d\n", matchedFiles)
-	fmt.Printf("  - Игнорировано .gitignore: %d\n", ignoredFiles)
-	fmt.Printf("  - Обработано: %d\n", len(files))
+	listStart := time.Now()
+	relPaths, err := gitService.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	report.ListDuration = time.Since(listStart)
 
-	return files, nil
+	return s.acceptPaths(relPaths, false, report)
+}
+
+// ScanPaths проверяет только перечисленные пути относительно корня по тем же правилам, что и ModeGit:
+// пути берутся из git diff и git ls-files, поэтому .gitignore к ним уже применён git.
+// Несуществующие пути пропускаются.
+func (s *Scanner) ScanPaths(relPaths []string) (*ScanReport, error) {
+	return s.scanPaths(relPaths, SourceGitDiff, false)
+}
+
+// ScanChanged проверяет пути относительно корня из событий файловой системы. В отличие от ScanPaths
+// к ним применяются правила .gitignore: события приходят и для файлов, которые git не видит.
+// Несуществующие пути и директории пропускаются.
+func (s *Scanner) ScanChanged(relPaths []string) (*ScanReport, error) {
+	return s.scanPaths(relPaths, SourceWatch, true)
 }
 
-// shouldIgnoreFile проверяет, должен ли файл быть проигнорирован
-func (s *Scanner) shouldIgnoreFile(filePath string) bool {
-	relPath, err := filepath.Rel(s.rootDir, filePath)
+// scanPaths проверяет перечисленные пути и составляет отчёт с указанным источником
+func (s *Scanner) scanPaths(relPaths []string, source string, withGitignore bool) (*ScanReport, error) {
+	report := newScanReport(s.rootDir, s.symlinkPolicy)
+	s.report = report
+	if err := s.resetLinks(); err != nil {
+		return nil, err
+	}
+	s.emit(report, EventStart, s.rootDir, "")
+
+	report.Source = source
+	report.Partial = true
+	s.emit(report, EventSource, s.rootDir, report.Source)
+
+	files, err := s.acceptPaths(relPaths, withGitignore, report)
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("ошибка сканирования файлов: %w", err)
 	}
 
-	// Нормализуем разделители путей
-	relPath = strings.ReplaceAll(relPath, "\\", "/")
+	for _, file := range files {
+		report.addFile(file)
+	}
+	report.Duration = time.Since(report.StartedAt)
+	s.emit(report, EventDone, s.rootDir, "")
+	return report, nil
+}
 
-	for _, pattern := range s.gitignorePatterns {
-		if s.matchesPattern(relPath, pattern) {
-			return true
+// DirExcluded проверяет, что директория (путь относительно корня) отсекается правилами игнорирования
+func (s *Scanner) DirExcluded(relPath string) bool {
+	return s.dirExcludedBy(filepath.Base(relPath), relPath) != ""
+}
+
+// acceptPaths проверяет перечисленные пути: подмодули, директории и удалённые файлы пропускаются,
+// ссылки проходятся по политике. withGitignore отключается для путей от git: к ним .gitignore уже применён.
+func (s *Scanner) acceptPaths(relPaths []string, withGitignore bool, report *ScanReport) ([]string, error) {
+	var files []string
+	for _, relPath := range relPaths {
+		path := filepath.Join(s.rootDir, relPath)
+
+		// Удалённые из рабочей копии, но ещё не закоммиченные файлы и подмодули пропускаются
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("ошибка получения информации о файле %s: %w", path, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		// Символические ссылки git хранит как файлы: цель проверяется по политике ссылок
+		if info.Mode()&fs.ModeSymlink != 0 {
+			linked, err := s.followLink(path, relPath, withGitignore, report)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, linked...)
+			continue
+		}
+
+		stat := func() (fs.FileInfo, error) { return info, nil }
+		accepted, err := s.acceptFile(path, relPath, stat, withGitignore, report)
+		if err != nil {
+			return nil, err
+		}
+		if accepted {
+			files = append(files, relPath)
 		}
 	}
 
-	return false
+	return files, nil
 }
 
-// matchesPattern проверяет, соответствует ли путь паттерну
-func (s *Scanner) matchesPattern(path, pattern string) bool {
-	// Убираем слеш в начале, если есть
-	if strings.HasPrefix(pattern, "/") {
-		pattern = pattern[1:]
+// acceptFile проверяет файл: расширение, правила исключения и размер.
+// withGitignore отключается, когда .gitignore уже применён источником файлов.
+func (s *Scanner) acceptFile(path, relPath string, stat func() (fs.FileInfo, error), withGitignore bool, report *ScanReport) (bool, error) {
+	report.TotalFiles++
+
+	// Проверяем расширение файла, а для остальных файлов — имя и shebang
+	if !contains(s.fileExtensions, filepath.Ext(path)) {
+		detected, err := s.detectFileType(path, report)
+		if err != nil || !detected {
+			return false, err
+		}
+		report.DetectedFiles++
+	}
+	report.MatchedFiles++
+
+	// Проверяем .gitignore, .gokbignore и шаблоны конфигурации
+	if rule := s.excludedBy(relPath, withGitignore); rule != "" {
+		report.Exclusions[rule]++
+		report.IgnoredFiles++
+		s.emit(report, EventExcluded, relPath, rule)
+		return false, nil
 	}
 
-	// Проверяем точное совпадение
-	if s.globMatch(path, pattern) {
-		return true
+	// Проверяем размер; содержимое проверяет пайплайн на уже прочитанных байтах
+	info, err := stat()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения информации о файле %s: %w", path, err)
+	}
+	if s.maxFileSize > 0 && info.Size() > s.maxFileSize {
+		report.AddSkipped(SkipTooLarge)
+		s.emit(report, EventSkipped, relPath, SkipTooLarge)
+		return false, nil
 	}
 
-	// Проверяем, находится ли файл внутри директории
-	if strings.HasSuffix(pattern, "/") {
-		dirPattern := pattern[:len(pattern)-1] // убираем trailing slash
-		pathParts := strings.Split(path, "/")
-		for _, part := range pathParts {
-			if part == dirPattern {
-				return true
-			}
+	s.emit(report, EventFile, relPath, "")
+	return true, nil
+}
+
+// detectFileType проверяет файл с невыбранным расширением по правилам типов файлов:
+// точному имени, шаблону имени и, для файлов без расширения, строке shebang
+func (s *Scanner) detectFileType(path string, report *ScanReport) (bool, error) {
+	if s.fileTypes == nil {
+		return false, nil
+	}
+
+	name := filepath.Base(path)
+	if s.fileTypes.MatchName(name) != "" {
+		return true, nil
+	}
+	if filepath.Ext(name) != "" {
+		return false, nil
+	}
+
+	contentStart := time.Now()
+	defer func() { report.ContentDuration += time.Since(contentStart) }()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения файла %s: %w", path, err)
+	}
+	defer file.Close()
+
+	head := make([]byte, shebangProbeSize)
+	n, _ := io.ReadFull(file, head)
+	return s.fileTypes.MatchShebang(head[:n]) != "", nil
+}
+
+// dirExcludedBy возвращает правило, по которому директория отсекается, или пустую строку.
+// Директория .git отсекается всегда, остальные — по .gitignore и .gokbignore.
+func (s *Scanner) dirExcludedBy(name, relPath string) string {
+	if name == ".git" {
+		return ".git"
+	}
+
+	for _, matcher := range []*GitIgnore{s.gitignore, s.gokbignore} {
+		if matcher == nil {
+			continue
 		}
-	} else {
-		// Проверяем, начинается ли путь с этой директории
-		if strings.HasPrefix(path, pattern+"/") {
-			return true
+		if ignored, rule := matcher.Match(relPath, true); ignored {
+			return rule
 		}
+	}
+	return ""
+}
 
-		// Проверяем точное совпадение с файлом
-		if path == pattern {
-			return true
-		}
+// excludedBy возвращает правило, исключившее файл, или пустую строку.
+// Порядок проверок: .gitignore (если withGitignore), .gokbignore, INCLUDE_GLOBS, EXCLUDE_GLOBS.
+func (s *Scanner) excludedBy(relPath string, withGitignore bool) string {
+	slashPath := filepath.ToSlash(relPath)
 
-		// Проверяем, является ли паттерн директорией в пути
-		pathParts := strings.Split(path, "/")
-		for _, part := range pathParts {
-			if part == pattern {
-				return true
-			}
+	for _, matcher := range []*GitIgnore{s.gitignore, s.gokbignore} {
+		if matcher == nil || (matcher == s.gitignore && !withGitignore) {
+			continue
+		}
+		if ignored, rule := matcher.Match(slashPath, false); ignored {
+			return rule
 		}
 	}
 
-	return false
-}
+	if len(s.includeGlobs) > 0 && matchAnyGlob(s.includeGlobs, slashPath) == "" {
+		return "INCLUDE_GLOBS: нет совпадений"
+	}
+
+	if pattern := matchAnyGlob(s.excludeGlobs, slashPath); pattern != "" {
+		return "EXCLUDE_GLOBS: " + pattern
+	}
 
-// globMatch проверяет соответствие пути glob-паттерну
-func (s *Scanner) globMatch(path, pattern string) bool {
-	// Простая реализация glob-паттернов
-	// В реальном проекте можно использовать более сложную логику
+	return ""
+}
 
-	// Заменяем * на .*
-	pattern = strings.ReplaceAll(pattern, "*", ".*")
+// matchAnyGlob возвращает первый совпавший doublestar-шаблон или пустую строку
+func matchAnyGlob(patterns []string, slashPath string) string {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, slashPath); ok {
+			return pattern
+		}
+	}
+	return ""
+}
 
-	// Добавляем начало и конец строки
-	pattern = "^" + pattern + "$"
+// sortedRules возвращает правила по убыванию количества исключённых файлов
+func sortedRules(exclusions map[string]int) []string {
+	rules := make([]string, 0, len(exclusions))
+	for rule := range exclusions {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if exclusions[rules[i]] != exclusions[rules[j]] {
+			return exclusions[rules[i]] > exclusions[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	return rules
+}
 
-	// Простая проверка (в реальном проекте лучше использовать regexp)
-	return strings.Contains(path, strings.ReplaceAll(pattern, ".*", ""))
+// countAll возвращает сумму счётчиков
+func countAll(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
 }
 
 // contains проверяет, содержится ли элемент в слайсе
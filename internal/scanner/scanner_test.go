@@ -0,0 +1,306 @@
+package scanner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFixture создаёт корень проекта с файлами files. Системная и пользовательская конфигурация git
+// отключаются, чтобы правила игнорирования машины не влияли на тест; withGit создаёт в корне репозиторий.
+func newFixture(t *testing.T, withGit bool, files map[string]string) string {
+	t.Helper()
+	if withGit {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git не установлен")
+		}
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+
+	root := t.TempDir()
+	if withGit {
+		gitRun(t, root, "init", "-q")
+	}
+	writeFixture(t, root, files)
+	return root
+}
+
+// writeFixture создаёт файлы с указанным содержимым относительно root
+func writeFixture(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+// gitRun выполняет команду git в репозитории фикстуры
+func gitRun(t *testing.T, root string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+}
+
+func TestScanFilesProjectRules(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		".gitignore":                 "*.log\n",
+		".gokbignore":                "fixtures/\n",
+		"src/.gokbignore":            "*_gen.py\n",
+		"src/app.py":                 "x",
+		"src/models_gen.py":          "x",
+		"src/fixtures/data.py":       "x",
+		"src/migrations/0001.py":     "x",
+		"src/db/migrations/0002.py":  "x",
+		"docs/guide.md":              "x",
+		"tests/test_app.py":          "x",
+		"debug.log":                  "x",
+		"src/__snapshots__/ui.py":    "x",
+		"src/__snapshots__/keep.txt": "x",
+	})
+
+	s := NewScanner(root, []string{".py", ".md", ".log"})
+	if err := s.LoadGitignore(); err != nil {
+		t.Fatalf("LoadGitignore: %v", err)
+	}
+	if err := s.SetGlobs([]string{"docs/**", "src/**"}, []string{"**/migrations/**", "**/__snapshots__/**"}); err != nil {
+		t.Fatalf("SetGlobs: %v", err)
+	}
+
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+	if len(files) != 2 || filepath.ToSlash(files[0]) != "docs/guide.md" || filepath.ToSlash(files[1]) != "src/app.py" {
+		t.Errorf("ScanFiles = %v, ожидались docs/guide.md и src/app.py", files)
+	}
+
+	expected := map[string]int{
+		".gitignore: *.log":                  1,
+		"src/.gokbignore: *_gen.py":          1,
+		"INCLUDE_GLOBS: нет совпадений":      1,
+		"EXCLUDE_GLOBS: **/migrations/**":    2,
+		"EXCLUDE_GLOBS: **/__snapshots__/**": 1,
+	}
+	exclusions := s.Exclusions()
+	if len(exclusions) != len(expected) {
+		t.Errorf("Exclusions = %v, ожидалось %v", exclusions, expected)
+	}
+	for rule, count := range expected {
+		if exclusions[rule] != count {
+			t.Errorf("правило %q исключило %d файлов, ожидалось %d", rule, exclusions[rule], count)
+		}
+	}
+
+	// Директория из .gokbignore отсекается целиком
+	if pruned := s.PrunedDirs(); len(pruned) != 1 || pruned[".gokbignore: fixtures/"] != 1 {
+		t.Errorf("PrunedDirs = %v, ожидалась только fixtures/", pruned)
+	}
+
+	if err := s.SetGlobs(nil, []string{"src/[a"}); err == nil {
+		t.Error("ожидалась ошибка для некорректного шаблона")
+	}
+}
+
+func TestScanFilesPrunesIgnoredDirectories(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		".gitignore":                   "node_modules/\nvenv\n",
+		".git/hooks/pre-commit.py":     "x",
+		"node_modules/pkg/index.js":    "x",
+		"node_modules/pkg/lib/util.js": "x",
+		"venv/lib/site.py":             "x",
+		"src/node_modules/inner/a.js":  "x",
+		"src/app.js":                   "x",
+	})
+
+	// Отсечённая директория без прав на чтение не должна вызывать ошибку обхода
+	locked := filepath.Join(root, "venv", "locked")
+	if err := os.MkdirAll(locked, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	os.Chmod(locked, 0o000)
+	defer os.Chmod(locked, 0o755)
+
+	s := NewScanner(root, []string{".js", ".py"})
+	s.LoadGitignore()
+
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+	if len(files) != 1 || filepath.ToSlash(files[0]) != "src/app.js" {
+		t.Errorf("ScanFiles = %v, ожидался только src/app.js", files)
+	}
+
+	expected := map[string]int{
+		".git":                      1,
+		".gitignore: node_modules/": 2,
+		".gitignore: venv":          1,
+	}
+	pruned := s.PrunedDirs()
+	for rule, count := range expected {
+		if pruned[rule] != count {
+			t.Errorf("правило %q отсекло %d директорий, ожидалось %d (%v)", rule, pruned[rule], count, pruned)
+		}
+	}
+	if len(s.Exclusions()) != 0 {
+		t.Errorf("файлы в отсечённых директориях не должны проверяться: %v", s.Exclusions())
+	}
+}
+
+func TestScanFilesGitMode(t *testing.T) {
+	root := newFixture(t, true, map[string]string{
+		".gitignore":            "*.log\nbuild/\n",
+		".gokbignore":           "fixtures/\n",
+		"src/app.py":            "x",
+		"src/my module.py":      "x",
+		"src/модуль.py":         "x",
+		"build/generated.py":    "x",
+		"build/tracked.py":      "x",
+		"debug.log":             "x",
+		"src/fixtures/data.py":  "x",
+		"src/removed.py":        "x",
+		"untracked/new_file.py": "x",
+	})
+	gitRun(t, root, "add", "src/app.py", "src/my module.py", "src/модуль.py", "src/removed.py", "src/fixtures/data.py")
+	gitRun(t, root, "add", "-f", "build/tracked.py")
+	if err := os.Remove(filepath.Join(root, "src", "removed.py")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	s := NewScanner(root, []string{".py", ".log"})
+	s.LoadGitignore()
+	if err := s.SetMode(ModeGit); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, file := range files {
+		got[filepath.ToSlash(file)] = true
+	}
+	expected := []string{
+		"build/tracked.py",
+		"src/app.py",
+		"src/my module.py",
+		"src/модуль.py",
+		"untracked/new_file.py",
+	}
+	if len(got) != len(expected) {
+		t.Errorf("ScanFiles = %v, ожидалось %v", files, expected)
+	}
+	for _, file := range expected {
+		if !got[file] {
+			t.Errorf("файл %q не найден в %v", file, files)
+		}
+	}
+
+	// .gokbignore применяется и к файлам из git ls-files
+	if exclusions := s.Exclusions(); exclusions[".gokbignore: fixtures/"] != 1 {
+		t.Errorf("Exclusions = %v, ожидалось исключение fixtures/", exclusions)
+	}
+
+	if err := s.SetMode("svn"); err == nil {
+		t.Error("ожидалась ошибка для неизвестного режима")
+	}
+}
+
+func TestScanPaths(t *testing.T) {
+	root := newFixture(t, true, map[string]string{
+		".gokbignore":   "fixtures/\n",
+		"src/app.py":    "x",
+		"src/notes.txt": "x",
+		"fixtures/a.py": "x",
+		"bin/data.py":   strings.Repeat("x", 200),
+	})
+
+	s := NewScanner(root, []string{".py"})
+	s.LoadGitignore()
+	s.SetMaxFileSize(100)
+
+	// Пути из git diff проверяются теми же правилами, удалённые пропускаются
+	report, err := s.ScanPaths([]string{"src/app.py", "src/notes.txt", "fixtures/a.py", "bin/data.py", "src/deleted.py"})
+	if err != nil {
+		t.Fatalf("ScanPaths: %v", err)
+	}
+
+	if len(report.Files) != 1 || filepath.ToSlash(report.Files[0]) != "src/app.py" {
+		t.Errorf("Files = %v, ожидался только src/app.py", report.Files)
+	}
+	if report.Source != SourceGitDiff {
+		t.Errorf("Source = %q, ожидался %q", report.Source, SourceGitDiff)
+	}
+	if !report.Partial {
+		t.Error("Partial = false, ожидалась проверка только перечисленных путей")
+	}
+	if report.Exclusions[".gokbignore: fixtures/"] != 1 || report.Skipped[SkipTooLarge] != 1 {
+		t.Errorf("Exclusions = %v, Skipped = %v; ожидались fixtures/ и большой файл", report.Exclusions, report.Skipped)
+	}
+}
+
+func TestScanChanged(t *testing.T) {
+	root := newFixture(t, false, map[string]string{
+		".gitignore":     "build/\n*.gen.py\n",
+		"src/app.py":     "x",
+		"src/api.gen.py": "x",
+		"build/out.py":   "x",
+	})
+
+	s := NewScanner(root, []string{".py"})
+	s.LoadGitignore()
+
+	// События файловой системы приходят и для игнорируемых файлов: .gitignore применяется
+	report, err := s.ScanChanged([]string{"src/app.py", "src/api.gen.py", "build/out.py", "src", "src/removed.py"})
+	if err != nil {
+		t.Fatalf("ScanChanged: %v", err)
+	}
+	if len(report.Files) != 1 || filepath.ToSlash(report.Files[0]) != "src/app.py" {
+		t.Errorf("Files = %v, ожидался только src/app.py", report.Files)
+	}
+	if report.Source != SourceWatch {
+		t.Errorf("Source = %q, ожидался %q", report.Source, SourceWatch)
+	}
+
+	if !s.DirExcluded("build") || !s.DirExcluded(".git") || s.DirExcluded("src") {
+		t.Errorf("DirExcluded: ожидались отсечённые build и .git и наблюдаемая src")
+	}
+}
+
+func TestScanFilesGitModeFallsBackToWalk(t *testing.T) {
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	root := newFixture(t, false, map[string]string{
+		".gitignore": "*.log\n",
+		"src/app.py": "x",
+		"debug.log":  "x",
+	})
+
+	s := NewScanner(root, []string{".py", ".log"})
+	s.LoadGitignore()
+	s.SetMode(ModeGit)
+
+	files, err := s.ScanFiles()
+	if err != nil {
+		t.Fatalf("ScanFiles: %v", err)
+	}
+	if len(files) != 1 || filepath.ToSlash(files[0]) != "src/app.py" {
+		t.Errorf("ScanFiles = %v, ожидался только src/app.py", files)
+	}
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Политики обработки символических ссылок
+const (
+	// SymlinksIgnore ссылки на файлы и директории пропускаются
+	SymlinksIgnore = "ignore"
+
+	// SymlinksInsideRoot ссылки проходятся, только если их цель внутри ROOT_DIR
+	SymlinksInsideRoot = "inside-root"
+
+	// SymlinksFollow ссылки проходятся независимо от расположения цели
+	SymlinksFollow = "follow"
+)
+
+// Итоги обработки символических ссылок
+const (
+	LinkFollowed    = "пройдено"
+	LinkIgnored     = "игнорируется политикой ignore"
+	LinkOutsideRoot = "цель за пределами ROOT_DIR"
+	LinkBroken      = "битая ссылка"
+	LinkLoop        = "цикл или повторный проход директории"
+)
+
+// fileKey идентифицирует директорию при поиске циклов: пара устройство/inode,
+// а там, где она недоступна, — реальный путь
+type fileKey struct {
+	dev  uint64
+	ino  uint64
+	path string
+}
+
+// Inode возвращает номер inode файла или 0, если платформа его не сообщает
+func Inode(info fs.FileInfo) uint64 {
+	key, ok := fileID(info)
+	if !ok {
+		return 0
+	}
+	return key.ino
+}
+
+// SetSymlinkPolicy задаёт политику обработки символических ссылок
+func (s *Scanner) SetSymlinkPolicy(policy string) error {
+	switch policy {
+	case SymlinksIgnore, SymlinksInsideRoot, SymlinksFollow:
+		s.symlinkPolicy = policy
+		return nil
+	default:
+		return fmt.Errorf("неизвестная политика символических ссылок %q (ожидается %s, %s или %s)",
+			policy, SymlinksIgnore, SymlinksInsideRoot, SymlinksFollow)
+	}
+}
+
+// Links возвращает количество символических ссылок при последнем сканировании по итогам обработки
+func (s *Scanner) Links() map[string]int {
+	return s.report.Links
+}
+
+// RealPath возвращает реальный путь файла, найденного через символическую ссылку,
+// или пустую строку, если путь файла не содержит ссылок
+func (s *Scanner) RealPath(relPath string) string {
+	return s.realPaths[relPath]
+}
+
+// resetLinks готовит состояние обработки ссылок к новому сканированию
+func (s *Scanner) resetLinks() error {
+	s.realPaths = make(map[string]string)
+	s.visited = make(map[fileKey]bool)
+
+	absRoot, err := filepath.Abs(s.rootDir)
+	if err != nil {
+		return fmt.Errorf("ошибка получения абсолютного пути: %w", err)
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return fmt.Errorf("ошибка разрешения пути %s: %w", s.rootDir, err)
+	}
+	s.realRoot = realRoot
+	return nil
+}
+
+// visit отмечает директорию пройденной; false, если она уже была пройдена
+func (s *Scanner) visit(path string, info fs.FileInfo) bool {
+	key, ok := fileID(info)
+	if !ok {
+		key = fileKey{path: path}
+		if realPath, err := filepath.EvalSymlinks(path); err == nil {
+			key.path = realPath
+		}
+	}
+
+	if s.visited[key] {
+		return false
+	}
+	s.visited[key] = true
+	return true
+}
+
+// followLink обрабатывает символическую ссылку по политике: файл проверяется как обычный,
+// директория обходится под путём ссылки. Для найденных файлов запоминается реальный путь.
+func (s *Scanner) followLink(path, relPath string, withGitignore bool, report *ScanReport) ([]string, error) {
+	if s.symlinkPolicy == SymlinksIgnore {
+		s.countLink(report, relPath, LinkIgnored)
+		return nil, nil
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.countLink(report, relPath, LinkBroken)
+		return nil, nil
+	}
+	if realPath, err = filepath.Abs(realPath); err != nil {
+		return nil, fmt.Errorf("ошибка получения абсолютного пути: %w", err)
+	}
+	if s.symlinkPolicy == SymlinksInsideRoot && !withinDir(s.realRoot, realPath) {
+		s.countLink(report, relPath, LinkOutsideRoot)
+		return nil, nil
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		s.countLink(report, relPath, LinkBroken)
+		return nil, nil
+	}
+
+	if !info.IsDir() {
+		s.countLink(report, relPath, LinkFollowed)
+		stat := func() (fs.FileInfo, error) { return info, nil }
+		accepted, err := s.acceptFile(path, relPath, stat, withGitignore, report)
+		if err != nil || !accepted {
+			return nil, err
+		}
+		s.realPaths[relPath] = realPath
+		return []string{relPath}, nil
+	}
+
+	if rule := s.dirExcludedBy(filepath.Base(path), relPath); rule != "" {
+		s.countPruned(report, relPath, rule)
+		return nil, nil
+	}
+	if !s.visit(realPath, info) {
+		s.countLink(report, relPath, LinkLoop)
+		return nil, nil
+	}
+
+	s.countLink(report, relPath, LinkFollowed)
+	return s.walkTree(realPath, relPath, report)
+}
+
+// withinDir проверяет, что путь path находится внутри директории dir (или совпадает с ней)
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// symlinkFixture создаёт проект со ссылками внутрь корня, наружу, на корень (цикл) и битой ссылкой
+func symlinkFixture(t *testing.T) (string, string) {
+	t.Helper()
+
+	base := newFixture(t, false, nil)
+	root := filepath.Join(base, "project")
+	shared := filepath.Join(base, "shared")
+	writeFixture(t, root, map[string]string{
+		"src/app.py":         "x",
+		"src/lib/util.py":    "x",
+		"nested/deep/mod.py": "x",
+	})
+	writeFixture(t, shared, map[string]string{
+		"docs/guide.md": "x",
+	})
+
+	links := map[string]string{
+		"docs":               filepath.Join(shared, "docs"),
+		"nested/deep/back":   filepath.Join("..", ".."),
+		"app_link.py":        filepath.Join("src", "app.py"),
+		"broken.py":          "missing.py",
+		"nested/ext_file.md": filepath.Join(shared, "docs", "guide.md"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skipf("символические ссылки не поддерживаются: %v", err)
+		}
+	}
+	return root, shared
+}
+
+func TestScanFilesSymlinkPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		files  []string
+		links  map[string]int
+	}{
+		{
+			policy: SymlinksIgnore,
+			files:  []string{"nested/deep/mod.py", "src/app.py", "src/lib/util.py"},
+			links:  map[string]int{LinkIgnored: 5},
+		},
+		{
+			policy: SymlinksInsideRoot,
+			files:  []string{"app_link.py", "nested/deep/mod.py", "src/app.py", "src/lib/util.py"},
+			links:  map[string]int{LinkFollowed: 1, LinkOutsideRoot: 2, LinkBroken: 1, LinkLoop: 1},
+		},
+		{
+			policy: SymlinksFollow,
+			files:  []string{"app_link.py", "docs/guide.md", "nested/deep/mod.py", "nested/ext_file.md", "src/app.py", "src/lib/util.py"},
+			links:  map[string]int{LinkFollowed: 3, LinkBroken: 1, LinkLoop: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			root, shared := symlinkFixture(t)
+
+			s := NewScanner(root, []string{".py", ".md"})
+			s.LoadGitignore()
+			if err := s.SetSymlinkPolicy(tt.policy); err != nil {
+				t.Fatalf("SetSymlinkPolicy: %v", err)
+			}
+
+			files, err := s.ScanFiles()
+			if err != nil {
+				t.Fatalf("ScanFiles: %v", err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, filepath.ToSlash(file))
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("ScanFiles = %v, ожидалось %v", got, tt.files)
+			}
+
+			links := s.Links()
+			if len(links) != len(tt.links) {
+				t.Errorf("Links = %v, ожидалось %v", links, tt.links)
+			}
+			for result, count := range tt.links {
+				if links[result] != count {
+					t.Errorf("%s: %d, ожидалось %d", result, links[result], count)
+				}
+			}
+
+			// Файлы из обычных директорий не получают реального пути
+			if realPath := s.RealPath(filepath.Join("src", "app.py")); realPath != "" {
+				t.Errorf("RealPath(src/app.py) = %q, ожидалась пустая строка", realPath)
+			}
+			if tt.policy == SymlinksFollow {
+				realShared, _ := filepath.EvalSymlinks(shared)
+				want := filepath.Join(realShared, "docs", "guide.md")
+				if realPath := s.RealPath(filepath.Join("docs", "guide.md")); realPath != want {
+					t.Errorf("RealPath(docs/guide.md) = %q, ожидалось %q", realPath, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetSymlinkPolicyRejectsUnknown(t *testing.T) {
+	s := NewScanner(t.TempDir(), []string{".py"})
+	if err := s.SetSymlinkPolicy("always"); err == nil {
+		t.Error("ожидалась ошибка для неизвестной политики")
+	}
+}
@@ -0,0 +1,293 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// tempFilePatterns шаблоны имён временных файлов редакторов: события по ним не попадают в пачки
+var tempFilePatterns = []string{
+	".#*", "#*#", "*~", // Emacs: блокировки, автосохранения и резервные копии
+	"*.sw?", "4913", // Vim: swap-файлы и проверка записи в директорию
+	"*___jb_tmp___", "*___jb_old___", // JetBrains: безопасная запись
+	"*.kate-swp", ".goutputstream-*", "*.crswap", "*.tmp",
+}
+
+// Root корень наблюдения
+type Root struct {
+	Path string
+
+	// SkipDir сообщает, что директорию (путь относительно корня) наблюдать не нужно; nil — наблюдать все
+	SkipDir func(relPath string) bool
+}
+
+// Batch изменения, накопленные за серию событий
+type Batch struct {
+	// Paths изменённые пути относительно корней в порядке, в котором корни переданы в New.
+	// Путь может указывать на удалённую или переименованную директорию.
+	Paths [][]string
+
+	// Rescan очередь событий ядра переполнилась: часть изменений потеряна, корни нужно проверить полностью
+	Rescan bool
+}
+
+// Empty проверяет, что в пачке нет изменений
+func (b Batch) Empty() bool {
+	if b.Rescan {
+		return false
+	}
+	for _, paths := range b.Paths {
+		if len(paths) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Watcher рекурсивно следит за директориями корней и отдаёт изменения пачками,
+// когда поток событий затихает на время debounce
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	roots    []Root
+	debounce time.Duration
+
+	// hold откладывает выдачу пачки, пока возвращает true (например, пока git держит index.lock)
+	hold func() bool
+
+	// onError обработчик ошибок, не прерывающих наблюдение
+	onError func(error)
+
+	pending []map[string]bool
+	rescan  bool
+}
+
+// New создаёт наблюдатель и подписывается на директории корней, пропуская отсечённые SkipDir
+func New(roots []Root, debounce time.Duration) (*Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания наблюдателя файловой системы: %w", err)
+	}
+
+	w := &Watcher{
+		fs:       fsWatcher,
+		roots:    roots,
+		debounce: debounce,
+		pending:  make([]map[string]bool, len(roots)),
+	}
+	for i := range w.pending {
+		w.pending[i] = make(map[string]bool)
+	}
+
+	if err := w.Sync(); err != nil {
+		fsWatcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetHold задаёт условие, при котором готовая пачка откладывается ещё на debounce
+func (w *Watcher) SetHold(hold func() bool) {
+	w.hold = hold
+}
+
+// SetErrorHandler задаёт обработчик ошибок, не прерывающих наблюдение
+func (w *Watcher) SetErrorHandler(handler func(error)) {
+	w.onError = handler
+}
+
+// Sync заново обходит корни и подписывается на директории, которые ещё не наблюдаются
+// (например, после изменения правил игнорирования)
+func (w *Watcher) Sync() error {
+	for i := range w.roots {
+		if err := w.addTree(i, w.roots[i].Path, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirCount возвращает количество наблюдаемых директорий
+func (w *Watcher) DirCount() int {
+	return len(w.fs.WatchList())
+}
+
+// Close прекращает наблюдение
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
+
+// Run обрабатывает события до отмены контекста. handle вызывается в той же горутине, поэтому
+// пачки обрабатываются по одной; события, пришедшие во время обработки, попадают в следующую пачку.
+// Если handle возвращает false, пачка возвращается в очередь и выдаётся снова через debounce
+// вместе с изменениями, накопленными за это время.
+func (w *Watcher) Run(ctx context.Context, handle func(Batch) bool) error {
+	var ready <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if w.record(event) {
+				ready = time.After(w.debounce)
+			}
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.rescan = true
+				ready = time.After(w.debounce)
+				continue
+			}
+			w.reportError(err)
+
+		case <-ready:
+			if w.hold != nil && w.hold() {
+				ready = time.After(w.debounce)
+				continue
+			}
+			ready = nil
+
+			batch := w.take()
+			if !batch.Empty() && !handle(batch) {
+				w.requeue(batch)
+				ready = time.After(w.debounce)
+			}
+		}
+	}
+}
+
+// record запоминает путь события во всех корнях, которым он принадлежит.
+// Возвращает false, если событие не меняет содержимое файлов корней.
+func (w *Watcher) record(event fsnotify.Event) bool {
+	// Смена прав и времени доступа не меняет содержимое
+	if event.Op == fsnotify.Chmod || TempFile(filepath.Base(event.Name)) {
+		return false
+	}
+
+	recorded := false
+	for i, root := range w.roots {
+		relPath, ok := relativePath(root.Path, event.Name)
+		if !ok || relPath == "" {
+			continue
+		}
+
+		// Новая директория: подписываемся на неё и отмечаем файлы, созданные до подписки
+		if event.Has(fsnotify.Create) {
+			if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+				if root.SkipDir != nil && root.SkipDir(relPath) {
+					continue
+				}
+				if err := w.addTree(i, event.Name, w.pending[i]); err != nil {
+					w.reportError(err)
+				}
+				recorded = true
+				continue
+			}
+		}
+
+		w.pending[i][relPath] = true
+		recorded = true
+	}
+	return recorded
+}
+
+// addTree подписывается на директорию dir корня с индексом index и её поддиректории.
+// Если files не nil, в него добавляются пути найденных файлов относительно корня.
+func (w *Watcher) addTree(index int, dir string, files map[string]bool) error {
+	root := w.roots[index]
+
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Директория могла исчезнуть между событием и обходом
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		relPath, _ := relativePath(root.Path, path)
+		if !entry.IsDir() {
+			if files != nil && !TempFile(entry.Name()) {
+				files[relPath] = true
+			}
+			return nil
+		}
+
+		if relPath != "" && root.SkipDir != nil && root.SkipDir(relPath) {
+			return filepath.SkipDir
+		}
+		if err := w.fs.Add(path); err != nil {
+			return fmt.Errorf("ошибка подписки на директорию %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// take забирает накопленные изменения
+func (w *Watcher) take() Batch {
+	batch := Batch{Paths: make([][]string, len(w.roots)), Rescan: w.rescan}
+	for i, pending := range w.pending {
+		for path := range pending {
+			batch.Paths[i] = append(batch.Paths[i], path)
+		}
+		sort.Strings(batch.Paths[i])
+		w.pending[i] = make(map[string]bool)
+	}
+	w.rescan = false
+	return batch
+}
+
+// requeue возвращает необработанную пачку к накопленным изменениям
+func (w *Watcher) requeue(batch Batch) {
+	for i, paths := range batch.Paths {
+		for _, path := range paths {
+			w.pending[i][path] = true
+		}
+	}
+	w.rescan = w.rescan || batch.Rescan
+}
+
+// reportError передаёт ошибку обработчику, если он задан
+func (w *Watcher) reportError(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// TempFile проверяет, что имя файла похоже на временный файл редактора
+func TempFile(name string) bool {
+	for _, pattern := range tempFilePatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// relativePath возвращает путь относительно корня ("" для самого корня) и false, если путь вне корня
+func relativePath(root, path string) (string, bool) {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if relPath == "." {
+		return "", true
+	}
+	return relPath, true
+}
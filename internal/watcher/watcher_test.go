@@ -0,0 +1,181 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTempFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"app.py":              false,
+		"notes.md":            false,
+		".#app.py":            true,
+		"#app.py#":            true,
+		"app.py~":             true,
+		".app.py.swp":         true,
+		"4913":                true,
+		"app.py___jb_tmp___":  true,
+		"README.md.kate-swp":  true,
+		".goutputstream-X1Y2": true,
+		"upload.tmp":          true,
+	} {
+		if got := TempFile(name); got != want {
+			t.Errorf("TempFile(%q) = %v, ожидалось %v", name, got, want)
+		}
+	}
+}
+
+// nextBatch запускает наблюдатель, выполняет действия и возвращает первую пачку
+func nextBatch(t *testing.T, w *Watcher, actions func()) Batch {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	batches := make(chan Batch, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx, func(batch Batch) bool {
+			batches <- batch
+			cancel()
+			return true
+		})
+	}()
+
+	actions()
+
+	select {
+	case batch := <-batches:
+		<-done
+		return batch
+	case <-ctx.Done():
+		t.Fatal("пачка изменений не получена")
+	}
+	return Batch{}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherBatchesChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "src", "app.py"), "x")
+	writeFile(t, filepath.Join(root, "ignored", "skip.py"), "x")
+
+	skipDir := func(relPath string) bool { return relPath == "ignored" || relPath == filepath.Join("pkg", "vendor") }
+	w, err := New([]Root{{Path: root, SkipDir: skipDir}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer w.Close()
+
+	if w.DirCount() != 2 {
+		t.Errorf("DirCount = %d, ожидались корень и src", w.DirCount())
+	}
+
+	// Серия правок выдаётся одной пачкой: временные файлы и отсечённые директории не попадают в неё,
+	// а файлы новой директории, созданные до подписки на неё, попадают
+	batch := nextBatch(t, w, func() {
+		writeFile(t, filepath.Join(root, "src", "app.py"), "y")
+		writeFile(t, filepath.Join(root, "src", ".app.py.swp"), "swap")
+		writeFile(t, filepath.Join(root, "ignored", "skip.py"), "y")
+		writeFile(t, filepath.Join(root, "pkg", "lib", "mod.py"), "x")
+		writeFile(t, filepath.Join(root, "pkg", "vendor", "dep.py"), "x")
+	})
+
+	want := []string{filepath.Join("pkg", "lib", "mod.py"), filepath.Join("src", "app.py")}
+	if batch.Rescan || len(batch.Paths) != 1 || !reflect.DeepEqual(batch.Paths[0], want) {
+		t.Errorf("Batch = %+v, ожидались пути %v", batch, want)
+	}
+
+	// Удалённая директория приходит собственным путём
+	batch = nextBatch(t, w, func() {
+		if err := os.RemoveAll(filepath.Join(root, "pkg")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !contains(batch.Paths[0], "pkg") {
+		t.Errorf("Paths = %v, ожидался удалённый pkg", batch.Paths[0])
+	}
+}
+
+func TestWatcherHold(t *testing.T) {
+	root := t.TempDir()
+	w, err := New([]Root{{Path: root}}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer w.Close()
+
+	holds := 0
+	w.SetHold(func() bool {
+		holds++
+		return holds < 3
+	})
+
+	batch := nextBatch(t, w, func() {
+		writeFile(t, filepath.Join(root, "a.py"), "x")
+	})
+	if holds != 3 || !reflect.DeepEqual(batch.Paths[0], []string{"a.py"}) {
+		t.Errorf("holds = %d, Paths = %v; ожидалась пачка с a.py после двух отсрочек", holds, batch.Paths[0])
+	}
+}
+
+func TestWatcherRetriesUnhandledBatch(t *testing.T) {
+	root := t.TempDir()
+	w, err := New([]Root{{Path: root}}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Первая пачка не обработана: она выдаётся снова вместе с изменением, сделанным после отказа
+	var batches []Batch
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx, func(batch Batch) bool {
+			batches = append(batches, batch)
+			if len(batches) == 1 {
+				writeFile(t, filepath.Join(root, "b.py"), "x")
+				return false
+			}
+			cancel()
+			return true
+		})
+	}()
+
+	writeFile(t, filepath.Join(root, "a.py"), "x")
+	<-done
+
+	if len(batches) != 2 {
+		t.Fatalf("получено пачек %d, ожидалось 2", len(batches))
+	}
+	if !reflect.DeepEqual(batches[1].Paths[0], []string{"a.py", "b.py"}) {
+		t.Errorf("Paths = %v, ожидалась повторная пачка с a.py и b.py", batches[1].Paths[0])
+	}
+}
+
+func contains(paths []string, path string) bool {
+	for _, item := range paths {
+		if item == path {
+			return true
+		}
+	}
+	return false
+}